@@ -4,10 +4,17 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"io"
 	"log"
 	"mime/multipart"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"real-time-chat-app/logger"
+	"strings"
+	"time"
 
 	"github.com/cloudinary/cloudinary-go"
 	"github.com/cloudinary/cloudinary-go/api/uploader"
@@ -56,3 +63,83 @@ func UploadMedia(file multipart.File, fileHeader *multipart.FileHeader) (string,
 	// Return the media URL
 	return uploadResult.SecureURL, nil
 }
+
+// ErrNotCloudinaryMedia is returned by OpenMedia for URLs that are not Cloudinary delivery
+// URLs.
+var ErrNotCloudinaryMedia = errors.New("not a Cloudinary media URL")
+
+// DeleteMedia removes an uploaded media file from Cloudinary by the public ID and resource
+// type recorded when it was uploaded. Files that are already gone are not an error.
+func DeleteMedia(resourceType string, publicID string) error {
+	cld, err := InitCloudinary()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := cld.Upload.Destroy(ctx, uploader.DestroyParams{
+		PublicID:     publicID,
+		ResourceType: resourceType,
+	})
+	if err != nil {
+		return err
+	}
+	if result.Result != "ok" && result.Result != "not found" {
+		return errors.New("unable to delete media " + publicID + ": " + result.Result)
+	}
+	return nil
+}
+
+// OpenMedia downloads an uploaded media file by its delivery URL. Only Cloudinary URLs are
+// fetched, so links users put in their messages never make the server send requests.
+func OpenMedia(mediaURL string) (io.ReadCloser, error) {
+	if _, _, err := parseMediaURL(mediaURL); err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Get(mediaURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New("unable to download media: " + resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// parseMediaURL returns the resource type and public ID of a Cloudinary delivery URL of the
+// form https://res.cloudinary.com/<cloud>/<type>/upload/[v<version>/]<public ID>.<ext>.
+func parseMediaURL(mediaURL string) (string, string, error) {
+	parsed, err := url.Parse(mediaURL)
+	if err != nil || parsed.Host != "res.cloudinary.com" {
+		return "", "", ErrNotCloudinaryMedia
+	}
+	// "", cloud, type, "upload", rest of the path
+	parts := strings.SplitN(parsed.Path, "/", 5)
+	if len(parts) != 5 || parts[3] != "upload" || parts[4] == "" {
+		return "", "", ErrNotCloudinaryMedia
+	}
+	resourceType, publicID := parts[2], parts[4]
+	if first := strings.SplitN(publicID, "/", 2); len(first) == 2 && isVersion(first[0]) {
+		publicID = first[1]
+	}
+	// The extension of raw files is part of their public ID
+	if resourceType != "raw" {
+		publicID = strings.TrimSuffix(publicID, path.Ext(publicID))
+	}
+	return resourceType, publicID, nil
+}
+
+func isVersion(segment string) bool {
+	if len(segment) < 2 || segment[0] != 'v' {
+		return false
+	}
+	for _, r := range segment[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
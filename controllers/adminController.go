@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/security"
+	"real-time-chat-app/services"
+	"real-time-chat-app/validation"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLockoutsController lists the usernames and IPs currently locked out of logging in.
+//
+// @Summary List login lockouts
+// @Description Returns the usernames and client IPs locked out after too many failed logins. Requires the lockout:manage permission.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /admin/lockouts [get]
+func GetLockoutsController(c *gin.Context) {
+	logger.LogInfo("GetLockoutsController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("GetLockoutsController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	lockouts, err := services.GetLockedLogins()
+	if err != nil {
+		logger.LogError("GetLockoutsController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to fetch the lockouts", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("GetLockoutsController :: ended")
+	models.ManageResponse(c.Writer, "Lockouts fetched successfully", http.StatusOK, lockouts, true)
+}
+
+// ClearLockoutController lifts the lockout of a username or IP.
+//
+// @Summary Clear a login lockout
+// @Description Lifts the lockout of a username or client IP and forgets its failed logins. Requires the lockout:manage permission.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param kind path string true "user or ip"
+// @Param subject path string true "Username or IP address"
+// @Success 202 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /admin/lockouts/{kind}/{subject} [delete]
+func ClearLockoutController(c *gin.Context) {
+	logger.LogInfo("ClearLockoutController :: started")
+	if c.Request.Method != "DELETE" {
+		logger.LogError("ClearLockoutController :: error DELETE method required")
+		models.ManageResponse(c.Writer, "DELETE method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	err := services.ClearLockout(c.Param("kind"), c.Param("subject"))
+	if err != nil {
+		logger.LogError("ClearLockoutController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to clear the lockout "+err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	logger.LogInfo("ClearLockoutController :: ended")
+	models.ManageResponse(c.Writer, "Lockout cleared successfully", http.StatusAccepted, nil, true)
+}
+
+// ModerateDeleteMessageController deletes any message, whoever sent it.
+//
+// @Summary Delete a message as a moderator
+// @Description Deletes a message regardless of its sender and sends a message.deleted event to every participant. Requires the message:moderate permission.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path string true "Message ID"
+// @Success 200 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /admin/messages/{id} [delete]
+func ModerateDeleteMessageController(c *gin.Context) {
+	logger.LogInfo("ModerateDeleteMessageController :: started")
+	if c.Request.Method != "DELETE" {
+		logger.LogError("ModerateDeleteMessageController :: error DELETE method required")
+		models.ManageResponse(c.Writer, "DELETE method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	response, err := services.ModerateDeleteMessage(c.Param("id"))
+	if err == models.ErrMessageNotFound {
+		models.ManageResponse(c.Writer, err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("ModerateDeleteMessageController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to delete the message", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("ModerateDeleteMessageController :: ended")
+	models.ManageResponse(c.Writer, "Message deleted successfully", http.StatusOK, response, true)
+}
+
+// ChangeUserRoleController assigns a role to a user.
+//
+// @Summary Change a user's role
+// @Description Assigns ADMIN or CLIENT to a user. The user's sessions are revoked so the new role applies on their next login, and the change is written to the audit log. The last ADMIN cannot be demoted. Requires the user:role permission.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param username path string true "Username"
+// @Param body body models.RoleChangeRequest true "New role"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 409 {object} models.GenericResponse
+// @Router /admin/users/{username}/role [put]
+func ChangeUserRoleController(c *gin.Context) {
+	logger.LogInfo("ChangeUserRoleController :: started")
+	if c.Request.Method != "PUT" {
+		logger.LogError("ChangeUserRoleController :: error PUT method required")
+		models.ManageResponse(c.Writer, "PUT method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request models.RoleChangeRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		logger.LogError("ChangeUserRoleController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := c.Param("username")
+	previous, err := services.ChangeUserRole(username, request.Role)
+	recordAudit(c, models.AuditRoleChange, username, err, map[string]string{"from": string(previous), "to": string(request.Role)})
+	if err == models.ErrLastAdmin {
+		models.ManageResponse(c.Writer, err.Error(), http.StatusConflict, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("ChangeUserRoleController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to change the role "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("ChangeUserRoleController :: ended")
+	models.ManageResponse(c.Writer, "Role of "+username+" changed to "+string(request.Role), http.StatusOK, nil, true)
+}
+
+// ListUsersController lists users for administration.
+//
+// @Summary List users
+// @Description Returns users ordered by username, filtered by a search over username, email and name, role, type and suspension. next_cursor continues to the following page. Requires the user:read permission.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param search query string false "Part of the username, email, first or last name"
+// @Param role query string false "ADMIN or CLIENT"
+// @Param type query string false "bot or person"
+// @Param suspended query bool false "Only suspended or only active users"
+// @Param cursor query string false "Cursor from a previous page"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /admin/users [get]
+func ListUsersController(c *gin.Context) {
+	logger.LogInfo("ListUsersController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("ListUsersController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	query, err := validation.ValidateAdminUserQuery(c.Request.URL.Query())
+	if err != nil {
+		logger.LogError("ListUsersController :: " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	page, err := services.ListUsers(query)
+	if err != nil {
+		logger.LogError("ListUsersController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to fetch the users "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("ListUsersController :: ended")
+	models.ManagePaginatedResponse(c.Writer, "Users fetched successfully", http.StatusOK, page.Users, page.NextCursor)
+}
+
+// GetUserController returns the full record of any user.
+//
+// @Summary View a user
+// @Description Returns the full record of a user, including suspension, linked single sign-on accounts and active sessions. Password hashes and two-factor secrets are never returned. Requires the user:read permission.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param username path string true "Username"
+// @Success 200 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /admin/users/{username} [get]
+func GetUserController(c *gin.Context) {
+	logger.LogInfo("GetUserController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("GetUserController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	user, err := services.GetUserDetail(c.Param("username"))
+	if err != nil {
+		logger.LogError("GetUserController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to fetch the user "+err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	logger.LogInfo("GetUserController :: ended")
+	models.ManageResponse(c.Writer, "User fetched successfully", http.StatusOK, user, true)
+}
+
+// SuspendUserController suspends a user.
+//
+// @Summary Suspend a user
+// @Description Suspends a user: their sessions are logged out, their WebSocket connections closed, and logins, tokens and API keys are refused until the suspension is lifted. Admins cannot suspend themselves. Requires the user:suspend permission.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param username path string true "Username"
+// @Param body body models.SuspendUserRequest false "Reason for the suspension"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /admin/users/{username}/suspend [post]
+func SuspendUserController(c *gin.Context) {
+	logger.LogInfo("SuspendUserController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("SuspendUserController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	// The reason is optional, so an empty body is accepted
+	var request models.SuspendUserRequest
+	if c.Request.ContentLength != 0 {
+		if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+			logger.LogError("SuspendUserController :: error in decoding the body " + err.Error())
+			models.ManageResponse(c.Writer, "error in decoding the body "+err.Error(), http.StatusBadRequest, nil, false)
+			return
+		}
+	}
+
+	username := c.Param("username")
+	err := services.SuspendUser(security.GetPrincipal(c).Username, username, request.Reason)
+	recordAudit(c, models.AuditUserSuspend, username, err, map[string]string{"reason": request.Reason})
+	if err == services.ErrSuspendSelf {
+		models.ManageResponse(c.Writer, err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("SuspendUserController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to suspend the user "+err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	logger.LogInfo("SuspendUserController :: ended")
+	models.ManageResponse(c.Writer, username+" suspended successfully", http.StatusOK, nil, true)
+}
+
+// UnsuspendUserController lifts the suspension of a user.
+//
+// @Summary Unsuspend a user
+// @Description Lifts the suspension of a user so they can log in again. Their API keys work again. Requires the user:suspend permission.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param username path string true "Username"
+// @Success 200 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /admin/users/{username}/unsuspend [post]
+func UnsuspendUserController(c *gin.Context) {
+	logger.LogInfo("UnsuspendUserController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("UnsuspendUserController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	username := c.Param("username")
+	err := services.UnsuspendUser(username)
+	recordAudit(c, models.AuditUserUnsuspend, username, err, nil)
+	if err != nil {
+		logger.LogError("UnsuspendUserController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to unsuspend the user "+err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	logger.LogInfo("UnsuspendUserController :: ended")
+	models.ManageResponse(c.Writer, username+" unsuspended successfully", http.StatusOK, nil, true)
+}
+
+// ForceLogoutController logs a user out of every session.
+//
+// @Summary Force a user to log out
+// @Description Ends every session of a user and closes their WebSocket connections. API keys are not affected. Requires the user:sessions permission.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param username path string true "Username"
+// @Success 202 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /admin/users/{username}/logout [post]
+func ForceLogoutController(c *gin.Context) {
+	logger.LogInfo("ForceLogoutController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("ForceLogoutController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	username := c.Param("username")
+	err := services.ForceLogout(username)
+	recordAudit(c, models.AuditForceLogout, username, err, nil)
+	if err != nil {
+		logger.LogError("ForceLogoutController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to log out the user "+err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	logger.LogInfo("ForceLogoutController :: ended")
+	models.ManageResponse(c.Writer, username+" logged out of every session", http.StatusAccepted, nil, true)
+}
+
+// AdminResetPasswordController resets the password of a user.
+//
+// @Summary Reset a user's password
+// @Description Replaces the user's password with a random one, logs them out everywhere and emails them a link to choose a new password. Requires the user:password permission.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param username path string true "Username"
+// @Success 202 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /admin/users/{username}/reset-password [post]
+func AdminResetPasswordController(c *gin.Context) {
+	logger.LogInfo("AdminResetPasswordController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("AdminResetPasswordController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	username := c.Param("username")
+	err := services.AdminResetPassword(username)
+	recordAudit(c, models.AuditPasswordReset, username, err, nil)
+	if err != nil {
+		logger.LogError("AdminResetPasswordController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to reset the password "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("AdminResetPasswordController :: ended")
+	models.ManageResponse(c.Writer, "Password reset, a link to choose a new one was emailed to "+username, http.StatusAccepted, nil, true)
+}
+
+// GetStatsController returns system statistics.
+//
+// @Summary System statistics
+// @Description Returns user counts by role, bots and suspended users, the messages sent on each of the last days, and the WebSocket connections and online users on this server. Requires the stats:read permission.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param days query int false "Days of message counts, including today (default 7, max 90)"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /admin/stats [get]
+func GetStatsController(c *gin.Context) {
+	logger.LogInfo("GetStatsController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("GetStatsController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	days := 0
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 90 {
+			models.ManageResponse(c.Writer, "days must be a number from 1 to 90", http.StatusBadRequest, nil, false)
+			return
+		}
+		days = parsed
+	}
+
+	stats, err := services.GetAdminStats(days)
+	if err != nil {
+		logger.LogError("GetStatsController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to fetch the statistics", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("GetStatsController :: ended")
+	models.ManageResponse(c.Writer, "Statistics fetched successfully", http.StatusOK, stats, true)
+}
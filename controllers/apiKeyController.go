@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/security"
+	"real-time-chat-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKeyController creates an API key for the authorized user or one of their bots.
+//
+// @Summary Create an API key
+// @Description Creates a scoped API key acting as the user, or as one of the user's bots when bot is set. The key is sent in the X-API-Key header and is only shown in this response.
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param body body models.CreateAPIKeyRequest true "Key name, scopes and expiry"
+// @Success 201 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /user/apikeys [post]
+func CreateAPIKeyController(c *gin.Context) {
+	logger.LogInfo("CreateAPIKeyController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("CreateAPIKeyController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request models.CreateAPIKeyRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		logger.LogError("CreateAPIKeyController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	owner := security.GetPrincipal(c).Username
+	response, err := services.CreateAPIKey(owner, &request)
+	details := map[string]string{"name": request.Name}
+	if response != nil {
+		details["key_id"] = response.APIKey.KeyID
+	}
+	target := owner
+	if request.Bot != "" {
+		target = request.Bot
+	}
+	recordAudit(c, models.AuditAPIKeyCreate, target, err, details)
+	if err == models.ErrBotNotFound {
+		models.ManageResponse(c.Writer, err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("CreateAPIKeyController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to create the API key "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("CreateAPIKeyController :: ended")
+	models.ManageResponse(c.Writer, "API key created, store it now as it will not be shown again", http.StatusCreated, response, true)
+}
+
+// GetAPIKeysController lists the API keys the authorized user created.
+//
+// @Summary List API keys
+// @Description Lists the API keys the user created for themselves and their bots, including revoked and expired ones. The keys themselves are never returned.
+// @Tags API Keys
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /user/apikeys [get]
+func GetAPIKeysController(c *gin.Context) {
+	logger.LogInfo("GetAPIKeysController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("GetAPIKeysController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	keys, err := services.GetAPIKeys(security.GetPrincipal(c).Username)
+	if err != nil {
+		logger.LogError("GetAPIKeysController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to fetch the API keys", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("GetAPIKeysController :: ended")
+	models.ManageResponse(c.Writer, "API keys fetched successfully", http.StatusOK, keys, true)
+}
+
+// RevokeAPIKeyController revokes one of the authorized user's API keys.
+//
+// @Summary Revoke an API key
+// @Description Revokes an API key the user created. Requests with it are rejected from then on and WebSocket connections opened with it are closed.
+// @Tags API Keys
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path string true "API key ID"
+// @Success 202 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /user/apikeys/{id} [delete]
+func RevokeAPIKeyController(c *gin.Context) {
+	logger.LogInfo("RevokeAPIKeyController :: started")
+	if c.Request.Method != "DELETE" {
+		logger.LogError("RevokeAPIKeyController :: error DELETE method required")
+		models.ManageResponse(c.Writer, "DELETE method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	err := services.RevokeAPIKey(security.GetPrincipal(c).Username, c.Param("id"))
+	recordAudit(c, models.AuditAPIKeyRevoke, c.Param("id"), err, nil)
+	if err != nil {
+		logger.LogError("RevokeAPIKeyController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to revoke the API key "+err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	logger.LogInfo("RevokeAPIKeyController :: ended")
+	models.ManageResponse(c.Writer, "API key revoked successfully", http.StatusAccepted, nil, true)
+}
+
+// CreateBotController creates a bot account managed by the authorized user.
+//
+// @Summary Create a bot
+// @Description Creates a bot account owned by the user. Bots cannot log in with a password; create an API key for the bot to use it.
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param body body models.CreateBotRequest true "Bot details"
+// @Success 201 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /user/bots [post]
+func CreateBotController(c *gin.Context) {
+	logger.LogInfo("CreateBotController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("CreateBotController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request models.CreateBotRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		logger.LogError("CreateBotController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	bot, err := services.CreateBot(security.GetPrincipal(c).Username, &request)
+	if err != nil {
+		logger.LogError("CreateBotController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to create the bot "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("CreateBotController :: ended")
+	models.ManageResponse(c.Writer, "Bot created successfully", http.StatusCreated, bot, true)
+}
+
+// GetBotsController lists the bots the authorized user manages.
+//
+// @Summary List bots
+// @Description Lists the bot accounts owned by the user.
+// @Tags API Keys
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /user/bots [get]
+func GetBotsController(c *gin.Context) {
+	logger.LogInfo("GetBotsController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("GetBotsController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	bots, err := services.GetBots(security.GetPrincipal(c).Username)
+	if err != nil {
+		logger.LogError("GetBotsController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to fetch the bots", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("GetBotsController :: ended")
+	models.ManageResponse(c.Writer, "Bots fetched successfully", http.StatusOK, bots, true)
+}
+
+// DeleteBotController deletes one of the authorized user's bots.
+//
+// @Summary Delete a bot
+// @Description Deletes a bot owned by the user, revoking its API keys and closing its WebSocket connections.
+// @Tags API Keys
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param username path string true "Bot username"
+// @Success 202 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /user/bots/{username} [delete]
+func DeleteBotController(c *gin.Context) {
+	logger.LogInfo("DeleteBotController :: started")
+	if c.Request.Method != "DELETE" {
+		logger.LogError("DeleteBotController :: error DELETE method required")
+		models.ManageResponse(c.Writer, "DELETE method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	err := services.DeleteBot(security.GetPrincipal(c).Username, c.Param("username"))
+	if err == models.ErrBotNotFound {
+		models.ManageResponse(c.Writer, err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("DeleteBotController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to delete the bot", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("DeleteBotController :: ended")
+	models.ManageResponse(c.Writer, "Bot deleted successfully", http.StatusAccepted, nil, true)
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/security"
+	"real-time-chat-app/services"
+	"real-time-chat-app/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAuditEventsController returns one page of the audit log, newest first.
+//
+// @Summary Query the audit log
+// @Description Returns audit events newest first, filtered by actor, action, target, outcome, IP and time range. next_cursor continues to older events. Requires the audit:read permission.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param actor query string false "Username that performed the action"
+// @Param action query string false "Action, such as auth.login"
+// @Param target query string false "Username or resource the action was performed on"
+// @Param outcome query string false "success or failure"
+// @Param ip query string false "Client IP"
+// @Param from query string false "RFC 3339 time of the oldest event"
+// @Param to query string false "RFC 3339 time of the newest event"
+// @Param cursor query string false "Cursor from a previous page"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /admin/audit [get]
+func GetAuditEventsController(c *gin.Context) {
+	logger.LogInfo("GetAuditEventsController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("GetAuditEventsController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	query, err := validation.ValidateAuditQuery(c.Request.URL.Query())
+	if err != nil {
+		logger.LogError("GetAuditEventsController :: " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	page, err := services.GetAuditEvents(query)
+	if err != nil {
+		logger.LogError("GetAuditEventsController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to fetch the audit log "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("GetAuditEventsController :: ended")
+	models.ManagePaginatedResponse(c.Writer, "Audit events fetched successfully", http.StatusOK, page.Events, page.NextCursor)
+}
+
+// recordAudit writes an audit event for an action the authorized user performed with the
+// request, failed when err is not nil.
+func recordAudit(c *gin.Context, action models.AuditAction, target string, err error, details map[string]string) {
+	event := &models.AuditEvent{
+		Action:    action,
+		Target:    target,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Outcome:   models.AuditSuccess,
+		Details:   details,
+	}
+	if principal := security.GetPrincipal(c); principal != nil {
+		event.Actor = principal.Username
+		if principal.APIKeyID != "" {
+			if event.Details == nil {
+				event.Details = map[string]string{}
+			}
+			event.Details["api_key"] = principal.APIKeyID
+		}
+	}
+	if err != nil {
+		event.Outcome = models.AuditFailure
+		event.Reason = err.Error()
+	}
+	services.RecordAudit(event)
+}
@@ -5,18 +5,21 @@ import (
 	"net/http"
 	"real-time-chat-app/logger"
 	"real-time-chat-app/models"
+	"real-time-chat-app/security"
 	"real-time-chat-app/services"
 	"real-time-chat-app/validation"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 )
 
 // SignUpController handles user sign-up requests.
 //
 // @Summary Sign up a new user
-// @Description Processes user registration by validating the input and creating a new user.
+// @Description Processes user registration by validating the input and creating a new user. The account
+// starts unverified and a verification link is emailed to the user. New accounts always get the CLIENT role.
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -43,8 +46,8 @@ func SignUpController(w http.ResponseWriter, r *http.Request) {
 	err := decoder.Decode(&user)
 	if err != nil {
 		if strings.HasPrefix(err.Error(), "invalid role:") {
-			logger.LogError("SignUpController ::Invalid role provided. Allowed roles are 'ADMIN' or 'CLIENT")
-			models.ManageResponse(w, "Error : "+"Invalid role provided. Allowed roles are 'ADMIN' or 'CLIENT'.", http.StatusBadRequest, nil, false)
+			logger.LogError("SignUpController ::Invalid role provided. Only 'CLIENT' accounts can sign up")
+			models.ManageResponse(w, "Error : "+"Invalid role provided. Only 'CLIENT' accounts can sign up.", http.StatusBadRequest, nil, false)
 			return
 		}
 		logger.LogError("SignUpController :: error in decoding the body" + err.Error())
@@ -71,12 +74,13 @@ func SignUpController(w http.ResponseWriter, r *http.Request) {
 
 	// // Return success response
 	responseModel := &models.UserResponse{
-		Username:    user.Username,
-		Email:       user.Email,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		Address:     user.Address,
-		DateOfBirth: user.DateOfBirth,
+		Username:      user.Username,
+		Email:         user.Email,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Address:       user.Address,
+		DateOfBirth:   user.DateOfBirth,
+		EmailVerified: user.EmailVerified,
 	}
 	logger.LogInfo("SignUpController :: ended")
 	models.ManageResponse(w, "User created successfully.", http.StatusAccepted, responseModel, true)
@@ -85,17 +89,22 @@ func SignUpController(w http.ResponseWriter, r *http.Request) {
 // LoginController handles user login requests.
 //
 // @Summary User login
-// @Description Authenticates the user with valid credentials and returns a JWT token.
+// @Description Authenticates the user with valid credentials and returns a JWT token. Every login starts
+// a new session, recorded with the optional device_name, the client IP and the User-Agent. Users with
+// two-factor authentication get mfa_required and an mfa_token instead, to be completed at /auth/login/2fa.
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param user body models.LoginUser true "Login User Details"
 // @Success 200 {object} models.GenericResponse
 // @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
 // @Failure 405 {object} models.GenericResponse
+// @Failure 429 {object} models.GenericResponse
 // @Failure 500 {object} models.GenericResponse
 // @Router /auth/login [post]
-func LoginController(w http.ResponseWriter, r *http.Request) {
+func LoginController(c *gin.Context) {
+	w, r := c.Writer, c.Request
 
 	logger.LogInfo("LoginController :: started")
 	if r.Method != "POST" {
@@ -125,17 +134,25 @@ func LoginController(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//password match
-	token, refreshtoken, err := services.LoginUser(&user)
+	resp, err := services.LoginUser(&user, c.ClientIP(), r.UserAgent())
+	if writeLoginThrottled(w, err) {
+		logger.LogError("LoginController :: " + err.Error())
+		return
+	}
+	if err == models.ErrInvalidCredentials {
+		logger.LogError("LoginController :: " + err.Error())
+		models.ManageResponse(w, "Invalid username or password", http.StatusUnauthorized, nil, false)
+		return
+	}
 	if err != nil {
 		logger.LogError("LoginController :: error in service call " + err.Error())
 		models.ManageResponse(w, "Unable to login the User "+err.Error(), http.StatusBadRequest, nil, false)
 		return
 	}
-
-	resp := &models.LoginResponse{
-		Username:     user.Username,
-		Token:        token,
-		RefreshToken: refreshtoken,
+	if resp.MFARequired {
+		logger.LogInfo("LoginController :: ended, second factor required")
+		models.ManageResponse(w, "Two-factor authentication required", http.StatusOK, resp, true)
+		return
 	}
 
 	logger.LogInfo("LoginController :: ended")
@@ -143,11 +160,12 @@ func LoginController(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// LogoutController handles user logout by removing their JWT tokens from the database.
+// LogoutController handles user logout by removing the JWT tokens of the current session from the database.
 //
-// @Summary Logs out the user by invalidating their JWT token.
-// @Description This endpoint logs out the currently logged-in user. The user must be authenticated,
-// and their JWT token will be removed from the database. A valid "Authorization" header with a bearer token is required.
+// @Summary Logs out the current session by invalidating its JWT token.
+// @Description This endpoint logs out the session the token belongs to. The user must be authenticated,
+// and the session's JWT tokens will be removed from the database. Sessions on other devices stay logged in.
+// A valid "Authorization" header with a bearer token is required.
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -167,22 +185,16 @@ func LogoutController(c *gin.Context) {
 		return
 	}
 
-	userClaims, exists := c.Get("user")
-	if !exists {
+	principal := security.GetPrincipal(c)
+	if principal == nil {
 		logger.LogInfo("LogoutController :: unauthorized..")
 		models.ManageResponse(c.Writer, "Unauthorized", http.StatusUnauthorized, nil, false)
 		return
 	}
+	username := principal.Username
 
-	claims, ok := userClaims.(jwt.MapClaims)
-	if !ok {
-		logger.LogInfo("LogoutController :: unable to process claim")
-		models.ManageResponse(c.Writer, "Unable to process claim", http.StatusUnauthorized, nil, false)
-		return
-	}
-	username := claims["username"].(string)
-
-	err := services.LogoutUser(username)
+	err := services.LogoutUser(username, principal.SessionID)
+	recordAudit(c, models.AuditLogout, username, err, nil)
 	if err != nil {
 		logger.LogInfo("LogoutController :: unable to log out " + err.Error())
 		models.ManageResponse(c.Writer, "Unableto Logout", http.StatusBadRequest, nil, false)
@@ -193,18 +205,418 @@ func LogoutController(c *gin.Context) {
 
 }
 
+// RefreshTokenController exchanges a refresh token for a new access and refresh token pair.
+//
+// @Summary Refresh tokens
+// @Description Exchanges the current refresh token for a new token pair. Each refresh token can only
+// be used once; presenting one that was already exchanged revokes the session.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param body body models.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /auth/refresh [post]
+func RefreshTokenController(c *gin.Context) {
+	logger.LogInfo("RefreshTokenController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("RefreshTokenController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request models.RefreshTokenRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	if err := decoder.Decode(&request); err != nil || request.RefreshToken == "" {
+		logger.LogError("RefreshTokenController :: error in decoding the body")
+		models.ManageResponse(c.Writer, "refresh_token is required", http.StatusBadRequest, nil, false)
+		return
+	}
+
+	resp, err := services.RefreshSession(request.RefreshToken)
+	if writeLoginThrottled(c.Writer, err) {
+		logger.LogError("RefreshTokenController :: " + err.Error())
+		return
+	}
+	if err == services.ErrInvalidRefreshToken || err == services.ErrRefreshTokenReused {
+		logger.LogError("RefreshTokenController :: " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), http.StatusUnauthorized, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("RefreshTokenController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to refresh the token "+err.Error(), http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("RefreshTokenController :: ended")
+	models.ManageResponse(c.Writer, "Token refreshed successfully", http.StatusOK, resp, true)
+}
+
+// ForgotPasswordController emails a password reset link.
+//
+// @Summary Request a password reset
+// @Description Emails a single-use password reset link to the user registered with the email address.
+// The response is the same whether or not the address is registered.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param body body models.ForgotPasswordRequest true "Email address"
+// @Success 202 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/password/forgot [post]
+func ForgotPasswordController(c *gin.Context) {
+	logger.LogInfo("ForgotPasswordController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("ForgotPasswordController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request models.ForgotPasswordRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	if err := decoder.Decode(&request); err != nil {
+		logger.LogError("ForgotPasswordController :: error in decoding the body")
+		models.ManageResponse(c.Writer, "error in decoding the body", http.StatusBadRequest, nil, false)
+		return
+	}
+
+	if err := validation.ForgotPasswordValidation(&request); err != nil {
+		logger.LogError("ForgotPasswordController :: error in validation  " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	if err := services.ForgotPassword(request.Email); err != nil {
+		logger.LogError("ForgotPasswordController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to request a password reset", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("ForgotPasswordController :: ended")
+	models.ManageResponse(c.Writer, "If the email is registered, a reset link has been sent", http.StatusAccepted, nil, true)
+}
+
+// ResetPasswordController sets a new password with a token from a reset link.
+//
+// @Summary Reset the password
+// @Description Sets a new password using the token from a password reset email. The token can be used
+// once, and every session of the user is logged out.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param body body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/password/reset [post]
+func ResetPasswordController(c *gin.Context) {
+	logger.LogInfo("ResetPasswordController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("ResetPasswordController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request models.ResetPasswordRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	if err := decoder.Decode(&request); err != nil {
+		logger.LogError("ResetPasswordController :: error in decoding the body")
+		models.ManageResponse(c.Writer, "error in decoding the body", http.StatusBadRequest, nil, false)
+		return
+	}
+
+	if err := validation.ResetPasswordValidation(&request); err != nil {
+		logger.LogError("ResetPasswordController :: error in validation  " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	err := services.ResetPassword(&request)
+	if err == services.ErrInvalidResetToken {
+		logger.LogError("ResetPasswordController :: " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("ResetPasswordController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to reset the password", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("ResetPasswordController :: ended")
+	models.ManageResponse(c.Writer, "Password reset successfully, please login again", http.StatusOK, nil, true)
+}
+
+// VerifyEmailController confirms the user's email address with the token from a verification email.
+//
+// @Summary Verify email address
+// @Description Marks the email address as verified using the token from the link emailed at signup.
+// @Tags Authentication
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/verify [get]
+func VerifyEmailController(c *gin.Context) {
+	logger.LogInfo("VerifyEmailController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("VerifyEmailController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		logger.LogError("VerifyEmailController :: token missing")
+		models.ManageResponse(c.Writer, "please provide the token in query parameter", http.StatusBadRequest, nil, false)
+		return
+	}
+
+	err := services.VerifyEmail(token)
+	if err == services.ErrInvalidVerificationToken {
+		logger.LogError("VerifyEmailController :: " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("VerifyEmailController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to verify the email", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("VerifyEmailController :: ended")
+	models.ManageResponse(c.Writer, "Email verified successfully", http.StatusOK, nil, true)
+}
+
+// ResendVerificationController emails a new verification link to the authorized user.
+//
+// @Summary Resend verification email
+// @Description Sends a new verification link and invalidates the previous one. Emails are throttled, and
+// 429 is returned when one was sent too recently.
+// @Tags Authentication
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 202 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 409 {object} models.GenericResponse
+// @Failure 429 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/verify/resend [post]
+func ResendVerificationController(c *gin.Context) {
+	logger.LogInfo("ResendVerificationController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("ResendVerificationController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+
+	err := services.ResendVerification(username)
+	switch err {
+	case nil:
+	case services.ErrEmailAlreadyVerified:
+		logger.LogError("ResendVerificationController :: " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), http.StatusConflict, nil, false)
+		return
+	case services.ErrVerificationThrottled:
+		logger.LogError("ResendVerificationController :: " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), http.StatusTooManyRequests, nil, false)
+		return
+	default:
+		logger.LogError("ResendVerificationController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to send the verification email", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("ResendVerificationController :: ended")
+	models.ManageResponse(c.Writer, "Verification email sent", http.StatusAccepted, nil, true)
+}
+
+// WebSocketTicketController issues a short-lived ticket for opening the /ws connection.
+//
+// @Summary Issue a WebSocket ticket
+// @Description Returns a single-use ticket valid for 60 seconds that authenticates /ws?ticket=... for
+// clients that cannot send an Authorization header during the WebSocket handshake.
+// @Tags Authentication
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/ws-ticket [post]
+func WebSocketTicketController(c *gin.Context) {
+	logger.LogInfo("WebSocketTicketController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("WebSocketTicketController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	principal := security.GetPrincipal(c)
+	if principal == nil {
+		logger.LogInfo("WebSocketTicketController :: unauthorized..")
+		models.ManageResponse(c.Writer, "Unauthorized", http.StatusUnauthorized, nil, false)
+		return
+	}
+	username := principal.Username
+
+	ticket, expiresIn, err := services.IssueWebSocketTicket(username, principal.SessionID)
+	if err != nil {
+		logger.LogError("WebSocketTicketController :: " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), http.StatusInternalServerError, nil, false)
+		return
+	}
+
+	resp := &models.WebSocketTicketResponse{
+		Ticket:    ticket,
+		ExpiresIn: expiresIn,
+	}
+	logger.LogInfo("WebSocketTicketController :: ended")
+	models.ManageResponse(c.Writer, "WebSocket ticket issued", http.StatusOK, resp, true)
+}
+
+// GetSessionsController lists the active sessions of the authorized user.
+//
+// @Summary List sessions
+// @Description Returns every device the user is logged in on, most recently used first. The session
+// the request was made with is marked current.
+// @Tags Authentication
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/sessions [get]
+func GetSessionsController(c *gin.Context) {
+	logger.LogInfo("GetSessionsController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("GetSessionsController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	principal := security.GetPrincipal(c)
+	username := principal.Username
+	sessionID := principal.SessionID
+
+	sessions, err := services.GetSessions(username, sessionID)
+	if err != nil {
+		logger.LogError("GetSessionsController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to fetch the sessions", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("GetSessionsController :: ended")
+	models.ManageResponse(c.Writer, "Sessions fetched successfully", http.StatusOK, sessions, true)
+}
+
+// RevokeSessionController ends one session of the authorized user.
+//
+// @Summary Revoke a session
+// @Description Logs out the session with the given ID and closes its WebSocket connections.
+// @Tags Authentication
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param id path string true "Session ID"
+// @Success 202 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /auth/sessions/{id} [delete]
+func RevokeSessionController(c *gin.Context) {
+	logger.LogInfo("RevokeSessionController :: started")
+	if c.Request.Method != "DELETE" {
+		logger.LogError("RevokeSessionController :: error DELETE method required")
+		models.ManageResponse(c.Writer, "DELETE method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+
+	err := services.RevokeSession(username, c.Param("id"))
+	if err != nil {
+		logger.LogError("RevokeSessionController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to revoke the session "+err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	logger.LogInfo("RevokeSessionController :: ended")
+	models.ManageResponse(c.Writer, "Session revoked successfully", http.StatusAccepted, nil, true)
+}
+
+// LogoutOtherSessionsController ends every session of the authorized user except the current one.
+//
+// @Summary Log out everywhere else
+// @Description Logs out every other device of the user and closes their WebSocket connections. The
+// session the request was made with stays logged in.
+// @Tags Authentication
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 202 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/sessions/logout-others [post]
+func LogoutOtherSessionsController(c *gin.Context) {
+	logger.LogInfo("LogoutOtherSessionsController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("LogoutOtherSessionsController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	principal := security.GetPrincipal(c)
+	username := principal.Username
+	sessionID := principal.SessionID
+
+	count, err := services.LogoutOtherSessions(username, sessionID)
+	if err != nil {
+		logger.LogError("LogoutOtherSessionsController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to log out the other sessions", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("LogoutOtherSessionsController :: ended")
+	models.ManageResponse(c.Writer, "Other sessions logged out successfully", http.StatusAccepted, gin.H{"revoked": count}, true)
+}
+
+// writeLoginThrottled answers with 429 and a Retry-After header when err says logins are
+// throttled, or with 403 when the account is suspended or scheduled for deletion, and
+// reports whether it did.
+func writeLoginThrottled(w http.ResponseWriter, err error) bool {
+	if err == models.ErrAccountSuspended || err == models.ErrAccountPendingDeletion {
+		models.ManageErrorResponse(w, err.Error(), http.StatusForbidden, models.ErrorCode(err))
+		return true
+	}
+	throttled, ok := err.(*models.LoginThrottledError)
+	if !ok {
+		return false
+	}
+	retryAfter := int(throttled.RetryAfter.Seconds())
+	if throttled.RetryAfter > time.Duration(retryAfter)*time.Second {
+		retryAfter++
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	models.ManageResponse(w, throttled.Error(), http.StatusTooManyRequests, nil, false)
+	return true
+}
+
 // SecureEndpoint handles the secure endpoint requests
 func SecureEndpoint(c *gin.Context) {
 	// Retrieve the user data from the context
-	userClaims, exists := c.Get("user")
-	if !exists {
+	principal := security.GetPrincipal(c)
+	if principal == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	// Return secure data along with user claims
+	// Return secure data along with the authenticated user
 	c.JSON(http.StatusOK, gin.H{
 		"message": "This is a secure endpoint.",
-		"user":    userClaims,
+		"user":    principal,
 	})
 }
@@ -28,6 +28,7 @@ import (
 // @Success      200 {object} models.GenericResponse
 // @Failure      405 {object} models.GenericResponse
 // @Failure      400 {object} models.GenericResponse
+// @Failure      403 {object} models.GenericResponse "code contact_blocked"
 // @Failure      500 {object} models.GenericResponse
 // @Router       /contacts/add [post]
 func AddAndUpdateCOntact(c *gin.Context) {
@@ -49,16 +50,19 @@ func AddAndUpdateCOntact(c *gin.Context) {
 		return
 	}
 
-	claims := security.GetClaims(c)
-	err = validation.ValidateAddAndUpdateContact(contactRequest, claims)
+	err = validation.ValidateAddAndUpdateContact(contactRequest, security.GetPrincipal(c).Username)
 	if err != nil {
 		logger.LogError("AddAndUpdateCOntact :: error in validation the body" + err.Error())
 		models.ManageResponse(c.Writer, "error in validating the body "+err.Error(), http.StatusBadRequest, nil, false)
 		return
 	}
 
-	contactResponse, err := services.HandleContactRequest(contactRequest, claims)
-
+	contactResponse, err := services.HandleContactRequest(contactRequest)
+	if err == models.ErrContactBlocked || err == models.ErrEmailNotVerified {
+		logger.LogError("AddAndUpdateCOntact :: " + err.Error())
+		models.ManageErrorResponse(c.Writer, "error in sending the request "+err.Error(), http.StatusForbidden, models.ErrorCode(err))
+		return
+	}
 	if err != nil {
 		logger.LogError("AddAndUpdateCOntact ::error in sending the request" + err.Error())
 		models.ManageResponse(c.Writer, "error in sending the request "+err.Error(), http.StatusBadRequest, nil, false)
@@ -103,9 +107,7 @@ func GetListofContact(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	claims := security.GetClaims(c)
-
-	claimUsername := claims["username"].(string)
+	claimUsername := security.GetPrincipal(c).Username
 
 	if claimUsername != username {
 		logger.LogError("GetListofContact :: error in fetching the contact Authorize user is not as same as query user")
@@ -126,10 +128,42 @@ func GetListofContact(c *gin.Context) {
 
 }
 
-// BlockOrRemoveContact handles the blocking or removal of a contact for a user.
+// GetBlockedContacts lists the users the authorized user has blocked.
+//
+// @Summary      Lists blocked users.
+// @Description  Returns the usernames the authorized user has blocked. Use the unblock action on /contact/action to lift a block.
+// @Tags         Contacts
+// @Produce      json
+// @Param        Authorization header string true "Bearer token"
+// @Success      200 {object} models.GenericResponse
+// @Failure      405 {object} models.GenericResponse
+// @Failure      406 {object} models.GenericResponse
+// @Router       /contact/blocked [get]
+func GetBlockedContacts(c *gin.Context) {
+	logger.LogInfo("GetBlockedContacts :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("GetBlockedContacts :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+
+	blocked, err := services.GetBlockedContacts(username)
+	if err != nil {
+		logger.LogError("GetBlockedContacts :: error in fetching the blocked contacts " + err.Error())
+		models.ManageResponse(c.Writer, "error in fetching the blocked contacts ", http.StatusNotAcceptable, nil, false)
+		return
+	}
+	logger.LogInfo("GetBlockedContacts :: ended")
+	models.ManageResponse(c.Writer, "successfully fetched the blocked contacts of user : "+username, http.StatusOK, blocked, true)
+}
+
+// BlockOrRemoveContact handles the blocking, unblocking or removal of a contact for a user.
 // This function expects a POST request with a valid payload and authorized user claims.
 //
-// @Description Handles the blocking or removal of a contact based on user input.
+// @Description Handles the blocking, unblocking or removal of a contact based on user input.
+// Blocking works whichever side sent the contact request, and also for users who are not contacts.
 // It validates the request payload, checks user authorization, and updates the contact status.
 // @Tags Contacts
 // @Accept  json
@@ -164,9 +198,7 @@ func BlockOrRemoveContact(c *gin.Context) {
 		return
 	}
 
-	claims := security.GetClaims(c)
-
-	claimUsername := claims["username"].(string)
+	claimUsername := security.GetPrincipal(c).Username
 
 	if claimUsername != contactRequest.UserID {
 		logger.LogError("BlockOrRemoveContact :: error in fetching the contact Authorize user is not as same as query user")
@@ -175,6 +207,12 @@ func BlockOrRemoveContact(c *gin.Context) {
 	}
 
 	contactResponse, err := services.UpdateContact(contactRequest)
+	switch contactRequest.Action {
+	case models.ActionBlock:
+		recordAudit(c, models.AuditContactBlock, contactRequest.ContactID, err, nil)
+	case models.ActionUnblock:
+		recordAudit(c, models.AuditContactUnblock, contactRequest.ContactID, err, nil)
+	}
 	if err != nil {
 		logger.LogError("BlockOrRemoveContact :: error in updating the contact  " + err.Error())
 		models.ManageResponse(c.Writer, err.Error(), http.StatusNotAcceptable, nil, false)
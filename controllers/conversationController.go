@@ -0,0 +1,350 @@
+package controllers
+
+import (
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/security"
+	"real-time-chat-app/services"
+	"real-time-chat-app/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateConversationController creates a new group conversation owned by the authorized user.
+//
+// @Description Creates a group conversation with the authorized user as owner.
+// @Tags Conversations
+// @Accept  json
+// @Produce  json
+// @Param  requestBody  body  models.CreateConversationRequest  true  "Conversation payload"
+// @Success 200  {object}  models.GenericResponse
+// @Failure 400  {object}  models.GenericResponse
+// @Failure 405  {object}  models.GenericResponse
+// @Router /conversation/create [post]
+func CreateConversationController(c *gin.Context) {
+	logger.LogInfo("CreateConversationController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("CreateConversationController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request *models.CreateConversationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.LogError("CreateConversationController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	err := validation.ValidateCreateConversation(request)
+	if err != nil {
+		logger.LogError("CreateConversationController :: error in validation " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	conversation, err := services.CreateConversation(request, username)
+	if err != nil {
+		logger.LogError("CreateConversationController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to create the conversation "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("CreateConversationController :: ended")
+	models.ManageResponse(c.Writer, "Conversation created successfully", http.StatusOK, conversation, true)
+}
+
+// GetConversationsController lists the group conversations the authorized user belongs to.
+//
+// @Description Lists the group conversations of the authorized user.
+// @Tags Conversations
+// @Produce  json
+// @Success 200  {object}  models.GenericResponse
+// @Failure 405  {object}  models.GenericResponse
+// @Failure 406  {object}  models.GenericResponse
+// @Router /conversation/get [get]
+func GetConversationsController(c *gin.Context) {
+	logger.LogInfo("GetConversationsController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("GetConversationsController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	conversations, err := services.GetConversations(username)
+	if err != nil {
+		logger.LogError("GetConversationsController :: " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), http.StatusNotAcceptable, nil, false)
+		return
+	}
+	logger.LogInfo("GetConversationsController :: ended")
+	models.ManageResponse(c.Writer, "successfully fetched the conversations of user : "+username, http.StatusOK, conversations, true)
+}
+
+// RenameConversationController renames a group conversation. Only the owner or an admin may rename.
+//
+// @Description Renames a group conversation.
+// @Tags Conversations
+// @Accept  json
+// @Produce  json
+// @Param  requestBody  body  models.RenameConversationRequest  true  "Rename payload"
+// @Success 200  {object}  models.GenericResponse
+// @Failure 400  {object}  models.GenericResponse
+// @Failure 405  {object}  models.GenericResponse
+// @Router /conversation/rename [patch]
+func RenameConversationController(c *gin.Context) {
+	logger.LogInfo("RenameConversationController :: started")
+	if c.Request.Method != "PATCH" {
+		logger.LogError("RenameConversationController :: PATCH method is required")
+		models.ManageResponse(c.Writer, "PATCH method is required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request *models.RenameConversationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.LogError("RenameConversationController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	err := validation.ValidateRenameConversation(request)
+	if err != nil {
+		logger.LogError("RenameConversationController :: error in validation " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	conversation, err := services.RenameConversation(request, username)
+	if err != nil {
+		logger.LogError("RenameConversationController :: " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to rename the conversation "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("RenameConversationController :: ended")
+	models.ManageResponse(c.Writer, "Conversation renamed successfully", http.StatusOK, conversation, true)
+}
+
+// AddConversationMembersController adds members to a group conversation. Only the owner or an admin may add.
+//
+// @Description Adds members to a group conversation.
+// @Tags Conversations
+// @Accept  json
+// @Produce  json
+// @Param  requestBody  body  models.ConversationMembersRequest  true  "Members payload"
+// @Success 200  {object}  models.GenericResponse
+// @Failure 400  {object}  models.GenericResponse
+// @Failure 405  {object}  models.GenericResponse
+// @Router /conversation/add [post]
+func AddConversationMembersController(c *gin.Context) {
+	logger.LogInfo("AddConversationMembersController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("AddConversationMembersController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request *models.ConversationMembersRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.LogError("AddConversationMembersController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	err := validation.ValidateConversationMembers(request)
+	if err != nil {
+		logger.LogError("AddConversationMembersController :: error in validation " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	conversation, err := services.AddConversationMembers(request, username)
+	if err != nil {
+		logger.LogError("AddConversationMembersController :: " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to add members "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("AddConversationMembersController :: ended")
+	models.ManageResponse(c.Writer, "Members added successfully", http.StatusOK, conversation, true)
+}
+
+// RemoveConversationMembersController removes members from a group conversation.
+// Admins may remove members; only the owner may remove admins.
+//
+// @Description Removes members from a group conversation.
+// @Tags Conversations
+// @Accept  json
+// @Produce  json
+// @Param  requestBody  body  models.ConversationMembersRequest  true  "Members payload"
+// @Success 200  {object}  models.GenericResponse
+// @Failure 400  {object}  models.GenericResponse
+// @Failure 405  {object}  models.GenericResponse
+// @Router /conversation/remove [post]
+func RemoveConversationMembersController(c *gin.Context) {
+	logger.LogInfo("RemoveConversationMembersController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("RemoveConversationMembersController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request *models.ConversationMembersRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.LogError("RemoveConversationMembersController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	err := validation.ValidateConversationMembers(request)
+	if err != nil {
+		logger.LogError("RemoveConversationMembersController :: error in validation " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	conversation, err := services.RemoveConversationMembers(request, username)
+	if err != nil {
+		logger.LogError("RemoveConversationMembersController :: " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to remove members "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("RemoveConversationMembersController :: ended")
+	models.ManageResponse(c.Writer, "Members removed successfully", http.StatusOK, conversation, true)
+}
+
+// ConversationRoleController promotes or demotes a member. Only the owner may change roles.
+//
+// @Description Changes the role (admin or member) of a conversation member.
+// @Tags Conversations
+// @Accept  json
+// @Produce  json
+// @Param  requestBody  body  models.ConversationRoleRequest  true  "Role payload"
+// @Success 200  {object}  models.GenericResponse
+// @Failure 400  {object}  models.GenericResponse
+// @Failure 405  {object}  models.GenericResponse
+// @Router /conversation/role [post]
+func ConversationRoleController(c *gin.Context) {
+	logger.LogInfo("ConversationRoleController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("ConversationRoleController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request *models.ConversationRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.LogError("ConversationRoleController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	err := validation.ValidateConversationRole(request)
+	if err != nil {
+		logger.LogError("ConversationRoleController :: error in validation " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	conversation, err := services.UpdateConversationMemberRole(request, username)
+	if err != nil {
+		logger.LogError("ConversationRoleController :: " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to change the role "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("ConversationRoleController :: ended")
+	models.ManageResponse(c.Writer, "Role updated successfully", http.StatusOK, conversation, true)
+}
+
+// LeaveConversationController removes the authorized user from a group conversation.
+//
+// @Description Leaves a group conversation. Ownership is transferred if the owner leaves.
+// @Tags Conversations
+// @Accept  json
+// @Produce  json
+// @Param  requestBody  body  models.LeaveConversationRequest  true  "Leave payload"
+// @Success 200  {object}  models.GenericResponse
+// @Failure 400  {object}  models.GenericResponse
+// @Failure 405  {object}  models.GenericResponse
+// @Router /conversation/leave [post]
+func LeaveConversationController(c *gin.Context) {
+	logger.LogInfo("LeaveConversationController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("LeaveConversationController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request *models.LeaveConversationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.LogError("LeaveConversationController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	if len(request.ConversationID) < 1 {
+		logger.LogError("LeaveConversationController :: conversation_id missing")
+		models.ManageResponse(c.Writer, "please provide the conversation_id", http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	err := services.LeaveConversation(request, username)
+	if err != nil {
+		logger.LogError("LeaveConversationController :: " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to leave the conversation "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("LeaveConversationController :: ended")
+	models.ManageResponse(c.Writer, "Left the conversation successfully", http.StatusOK, nil, true)
+}
+
+// ConversationMessagesController returns one page of the message history of a group conversation.
+//
+// @Description Fetches a page of messages of a group conversation the authorized user belongs to.
+// @Tags Conversations
+// @Produce  json
+// @Param  conversation_id  query  string  true  "Conversation ID"
+// @Param  before  query  string  false  "Cursor to page back from"
+// @Param  after  query  string  false  "Cursor to page forward from"
+// @Param  limit  query  int  false  "Page size (default 50, max 100)"
+// @Success 200  {object}  models.GenericResponse
+// @Failure 400  {object}  models.GenericResponse
+// @Failure 405  {object}  models.GenericResponse
+// @Failure 406  {object}  models.GenericResponse
+// @Router /conversation/messages [get]
+func ConversationMessagesController(c *gin.Context) {
+	logger.LogInfo("ConversationMessagesController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("ConversationMessagesController :: Invalid method GET required")
+		models.ManageResponse(c.Writer, "Invalid method GET required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	conversationID := c.DefaultQuery("conversation_id", "")
+	if len(conversationID) < 1 {
+		logger.LogError("please provide the conversation_id in query parameter ")
+		models.ManageResponse(c.Writer, "please provide the conversation_id in query parameter ", http.StatusNotAcceptable, nil, false)
+		return
+	}
+
+	page, err := validation.ValidateMessagePage(c.Query("before"), c.Query("after"), c.Query("limit"))
+	if err != nil {
+		logger.LogError("ConversationMessagesController :: " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	messages, err := services.GetConversationMessages(conversationID, username, page)
+	if err != nil {
+		logger.LogError("ConversationMessagesController :: " + err.Error())
+		models.ManageResponse(c.Writer, "Failed to fetch messages "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("ConversationMessagesController :: ended")
+	models.ManagePaginatedResponse(c.Writer, "Successfully fetched chat for conversation : "+conversationID, http.StatusOK, messages.Messages, messages.NextCursor)
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/security"
+	"real-time-chat-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestExportController starts building an archive of the authorized user's data.
+//
+// @Summary Export my data
+// @Description Builds a ZIP archive of the user's profile, contacts and conversations with their messages as JSON
+// and HTML, and the media of those messages, in the background. An export.ready event with a download link valid
+// for EXPORT_TTL_HOURS is sent over the WebSocket once it is ready, or export.failed. One export can be built at a time.
+// @Tags User Management
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 202 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 409 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /user/export [post]
+func RequestExportController(c *gin.Context) {
+	logger.LogInfo("RequestExportController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("RequestExportController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	export, err := services.RequestExport(username)
+	details := map[string]string{}
+	if export != nil {
+		details["export_id"] = export.ID
+	}
+	recordAudit(c, models.AuditDataExport, username, err, details)
+	if err == models.ErrExportInProgress {
+		models.ManageResponse(c.Writer, err.Error(), http.StatusConflict, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("RequestExportController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to start the export", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("RequestExportController :: ended")
+	models.ManageResponse(c.Writer, "Export started, you will be notified when it is ready", http.StatusAccepted, export, true)
+}
+
+// GetExportsController lists the data exports of the authorized user.
+//
+// @Summary List my data exports
+// @Description Lists the user's data exports with their status until they expire. Download links are only sent in
+// the export.ready event.
+// @Tags User Management
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /user/export [get]
+func GetExportsController(c *gin.Context) {
+	logger.LogInfo("GetExportsController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("GetExportsController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	exports, err := services.GetExports(security.GetPrincipal(c).Username)
+	if err != nil {
+		logger.LogError("GetExportsController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to fetch the exports", http.StatusInternalServerError, nil, false)
+		return
+	}
+	logger.LogInfo("GetExportsController :: ended")
+	models.ManageResponse(c.Writer, "Exports fetched successfully", http.StatusOK, exports, true)
+}
+
+// DownloadExportController serves the archive of a data export.
+//
+// @Summary Download a data export
+// @Description Downloads the ZIP archive of a data export with the token from the link in the export.ready event.
+// The link works until the export expires and needs no other authentication.
+// @Tags User Management
+// @Produce application/zip
+// @Param token query string true "Download token"
+// @Success 200 {file} file
+// @Failure 404 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /export/download [get]
+func DownloadExportController(c *gin.Context) {
+	logger.LogInfo("DownloadExportController :: started")
+	if c.Request.Method != "GET" {
+		logger.LogError("DownloadExportController :: error GET method required")
+		models.ManageResponse(c.Writer, "GET method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	export, archive, err := services.OpenExport(c.Query("token"))
+	if err != nil {
+		logger.LogError("DownloadExportController :: " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(archive, "export-"+export.Username+"-"+export.CreatedAt.Format("2006-01-02")+".zip")
+	logger.LogInfo("DownloadExportController :: ended")
+}
@@ -6,6 +6,7 @@ import (
 	"real-time-chat-app/models"
 	"real-time-chat-app/security"
 	"real-time-chat-app/services"
+	"real-time-chat-app/validation"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,6 +22,7 @@ import (
 // @Param  requestBody  body  models.Message  true  "Message payload"
 // @Success 200  {object}  models.GenericResponse
 // @Failure 400  {object}  models.GenericResponse
+// @Failure 403  {object}  models.GenericResponse "code contact_blocked"
 // @Failure 405  {object}  models.GenericResponse
 // @Router /messages/sent [post]
 func MessageSentController(c *gin.Context) {
@@ -38,12 +40,8 @@ func MessageSentController(c *gin.Context) {
 		models.ManageResponse(c.Writer, "Invalid input ", http.StatusBadRequest, nil, false)
 		return
 	}
-	logger.LogInfo("username from message  " + message.SenderID)
-	logger.LogInfo("media from message  " + message.MediaURL)
-	logger.LogInfo("reciept from message  " + message.RecipientID)
 
-	claims := security.GetClaims(c)
-	username := claims["username"].(string)
+	username := security.GetPrincipal(c).Username
 	if username != message.SenderID {
 		logger.LogError("MessageSentController :: Authorize user can only sent the message ")
 		models.ManageResponse(c.Writer, "Authorize user can only sent the message  ", http.StatusBadRequest, nil, false)
@@ -62,6 +60,11 @@ func MessageSentController(c *gin.Context) {
 	}
 
 	response, err := services.SendMessage(&message, mediaFile, mediaHeader)
+	if err == models.ErrContactBlocked || err == models.ErrEmailNotVerified {
+		logger.LogError("MessageSentController :: " + err.Error())
+		models.ManageErrorResponse(c.Writer, "Failed to send message : "+err.Error(), http.StatusForbidden, models.ErrorCode(err))
+		return
+	}
 	if err != nil {
 		logger.LogError("MessageSentController :: Failed to send message ")
 		models.ManageResponse(c.Writer, "Failed to send message"+err.Error(), http.StatusBadRequest, nil, false)
@@ -72,13 +75,18 @@ func MessageSentController(c *gin.Context) {
 }
 
 // MessageGetAllController retrieves all messages between the authorized user and a specified recipient.
-// This endpoint accepts a GET request with the recipient ID as a query parameter.
+// This endpoint accepts a GET request with the recipient ID as a query parameter and returns
+// one page of both sides of the conversation, interleaved in timestamp order. The newest page
+// is returned when no cursor is given; next_cursor continues in the requested direction.
 //
-// @Description Fetches all messages exchanged with a specific recipient.
+// @Description Fetches all messages exchanged with a specific recipient, sent and received.
 // @Tags Messages
 // @Accept  json
 // @Produce  json
 // @Param  reciever  query  string  true  "Recipient ID"
+// @Param  before  query  string  false  "Cursor to page back from"
+// @Param  after  query  string  false  "Cursor to page forward from"
+// @Param  limit  query  int  false  "Page size (default 50, max 100)"
 // @Success 200  {object}  models.GenericResponse
 // @Failure 400  {object}  models.GenericResponse
 // @Failure 405  {object}  models.GenericResponse
@@ -100,20 +108,64 @@ func MessageGetAllController(c *gin.Context) {
 		return
 	}
 
-	claims := security.GetClaims(c)
-	username := claims["username"].(string)
-	response, err := services.GetMessage(username, reciever)
+	page, err := validation.ValidateMessagePage(c.Query("before"), c.Query("after"), c.Query("limit"))
+	if err != nil {
+		logger.LogError("MessageGetAllController :: " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	response, err := services.GetMessage(username, reciever, page)
 	if err != nil {
 		logger.LogError("MessageSentController :: Failed to send message ")
 		models.ManageResponse(c.Writer, "Failed to send message"+err.Error(), http.StatusBadRequest, nil, false)
 		return
 	}
 
-	models.ManageResponse(c.Writer, "Successfully fetched chat for user : "+reciever, http.StatusOK, response, true)
+	models.ManagePaginatedResponse(c.Writer, "Successfully fetched chat for user : "+reciever, http.StatusOK, response.Messages, response.NextCursor)
 
 	logger.LogInfo("MessageGetAllController :: ended")
 }
 
+// MessageStatusController acknowledges delivery or reading of a message by the authorized user.
+// The sender of the message is notified over the WebSocket.
+//
+// @Description Marks a received message as delivered or read.
+// @Tags Messages
+// @Accept  json
+// @Produce  json
+// @Param  requestBody  body  models.MessageStatusUpdate  true  "Receipt payload"
+// @Success 200  {object}  models.GenericResponse
+// @Failure 400  {object}  models.GenericResponse
+// @Failure 405  {object}  models.GenericResponse
+// @Router /messages/status [post]
+func MessageStatusController(c *gin.Context) {
+	logger.LogInfo("MessageStatusController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("MessageStatusController :: Invalid method POST required")
+		models.ManageResponse(c.Writer, "Invalid method POST required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var update *models.MessageStatusUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		logger.LogError("MessageStatusController ::uanble to parse the json " + err.Error())
+		models.ManageResponse(c.Writer, "uanble to parse the json", http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	err := services.UpdateMessageStatus(update, username)
+	if err != nil {
+		logger.LogError("MessageStatusController :: " + err.Error())
+		models.ManageResponse(c.Writer, "unable to update the message status "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("MessageStatusController :: ended")
+	models.ManageResponse(c.Writer, "Message marked as "+update.Status, http.StatusOK, update, true)
+}
+
 func MessageEditController(c *gin.Context) {
 	logger.LogInfo("MessageEditController :: started")
 
@@ -130,7 +182,7 @@ func MessageEditController(c *gin.Context) {
 		return
 	}
 
-	username := security.GetClaims(c)["username"].(string)
+	username := security.GetPrincipal(c).Username
 	logger.LogInfo("Username fetch from authorization token " + username)
 
 	if username != editMessage.FromUserID {
@@ -140,6 +192,11 @@ func MessageEditController(c *gin.Context) {
 	}
 
 	messageResponse, err := services.MessageEdit(editMessage)
+	if err == models.ErrContactBlocked {
+		logger.LogError("MessageEditController :: " + err.Error())
+		models.ManageErrorResponse(c.Writer, "unable to edit message : "+err.Error(), http.StatusForbidden, models.ErrorCode(err))
+		return
+	}
 	if err != nil {
 		logger.LogError("unable to edit message error from service ")
 		models.ManageResponse(c.Writer, "unable to edit message error from service ", http.StatusBadRequest, "", false)
@@ -164,7 +221,7 @@ func MessageDeleteController(c *gin.Context) {
 		return
 	}
 
-	username := security.GetClaims(c)["username"].(string)
+	username := security.GetPrincipal(c).Username
 	logger.LogInfo("Username fetch from authorization token " + username)
 
 	if username != editMessage.FromUserID {
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/security"
+	"real-time-chat-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginMFAController completes a login that requires a second factor.
+//
+// @Summary Complete two-factor login
+// @Description Exchanges the mfa_token returned by /auth/login and a code from the authenticator app, or an
+// unused recovery code, for the session tokens. The mfa_token is valid for 5 minutes.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param body body models.MFALoginRequest true "MFA token and code"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 429 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/login/2fa [post]
+func LoginMFAController(c *gin.Context) {
+	logger.LogInfo("LoginMFAController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("LoginMFAController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request models.MFALoginRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	if err := decoder.Decode(&request); err != nil || request.MFAToken == "" || request.Code == "" {
+		logger.LogError("LoginMFAController :: error in decoding the body")
+		models.ManageResponse(c.Writer, "mfa_token and code are required", http.StatusBadRequest, nil, false)
+		return
+	}
+
+	resp, err := services.CompleteMFALogin(&request, c.ClientIP(), c.Request.UserAgent())
+	if writeLoginThrottled(c.Writer, err) {
+		logger.LogError("LoginMFAController :: " + err.Error())
+		return
+	}
+	if err != nil {
+		logger.LogError("LoginMFAController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), mfaErrorStatus(err), nil, false)
+		return
+	}
+	logger.LogInfo("LoginMFAController :: ended")
+	models.ManageResponse(c.Writer, "User LoggedIn successfully.", http.StatusOK, resp, true)
+}
+
+// EnrollTOTPController starts two-factor enrollment for the authorized user.
+//
+// @Summary Start two-factor enrollment
+// @Description Generates a TOTP secret and its otpauth URI to show as a QR code. Two-factor authentication is
+// enabled once a code is confirmed at /auth/2fa/confirm. Enrolling again replaces an unconfirmed secret.
+// @Tags Authentication
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 409 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/2fa/enroll [post]
+func EnrollTOTPController(c *gin.Context) {
+	logger.LogInfo("EnrollTOTPController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("EnrollTOTPController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+
+	resp, err := services.EnrollTOTP(username)
+	if err != nil {
+		logger.LogError("EnrollTOTPController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), mfaErrorStatus(err), nil, false)
+		return
+	}
+	logger.LogInfo("EnrollTOTPController :: ended")
+	models.ManageResponse(c.Writer, "Scan the secret with your authenticator app and confirm a code", http.StatusOK, resp, true)
+}
+
+// ConfirmTOTPController enables two-factor authentication for the authorized user.
+//
+// @Summary Confirm two-factor enrollment
+// @Description Enables two-factor authentication once the code from the authenticator app matches the secret
+// from /auth/2fa/enroll. Returns recovery codes, which are shown only once.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param body body models.MFACodeRequest true "Code from the authenticator app"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 409 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/2fa/confirm [post]
+func ConfirmTOTPController(c *gin.Context) {
+	logger.LogInfo("ConfirmTOTPController :: started")
+	request, ok := decodeMFACode(c, "ConfirmTOTPController")
+	if !ok {
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+
+	resp, err := services.ConfirmTOTP(username, request.Code)
+	if err != nil {
+		logger.LogError("ConfirmTOTPController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), mfaErrorStatus(err), nil, false)
+		return
+	}
+	logger.LogInfo("ConfirmTOTPController :: ended")
+	models.ManageResponse(c.Writer, "Two-factor authentication enabled, store the recovery codes safely", http.StatusOK, resp, true)
+}
+
+// DisableTOTPController turns off two-factor authentication for the authorized user.
+//
+// @Summary Disable two-factor authentication
+// @Description Turns off two-factor authentication after checking a code from the authenticator app or a
+// recovery code. Accounts that are required to use two-factor authentication cannot turn it off.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param body body models.MFACodeRequest true "Code from the authenticator app or a recovery code"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 409 {object} models.GenericResponse
+// @Router /auth/2fa/disable [post]
+func DisableTOTPController(c *gin.Context) {
+	logger.LogInfo("DisableTOTPController :: started")
+	request, ok := decodeMFACode(c, "DisableTOTPController")
+	if !ok {
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+
+	if err := services.DisableTOTP(username, request.Code); err != nil {
+		logger.LogError("DisableTOTPController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), mfaErrorStatus(err), nil, false)
+		return
+	}
+	logger.LogInfo("DisableTOTPController :: ended")
+	models.ManageResponse(c.Writer, "Two-factor authentication disabled", http.StatusOK, nil, true)
+}
+
+// RegenerateRecoveryCodesController replaces the recovery codes of the authorized user.
+//
+// @Summary Regenerate recovery codes
+// @Description Issues new recovery codes after checking a code from the authenticator app. The previous codes
+// stop working.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param body body models.MFACodeRequest true "Code from the authenticator app"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 409 {object} models.GenericResponse
+// @Router /auth/2fa/recovery-codes [post]
+func RegenerateRecoveryCodesController(c *gin.Context) {
+	logger.LogInfo("RegenerateRecoveryCodesController :: started")
+	request, ok := decodeMFACode(c, "RegenerateRecoveryCodesController")
+	if !ok {
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+
+	resp, err := services.RegenerateRecoveryCodes(username, request.Code)
+	if err != nil {
+		logger.LogError("RegenerateRecoveryCodesController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), mfaErrorStatus(err), nil, false)
+		return
+	}
+	logger.LogInfo("RegenerateRecoveryCodesController :: ended")
+	models.ManageResponse(c.Writer, "Recovery codes regenerated, store them safely", http.StatusOK, resp, true)
+}
+
+// decodeMFACode checks the method and decodes a request body carrying a code, writing the
+// error response and returning false when either is invalid.
+func decodeMFACode(c *gin.Context, name string) (*models.MFACodeRequest, bool) {
+	if c.Request.Method != "POST" {
+		logger.LogError(name + " :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return nil, false
+	}
+
+	var request models.MFACodeRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	if err := decoder.Decode(&request); err != nil || request.Code == "" {
+		logger.LogError(name + " :: error in decoding the body")
+		models.ManageResponse(c.Writer, "code is required", http.StatusBadRequest, nil, false)
+		return nil, false
+	}
+	return &request, true
+}
+
+func mfaErrorStatus(err error) int {
+	switch err {
+	case services.ErrInvalidMFACode, services.ErrInvalidMFAToken:
+		return http.StatusUnauthorized
+	case services.ErrMFAAlreadyEnabled, services.ErrMFANotEnabled, services.ErrMFANotEnrolling:
+		return http.StatusConflict
+	case services.ErrMFAEnforced:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcBindingCookie holds the binding of a single sign-on login to the browser that started
+// it, so a callback URL from someone else's login cannot log the browser into their account.
+const oidcBindingCookie = "oidc_login"
+
+// setOIDCBindingCookie sets the binding cookie, or deletes it when maxAge is negative.
+func setOIDCBindingCookie(c *gin.Context, binding string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcBindingCookie, binding, maxAge, "/auth/oidc", "", c.Request.TLS != nil, true)
+}
+
+// OIDCLoginController starts a single sign-on login by redirecting to the OpenID Connect provider.
+//
+// @Summary Log in with single sign-on
+// @Description Redirects to the configured OpenID Connect provider using the authorization code flow with
+// PKCE. The provider redirects back to OIDC_REDIRECT_URL, which passes the code and state to /auth/oidc/callback.
+// Sets the short-lived HttpOnly oidc_login cookie, which the callback requires.
+// @Tags Authentication
+// @Param device_name query string false "Name of the device, shown in the session list"
+// @Success 302
+// @Failure 404 {object} models.GenericResponse
+// @Failure 502 {object} models.GenericResponse
+// @Router /auth/oidc/login [get]
+func OIDCLoginController(c *gin.Context) {
+	logger.LogInfo("OIDCLoginController :: started")
+	authURL, binding, err := services.StartOIDCLogin(c.Query("device_name"))
+	if err == services.ErrOIDCDisabled {
+		models.ManageResponse(c.Writer, err.Error(), http.StatusNotFound, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("OIDCLoginController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to reach the identity provider", http.StatusBadGateway, nil, false)
+		return
+	}
+	setOIDCBindingCookie(c, binding, int(services.OIDCStateTTL.Seconds()))
+	logger.LogInfo("OIDCLoginController :: ended")
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallbackController completes a single sign-on login.
+//
+// @Summary Complete a single sign-on login
+// @Description Exchanges the authorization code for the user's identity and logs them in. The provider account is
+// matched to the user it was linked to, else to the user with the same verified email, else a new CLIENT account is
+// created unless OIDC_JIT_PROVISIONING is false. Returns the same response as /auth/login, including the two-factor
+// challenge for users who enabled it. Must be requested by the browser that started the login, with its oidc_login
+// cookie.
+// @Tags Authentication
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State returned by the provider"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 403 {object} models.GenericResponse
+// @Failure 404 {object} models.GenericResponse
+// @Failure 409 {object} models.GenericResponse
+// @Router /auth/oidc/callback [get]
+func OIDCCallbackController(c *gin.Context) {
+	logger.LogInfo("OIDCCallbackController :: started")
+	if providerError := c.Query("error"); providerError != "" {
+		logger.LogError("OIDCCallbackController :: provider returned " + providerError)
+		models.ManageResponse(c.Writer, "Login failed at the identity provider : "+providerError+" "+c.Query("error_description"), http.StatusUnauthorized, nil, false)
+		return
+	}
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		models.ManageResponse(c.Writer, "code and state are required", http.StatusBadRequest, nil, false)
+		return
+	}
+
+	// The binding is needed once, whether or not the login succeeds
+	binding, _ := c.Cookie(oidcBindingCookie)
+	setOIDCBindingCookie(c, "", -1)
+	resp, err := services.CompleteOIDCLogin(code, state, binding, c.ClientIP(), c.Request.UserAgent())
+	if writeLoginThrottled(c.Writer, err) {
+		logger.LogError("OIDCCallbackController :: " + err.Error())
+		return
+	}
+	if err != nil {
+		logger.LogError("OIDCCallbackController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, oidcErrorMessage(err), oidcErrorStatus(err), nil, false)
+		return
+	}
+	logger.LogInfo("OIDCCallbackController :: ended")
+	if resp.MFARequired {
+		models.ManageResponse(c.Writer, "Two-factor authentication required", http.StatusOK, resp, true)
+		return
+	}
+	models.ManageResponse(c.Writer, "User LoggedIn successfully.", http.StatusOK, resp, true)
+}
+
+func oidcErrorStatus(err error) int {
+	switch err {
+	case services.ErrOIDCDisabled:
+		return http.StatusNotFound
+	case services.ErrInvalidOIDCState:
+		return http.StatusBadRequest
+	case services.ErrOIDCEmailNotVerified, services.ErrOIDCProvisionDisabled:
+		return http.StatusForbidden
+	case services.ErrOIDCAccountConflict:
+		return http.StatusConflict
+	}
+	return http.StatusUnauthorized
+}
+
+// oidcErrorMessage hides the details of provider and token failures, which are logged instead.
+func oidcErrorMessage(err error) string {
+	if oidcErrorStatus(err) == http.StatusUnauthorized {
+		return "Login with the identity provider failed"
+	}
+	return err.Error()
+}
@@ -7,6 +7,7 @@ import (
 	"real-time-chat-app/models"
 	"real-time-chat-app/security"
 	"real-time-chat-app/services"
+	"real-time-chat-app/validation"
 
 	"github.com/gin-gonic/gin"
 )
@@ -96,6 +97,7 @@ func UpdateUserAndProfile(c *gin.Context) {
 	}
 
 	userResponse, err := services.UserAndProfileUpdate(username, user)
+	recordAudit(c, models.AuditProfileUpdate, username, err, nil)
 	if err != nil {
 		logger.LogError("UpdateUserAndProfile :: error  while updating the user ")
 		models.ManageResponse(c.Writer, "error while updating the user :: "+err.Error(), http.StatusBadRequest, nil, false)
@@ -108,9 +110,11 @@ func UpdateUserAndProfile(c *gin.Context) {
 }
 
 // DeleteUserController handles deleting a user account.
-// This endpoint accepts a DELETE request and requires an "ADMIN" role to perform the operation.
+// This endpoint accepts a DELETE request and requires the user:delete permission, enforced on the route.
 //
-// @Description Deletes a user account by the specified username.
+// @Description Deletes a user account by the specified username at once, together with its bots, API keys, sessions,
+// contacts and group memberships. Its messages are deleted or anonymized according to ACCOUNT_DELETION_MESSAGES and
+// its media is queued for deletion.
 // @Tags User Management
 // @Accept  json
 // @Produce  json
@@ -136,22 +140,130 @@ func DeleteUserController(c *gin.Context) {
 		return
 	}
 	logger.LogInfo("DeleteUserController :: username is " + username)
-	claims := security.GetClaims(c)
-	role := claims["role"].(string)
-
-	if role == "ADMIN" {
-
-		err := services.DeleteUser(username)
-		if err != nil {
-			logger.LogError("DeleteUserController :: error  while deleting the user ")
-			models.ManageResponse(c.Writer, "error while deleting the user :: "+err.Error(), http.StatusBadRequest, nil, false)
-			c.Abort()
-			return
-		}
-		logger.LogInfo("DeleteUserController :: ended ")
-		models.ManageResponse(c.Writer, "User Deleted succesfully", http.StatusOK, nil, true)
-	} else {
-		logger.LogError("DeleteUserController :: ended NON ADMIN")
-		models.ManageResponse(c.Writer, "User cannot be deleted :: ADMIN role required ", http.StatusBadRequest, nil, false)
+
+	err := services.DeleteAccount(username)
+	recordAudit(c, models.AuditUserDelete, username, err, nil)
+	if err != nil {
+		logger.LogError("DeleteUserController :: error  while deleting the user ")
+		models.ManageResponse(c.Writer, "error while deleting the user :: "+err.Error(), http.StatusBadRequest, nil, false)
+		c.Abort()
+		return
+	}
+	logger.LogInfo("DeleteUserController :: ended ")
+	models.ManageResponse(c.Writer, "User Deleted succesfully", http.StatusOK, nil, true)
+}
+
+// DeleteAccountController schedules the deletion of the authorized user's own account.
+//
+// @Summary Delete my account
+// @Description Schedules the deletion of the account after ACCOUNT_DELETION_GRACE_DAYS. The password, and with
+// two-factor authentication a code, confirm the request. The user is logged out everywhere and emailed a link to
+// keep the account; until then logins and API keys are refused with the account_pending_deletion code.
+// @Tags User Management
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param body body models.DeleteAccountRequest true "Password and, with two-factor authentication, a code"
+// @Success 202 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 401 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Router /user/account/delete [post]
+func DeleteAccountController(c *gin.Context) {
+	logger.LogInfo("DeleteAccountController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("DeleteAccountController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request models.DeleteAccountRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		logger.LogError("DeleteAccountController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body", http.StatusBadRequest, nil, false)
+		return
+	}
+	if err := validation.DeleteAccountValidation(&request); err != nil {
+		logger.LogError("DeleteAccountController :: error in validation " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username := security.GetPrincipal(c).Username
+	response, err := services.RequestAccountDeletion(username, &request)
+	recordAudit(c, models.AuditDeleteRequest, username, err, nil)
+	if err == services.ErrIncorrectPassword || err == services.ErrInvalidMFACode {
+		models.ManageResponse(c.Writer, err.Error(), http.StatusUnauthorized, nil, false)
+		return
+	}
+	if err != nil {
+		logger.LogError("DeleteAccountController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to delete the account "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	logger.LogInfo("DeleteAccountController :: ended")
+	models.ManageResponse(c.Writer, "Account scheduled for deletion, check your email to undo it", http.StatusAccepted, response, true)
+}
+
+// RestoreAccountController cancels a scheduled account deletion with the token from the email.
+//
+// @Summary Keep my account
+// @Description Cancels the scheduled deletion of an account using the token emailed when it was requested. The
+// token can be used once; the user logs in again afterwards.
+// @Tags User Management
+// @Accept json
+// @Produce json
+// @Param body body models.RestoreAccountRequest true "Restore token"
+// @Success 200 {object} models.GenericResponse
+// @Failure 400 {object} models.GenericResponse
+// @Failure 405 {object} models.GenericResponse
+// @Failure 500 {object} models.GenericResponse
+// @Router /auth/account/restore [post]
+func RestoreAccountController(c *gin.Context) {
+	logger.LogInfo("RestoreAccountController :: started")
+	if c.Request.Method != "POST" {
+		logger.LogError("RestoreAccountController :: error POST method required")
+		models.ManageResponse(c.Writer, "POST method required", http.StatusMethodNotAllowed, nil, false)
+		return
+	}
+
+	var request models.RestoreAccountRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil {
+		logger.LogError("RestoreAccountController :: error in decoding the body " + err.Error())
+		models.ManageResponse(c.Writer, "error in decoding the body", http.StatusBadRequest, nil, false)
+		return
+	}
+	if err := validation.RestoreAccountValidation(&request); err != nil {
+		logger.LogError("RestoreAccountController :: error in validation " + err.Error())
+		models.ManageResponse(c.Writer, "Error : "+err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+
+	username, err := services.RestoreAccount(&request)
+	if err == services.ErrInvalidRestoreToken {
+		logger.LogError("RestoreAccountController :: " + err.Error())
+		models.ManageResponse(c.Writer, err.Error(), http.StatusBadRequest, nil, false)
+		return
+	}
+	outcome, reason := models.AuditSuccess, ""
+	if err != nil {
+		outcome, reason = models.AuditFailure, err.Error()
+	}
+	// Nobody is logged in, the token identifies the user
+	services.RecordAudit(&models.AuditEvent{
+		Actor:     username,
+		Action:    models.AuditDeleteCancel,
+		Target:    username,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Outcome:   outcome,
+		Reason:    reason,
+	})
+	if err != nil {
+		logger.LogError("RestoreAccountController :: error in service call " + err.Error())
+		models.ManageResponse(c.Writer, "Unable to restore the account", http.StatusInternalServerError, nil, false)
+		return
 	}
+	logger.LogInfo("RestoreAccountController :: ended")
+	models.ManageResponse(c.Writer, "Account restored, please login again", http.StatusOK, nil, true)
 }
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/security"
+	"real-time-chat-app/services"
+	"real-time-chat-app/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		// This allows connections from any origin. You can customize this for security.
+		return true
+	},
+	// Echo the "bearer" subprotocol back to clients that authenticate with it
+	Subprotocols: []string{security.WebSocketSubprotocol},
+}
+
+// WebSocketController authenticates the request, upgrades it to a WebSocket connection for
+// the user and processes the commands the client sends over it until the connection
+// closes. With ?since=<seq> the events stored after that sequence number are replayed before
+// live events. The connection is closed by the server when the session it was opened with is logged out.
+func WebSocketController(c *gin.Context) {
+	log.Println("WebSocket connection requested")
+
+	// Authenticate before upgrading so failures are reported as plain HTTP responses
+	principal, err := security.AuthenticateWebSocket(c.Request)
+	if err == models.ErrAccountSuspended || err == models.ErrAccountPendingDeletion {
+		models.ManageErrorResponse(c.Writer, err.Error(), http.StatusForbidden, models.ErrorCode(err))
+		return
+	}
+	if err != nil {
+		logger.LogError("WebSocketController :: unauthorized " + err.Error())
+		models.ManageResponse(c.Writer, "Unauthorized : "+err.Error(), http.StatusUnauthorized, nil, false)
+		return
+	}
+	userID := principal.Username
+	sessionID := principal.SessionID
+
+	since := int64(-1)
+	if value := c.Query("since"); value != "" {
+		since, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || since < 0 {
+			logger.LogError("WebSocketController :: invalid since " + value)
+			models.ManageResponse(c.Writer, "since must be a non-negative sequence number", http.StatusBadRequest, nil, false)
+			return
+		}
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Println("Failed to upgrade connection:", err)
+		return
+	}
+
+	client := utils.Connections.Register(userID, sessionID, conn)
+	if err := services.ResumeEvents(client, since); err != nil {
+		logger.LogError("WebSocketController :: unable to replay events " + err.Error())
+		utils.Connections.Unregister(client)
+		return
+	}
+	services.SendContactPresence(client)
+	client.ReadPump(func(payload []byte) {
+		handleSocketCommand(client, payload)
+	})
+	log.Printf("WebSocket connection closed for %s", userID)
+}
+
+// handleSocketCommand dispatches a command received over the socket and answers it with an
+// ack or error event carrying the command id. Payloads without a type are treated as the
+// bare delivered/read acknowledgements sent by older clients.
+func handleSocketCommand(client *utils.Client, payload []byte) {
+	var command models.Command
+	if err := json.Unmarshal(payload, &command); err != nil {
+		logger.LogError("handleSocketCommand :: invalid payload from " + client.Username + " " + err.Error())
+		replySocketError(client, "", errors.New("invalid command payload"))
+		return
+	}
+
+	var (
+		data interface{}
+		err  error
+	)
+	switch command.Type {
+	case "":
+		handleSocketStatusUpdate(client.Username, payload)
+		return
+	case models.CommandMessageSend:
+		data, err = handleSocketMessageSend(client.Username, command.Payload)
+	case models.CommandReceipt:
+		data, err = handleSocketReceipt(client.Username, command.Payload)
+	case models.CommandTyping:
+		err = handleSocketTyping(client.Username, command.Payload)
+	case models.CommandPresence:
+		err = handleSocketPresence(client.Username, command.Payload)
+	default:
+		err = errors.New("unknown command type " + command.Type)
+	}
+
+	if err != nil {
+		logger.LogError("handleSocketCommand :: " + command.Type + " failed for " + client.Username + " " + err.Error())
+		replySocketError(client, command.ID, err)
+		return
+	}
+	utils.SendToClient(client, utils.NewEvent(models.EventAck, &models.CommandResult{
+		CommandID: command.ID,
+		Data:      data,
+	}))
+}
+
+// handleSocketMessageSend sends a text message on behalf of the connected user.
+func handleSocketMessageSend(username string, payload json.RawMessage) (interface{}, error) {
+	var request models.SendMessageCommand
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return nil, errors.New("invalid message.send payload")
+	}
+	if err := request.IsValid(); err != nil {
+		return nil, err
+	}
+
+	message := &models.Message{
+		SenderID:       username,
+		RecipientID:    request.RecipientID,
+		ConversationID: request.ConversationID,
+		Content:        request.Content,
+	}
+	return services.SendMessage(message, nil, nil)
+}
+
+// handleSocketReceipt records a delivered or read acknowledgement from the connected user.
+func handleSocketReceipt(username string, payload json.RawMessage) (interface{}, error) {
+	var update models.MessageStatusUpdate
+	if err := json.Unmarshal(payload, &update); err != nil {
+		return nil, errors.New("invalid receipt payload")
+	}
+	if err := services.UpdateMessageStatus(&update, username); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// handleSocketTyping relays a typing start or stop from the connected user.
+func handleSocketTyping(username string, payload json.RawMessage) error {
+	var command models.TypingCommand
+	if err := json.Unmarshal(payload, &command); err != nil {
+		return errors.New("invalid typing payload")
+	}
+	return services.HandleTyping(&command, username)
+}
+
+// handleSocketPresence marks the connected user as away or back online.
+func handleSocketPresence(username string, payload json.RawMessage) error {
+	var command models.PresenceCommand
+	if err := json.Unmarshal(payload, &command); err != nil {
+		return errors.New("invalid presence payload")
+	}
+	return services.UpdatePresence(&command, username)
+}
+
+func replySocketError(client *utils.Client, commandID string, err error) {
+	utils.SendToClient(client, utils.NewEvent(models.EventError, &models.CommandResult{
+		CommandID: commandID,
+		Error:     err.Error(),
+		Code:      models.ErrorCode(err),
+	}))
+}
+
+// handleSocketStatusUpdate applies a bare delivered/read acknowledgement received over the socket.
+func handleSocketStatusUpdate(userID string, payload []byte) {
+	var update models.MessageStatusUpdate
+	if err := json.Unmarshal(payload, &update); err != nil {
+		logger.LogError("handleSocketStatusUpdate :: invalid payload from " + userID + " " + err.Error())
+		return
+	}
+	if err := services.UpdateMessageStatus(&update, userID); err != nil {
+		logger.LogError("handleSocketStatusUpdate :: unable to update status " + err.Error())
+	}
+}
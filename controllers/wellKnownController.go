@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSController serves the public keys tokens are signed with, so other services can
+// verify them. The document is a standard JWK set rather than a models.GenericResponse.
+//
+// @Summary JSON Web Key Set
+// @Description Returns the public keys of the signing keyring as a JWK set (RFC 7517). Tokens name their key in the kid header. Keys rotated out of signing stay listed until they are retired.
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} models.JWKSet
+// @Failure 503 {object} models.GenericResponse
+// @Router /.well-known/jwks.json [get]
+func JWKSController(c *gin.Context) {
+	logger.LogInfo("JWKSController :: started")
+	current := utils.CurrentKeyring()
+	if current == nil {
+		logger.LogError("JWKSController :: signing keys not loaded")
+		models.ManageResponse(c.Writer, "Signing keys not loaded", http.StatusServiceUnavailable, nil, false)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, current.JWKS())
+	logger.LogInfo("JWKSController :: ended")
+}
@@ -35,6 +35,12 @@ func InitMongoDB() {
 	fmt.Println("Connected to MongoDB")
 }
 
+// UseClient makes GetCollection use client instead of the connection of InitMongoDB, such as
+// a client of a mock deployment in tests.
+func UseClient(client *mongo.Client) {
+	mongoClient = client
+}
+
 // GetCollection returns a MongoDB collection
 func GetCollection(collectionName string) *mongo.Collection {
 	// Replace `chat_app_db` with your database name
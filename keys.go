@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"real-time-chat-app/utils"
+)
+
+const keysUsage = `usage: real-time-chat-app keys <command>
+
+Manages the JWT signing keys in JWT_KEYS_DIR (default "keys").
+
+commands:
+  list                         list the keys, marking the active one
+  generate [-alg RS256|EdDSA] [-activate]
+                               add a key, only used for signing when activated
+  rotate [-alg RS256|EdDSA]    add a key and sign new tokens with it; tokens signed
+                               with older keys keep verifying
+  retire <kid>                 remove a key that is no longer active, once the
+                               tokens it signed have expired`
+
+// runKeysCommand runs the keys subcommand. Running servers pick up changes when they reload
+// the keyring, every JWT_KEYS_RELOAD_SECONDS.
+func runKeysCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+	dir := utils.KeysDir()
+
+	switch args[0] {
+	case "list":
+		keyring, err := utils.LoadKeyring(dir)
+		if err != nil {
+			return err
+		}
+		for _, key := range keyring.Keys() {
+			active := ""
+			if key.Active {
+				active = "  (active)"
+			}
+			fmt.Printf("%s  %-6s %s%s\n", key.ID, key.Alg, key.CreatedAt.Format("2006-01-02 15:04:05"), active)
+		}
+		return nil
+
+	case "generate", "rotate":
+		flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+		alg := flags.String("alg", utils.KeyAlgRS256, "signing algorithm, RS256 or EdDSA")
+		activate := flags.Bool("activate", false, "sign new tokens with the key")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		kid, err := utils.GenerateKey(dir, *alg, *activate || args[0] == "rotate")
+		if err != nil {
+			return err
+		}
+		if *activate || args[0] == "rotate" {
+			fmt.Println("generated and activated key " + kid)
+		} else {
+			fmt.Println("generated key " + kid)
+		}
+		return nil
+
+	case "retire":
+		if len(args) != 2 {
+			return errors.New("usage: real-time-chat-app keys retire <kid>")
+		}
+		if err := utils.RetireKey(dir, args[1]); err != nil {
+			return err
+		}
+		fmt.Println("retired key " + args[1])
+		return nil
+	}
+	return errors.New(keysUsage)
+}
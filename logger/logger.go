@@ -31,6 +31,16 @@ func LogInfo(message string) {
 	}
 }
 
+// LogAudit logs a security relevant action, such as a role change, so it can be told
+// apart from ordinary info messages
+func LogAudit(message string) {
+	if Logger != nil {
+		Logger.Println("AUDIT:", message)
+	} else {
+		log.Println("Logger not initialized!")
+	}
+}
+
 // LogError logs an error-level message
 func LogError(message string) {
 	if Logger != nil {
@@ -0,0 +1,160 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"real-time-chat-app/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. The implementation is picked with the MAILER environment variable.
+type Mailer interface {
+	Send(message *Message) error
+}
+
+// Default is the mailer used by the services, set by Init.
+var Default Mailer = NewMemoryMailer()
+
+// Init selects the mailer from the MAILER environment variable: smtp, file (the default,
+// writing each email to MAILER_DIR) or memory.
+func Init() error {
+	from := os.Getenv("MAILER_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return errors.New("SMTP_HOST is required for the smtp mailer")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		Default = &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "memory":
+		Default = NewMemoryMailer()
+	case "", "file":
+		dir := os.Getenv("MAILER_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		Default = &FileMailer{Dir: dir, From: from}
+	default:
+		return errors.New("unknown MAILER " + os.Getenv("MAILER") + " : smtp, file or memory")
+	}
+	logger.LogInfo(fmt.Sprintf("Mailer initialized: %T", Default))
+	return nil
+}
+
+// Send delivers message with the default mailer.
+func Send(message *Message) error {
+	return Default.Send(message)
+}
+
+// SMTPMailer sends email through an SMTP server, authenticating when Username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers message to the SMTP server.
+func (m *SMTPMailer) Send(message *Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	err := smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{message.To}, format(m.From, message))
+	if err != nil {
+		logger.LogError("SMTPMailer :: unable to send email " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// FileMailer writes every email to its own file in Dir instead of sending it, for local
+// development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes message to a new .eml file in the mailer directory.
+func (m *FileMailer) Send(message *Message) error {
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		logger.LogError("FileMailer :: unable to create mail directory " + err.Error())
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(message.To))
+	err := os.WriteFile(filepath.Join(m.Dir, name), format(m.From, message), 0o600)
+	if err != nil {
+		logger.LogError("FileMailer :: unable to write email " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// MemoryMailer keeps sent email in memory, for tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryMailer returns an empty MemoryMailer.
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send records message.
+func (m *MemoryMailer) Send(message *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *message)
+	return nil
+}
+
+// Messages returns the email sent so far.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// format renders message as an RFC 5322 email. Line breaks are removed from header values so
+// user input cannot add headers.
+func format(from string, message *Message) []byte {
+	header := strings.NewReplacer("\r", "", "\n", "")
+	var b strings.Builder
+	b.WriteString("From: " + header.Replace(from) + "\r\n")
+	b.WriteString("To: " + header.Replace(message.To) + "\r\n")
+	b.WriteString("Subject: " + header.Replace(message.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
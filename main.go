@@ -1,12 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"real-time-chat-app/config"
 	"real-time-chat-app/database"
 	"real-time-chat-app/logger"
+	"real-time-chat-app/mailer"
+	"real-time-chat-app/oidc"
 	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/services"
+	"real-time-chat-app/utils"
 
 	routes "real-time-chat-app/routes"
 
@@ -16,22 +21,95 @@ import (
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		// The keys command only needs the environment, a missing .env is fine
+		_ = godotenv.Load()
+		if err := runKeysCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	logger.InitLogger("app.log")
 
 	loadEnvVarible()
 	// Initialize MongoDB connection
 	database.InitMongoDB()
 	repo.InitRepository()
+	if err := repo.MigrateCanonicalChatIDs(); err != nil {
+		logger.LogError("Failed to migrate message chat IDs: " + err.Error())
+	}
+	if err := repo.MigrateContactBlocks(); err != nil {
+		logger.LogError("Failed to migrate contact blocks: " + err.Error())
+	}
+	if err := repo.MigrateEmailVerification(); err != nil {
+		logger.LogError("Failed to migrate email verification: " + err.Error())
+	}
+	if err := repo.EnsureMessageIndexes(); err != nil {
+		logger.LogError("Failed to create message indexes: " + err.Error())
+	}
+	if err := repo.EnsureEventIndexes(); err != nil {
+		logger.LogError("Failed to create event indexes: " + err.Error())
+	}
+	if err := repo.EnsureSessionIndexes(); err != nil {
+		logger.LogError("Failed to create session indexes: " + err.Error())
+	}
+	if err := repo.EnsureUserTokenIndexes(); err != nil {
+		logger.LogError("Failed to create user token indexes: " + err.Error())
+	}
+	if err := repo.EnsureLoginAttemptIndexes(); err != nil {
+		logger.LogError("Failed to create login attempt indexes: " + err.Error())
+	}
+	if err := repo.EnsureOIDCIndexes(); err != nil {
+		logger.LogError("Failed to create OIDC indexes: " + err.Error())
+	}
+	if err := repo.EnsureAPIKeyIndexes(); err != nil {
+		logger.LogError("Failed to create API key indexes: " + err.Error())
+	}
+	if err := repo.EnsureAuditIndexes(); err != nil {
+		logger.LogError("Failed to create audit indexes: " + err.Error())
+	}
+	if err := repo.EnsureDeletionIndexes(); err != nil {
+		logger.LogError("Failed to create deletion indexes: " + err.Error())
+	}
+	if err := repo.EnsureExportIndexes(); err != nil {
+		logger.LogError("Failed to create export indexes: " + err.Error())
+	}
+	if err := utils.InitKeyring(); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	if err := services.BootstrapAdmin(); err != nil {
+		logger.LogError("Failed to bootstrap the admin account: " + err.Error())
+	}
+	if err := mailer.Init(); err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+	if err := oidc.Init(); err != nil {
+		log.Fatalf("Failed to configure OIDC login: %v", err)
+	}
+
+	services.StartPresence()
+	services.StartDataLifecycle()
 
 	// Set up the Gin router
 	r := gin.Default()
 	gin.SetMode(gin.ReleaseMode)
+	// The client IP counts failed logins and is stored with sessions and audit events, so
+	// forwarding headers are only believed from the configured proxies
+	if err := r.SetTrustedProxies(utils.TrustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Register authentication routes
 	routes.AuthRoutes(r)
+	routes.WellKnownRoutes(r)
 	//routes.SecureRoutes(r)
 	routes.UserRoutes(r)
 	routes.ContactRoutes(r)
+	routes.ConversationRoutes(r)
+	routes.AdminRoutes(r)
+	routes.ExportRoutes(r)
 
 	// message
 	routes.MessageRoute(r)
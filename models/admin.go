@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// AdminUserQuery filters the user listing of the admin API. Empty fields match every user;
+// Search matches part of the username, email or name. Cursor is the next_cursor of a
+// previous page.
+type AdminUserQuery struct {
+	Search    string
+	Role      Role
+	Type      UserType
+	Suspended *bool
+	Cursor    string
+	Limit     int
+}
+
+// AdminUserSummary is a user in the admin user listing.
+type AdminUserSummary struct {
+	Username      string     `json:"username" bson:"username"`
+	Email         string     `json:"email" bson:"email"`
+	EmailVerified bool       `json:"email_verified" bson:"email_verified"`
+	FirstName     string     `json:"first_name" bson:"first_name"`
+	LastName      string     `json:"last_name" bson:"last_name"`
+	Role          Role       `json:"role" bson:"role"`
+	Type          UserType   `json:"type,omitempty" bson:"type,omitempty"`
+	BotOwner      string     `json:"bot_owner,omitempty" bson:"bot_owner,omitempty"`
+	TOTPEnabled   bool       `json:"totp_enabled" bson:"totp_enabled"`
+	Suspended     bool       `json:"suspended" bson:"suspended,omitempty"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty" bson:"suspended_at,omitempty"`
+	LastSeen      string     `json:"last_seen" bson:"last_seen"`
+
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty" bson:"deletion_scheduled_at,omitempty"`
+}
+
+// AdminUserPage is one page of the admin user listing, ordered by username.
+type AdminUserPage struct {
+	Users      []*AdminUserSummary
+	NextCursor string
+}
+
+// AdminUserDetail is the full record of a user shown to admins. Secrets such as the password
+// hash and two-factor secrets are left out.
+type AdminUserDetail struct {
+	AdminUserSummary
+	AvatarURL      string         `json:"avatar_url"`
+	StatusMessage  string         `json:"status_message"`
+	Address        string         `json:"address"`
+	DateOfBirth    string         `json:"date_of_birth"`
+	Profile        Profile        `json:"profile"`
+	SuspendedBy    string         `json:"suspended_by,omitempty"`
+	SuspendReason  string         `json:"suspend_reason,omitempty"`
+	OIDCIdentities []OIDCIdentity `json:"oidc_identities,omitempty"`
+	Sessions       []*JwtSession  `json:"sessions"`
+	Online         bool           `json:"online"`
+}
+
+// SuspendUserRequest suspends a user with an optional reason kept on the user record.
+type SuspendUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// DailyMessageCount is the number of messages sent on one UTC day, formatted 2006-01-02.
+type DailyMessageCount struct {
+	Date  string `json:"date" bson:"_id"`
+	Count int64  `json:"count" bson:"count"`
+}
+
+// AdminStats are the system statistics shown to admins.
+type AdminStats struct {
+	Users          int64               `json:"users"`
+	UsersByRole    map[Role]int64      `json:"users_by_role"`
+	Bots           int64               `json:"bots"`
+	SuspendedUsers int64               `json:"suspended_users"`
+	MessagesPerDay []DailyMessageCount `json:"messages_per_day"`
+	ActiveSockets  int                 `json:"active_sockets"`
+	OnlineUsers    int                 `json:"online_users"`
+}
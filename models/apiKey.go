@@ -0,0 +1,111 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// UserType tells accounts of people apart from bots. Accounts of people are stored without a
+// type; UserTypePerson only selects them in queries.
+type UserType string
+
+const (
+	UserTypeBot    UserType = "bot"
+	UserTypePerson UserType = "person"
+)
+
+// APIKeyScope limits what an API key can do. Read scopes allow GET requests to the matching
+// routes and write scopes every other method.
+type APIKeyScope string
+
+const (
+	ScopeMessagesRead       APIKeyScope = "messages:read"
+	ScopeMessagesWrite      APIKeyScope = "messages:write"
+	ScopeContactsRead       APIKeyScope = "contacts:read"
+	ScopeContactsWrite      APIKeyScope = "contacts:write"
+	ScopeConversationsRead  APIKeyScope = "conversations:read"
+	ScopeConversationsWrite APIKeyScope = "conversations:write"
+	ScopeProfileRead        APIKeyScope = "profile:read"
+	ScopeProfileWrite       APIKeyScope = "profile:write"
+)
+
+// APIKeyScopes lists every scope an API key can be given.
+var APIKeyScopes = []APIKeyScope{
+	ScopeMessagesRead, ScopeMessagesWrite,
+	ScopeContactsRead, ScopeContactsWrite,
+	ScopeConversationsRead, ScopeConversationsWrite,
+	ScopeProfileRead, ScopeProfileWrite,
+}
+
+// IsValid reports whether the scope exists.
+func (s APIKeyScope) IsValid() bool {
+	for _, scope := range APIKeyScopes {
+		if scope == s {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrBotNotFound = errors.New("bot not found")
+
+// APIKey authenticates programmatic requests as Username, either the user who created it or
+// one of their bots. Only the hash of the key is stored; keys start with rtc_<KeyID>_ so they
+// can be recognised.
+type APIKey struct {
+	KeyID      string        `json:"id" bson:"key_id"`
+	KeyHash    string        `json:"-" bson:"key_hash"`
+	Name       string        `json:"name" bson:"name"`
+	Username   string        `json:"username" bson:"username"`
+	CreatedBy  string        `json:"created_by" bson:"created_by"`
+	Scopes     []APIKeyScope `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time     `json:"created_at" bson:"created_at"`
+	LastUsedAt *time.Time    `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time    `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	RevokedAt  *time.Time    `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key can still be used.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key was given scope.
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest creates an API key for the authorized user, or for one of their bots
+// when Bot is set. Keys without ExpiresInDays do not expire.
+type CreateAPIKeyRequest struct {
+	Name          string        `json:"name"`
+	Scopes        []APIKeyScope `json:"scopes"`
+	Bot           string        `json:"bot,omitempty"`
+	ExpiresInDays int           `json:"expires_in_days,omitempty"`
+}
+
+// CreateAPIKeyResponse returns a new API key. The key is only ever shown here.
+type CreateAPIKeyResponse struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
+
+// CreateBotRequest creates a bot account owned by the authorized user.
+type CreateBotRequest struct {
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// BotResponse describes a bot account.
+type BotResponse struct {
+	Username  string `json:"username" bson:"username"`
+	FirstName string `json:"first_name" bson:"first_name"`
+	LastName  string `json:"last_name" bson:"last_name"`
+	BotOwner  string `json:"bot_owner" bson:"bot_owner"`
+}
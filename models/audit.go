@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditAction names a security relevant action recorded in the audit log.
+type AuditAction string
+
+const (
+	AuditLogin          AuditAction = "auth.login"
+	AuditLogout         AuditAction = "auth.logout"
+	AuditUserDelete     AuditAction = "user.delete"
+	AuditProfileUpdate  AuditAction = "user.profile_update"
+	AuditRoleChange     AuditAction = "user.role_change"
+	AuditUserSuspend    AuditAction = "user.suspend"
+	AuditUserUnsuspend  AuditAction = "user.unsuspend"
+	AuditForceLogout    AuditAction = "user.force_logout"
+	AuditPasswordReset  AuditAction = "user.password_reset"
+	AuditDeleteRequest  AuditAction = "user.delete_request"
+	AuditDeleteCancel   AuditAction = "user.delete_cancel"
+	AuditDataExport     AuditAction = "user.export"
+	AuditContactBlock   AuditAction = "contact.block"
+	AuditContactUnblock AuditAction = "contact.unblock"
+	AuditAPIKeyCreate   AuditAction = "apikey.create"
+	AuditAPIKeyRevoke   AuditAction = "apikey.revoke"
+)
+
+// AuditOutcome is whether an audited action succeeded.
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditEvent is one entry of the audit log. Entries are only ever inserted; they are removed
+// by the TTL index once ExpiresAt passes.
+type AuditEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Actor     string             `json:"actor" bson:"actor"`
+	Action    AuditAction        `json:"action" bson:"action"`
+	Target    string             `json:"target,omitempty" bson:"target,omitempty"`
+	IP        string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string             `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Outcome   AuditOutcome       `json:"outcome" bson:"outcome"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	Details   map[string]string  `json:"details,omitempty" bson:"details,omitempty"`
+	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
+	ExpiresAt time.Time          `json:"-" bson:"expires_at"`
+}
+
+// AuditQuery filters the audit log. Empty fields match every event. Cursor is the
+// next_cursor of a previous page.
+type AuditQuery struct {
+	Actor   string
+	Action  AuditAction
+	Target  string
+	Outcome AuditOutcome
+	IP      string
+	From    *time.Time
+	To      *time.Time
+	Cursor  string
+	Limit   int
+}
+
+// AuditPage is one page of audit events, newest first.
+type AuditPage struct {
+	Events     []*AuditEvent
+	NextCursor string
+}
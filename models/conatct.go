@@ -13,11 +13,11 @@ type ContactRequest struct {
 	Status     string `json:"status" bson:"status"` // pending, accepted, blocked
 }
 
-// ContactActionRequest represents an action (block or remove) on a contact.
+// ContactActionRequest represents an action (block, unblock or remove) on a contact.
 type ContactActionRequest struct {
 	UserID    string `json:"user_id" bson:"user_id"`
 	ContactID string `json:"contact_id" bson:"contact_id"`
-	Action    string `json:"action" bson:"action"` // remove, block
+	Action    string `json:"action" bson:"action"` // remove, block, unblock
 }
 
 // Contact represents a user's contact information and status.
@@ -26,12 +26,18 @@ type Contact struct {
 	ToUserID   string    `json:"to_user_id" bson:"to_user_id"`
 	Status     string    `json:"status" bson:"status"` // pending, accepted, blocked
 	LastOnline time.Time `json:"last_online" bson:"last_online"`
+	BlockedBy  []string  `json:"blocked_by,omitempty" bson:"blocked_by,omitempty"` // users who blocked the other side
 }
 
+// ErrContactBlocked is returned when either user has blocked the other.
+var ErrContactBlocked = errors.New("you cannot interact with this user")
+
 const (
 	StatusPending  = "pending"
 	StatusAccepted = "accepted"
 	StatusRejected = "rejected"
+	StatusBlocked  = "block"
+	StatusRemoved  = "remove"
 )
 
 // IsValidStatus validates the status value.
@@ -45,17 +51,18 @@ func (car *ContactRequest) IsValidStatus() bool {
 }
 
 const (
-	ActionRemove = "remove"
-	ActionBlock  = "block"
+	ActionRemove  = "remove"
+	ActionBlock   = "block"
+	ActionUnblock = "unblock"
 )
 
 // IsValid checks if the action is valid.
 func (car *ContactActionRequest) IsValid() error {
 	logger.LogInfo("ContactActionRequest :: IsValid")
 	switch car.Action {
-	case ActionRemove, ActionBlock:
+	case ActionRemove, ActionBlock, ActionUnblock:
 		return nil
 	default:
-		return errors.New("invalid action value : remove or block")
+		return errors.New("invalid action value : remove, block or unblock")
 	}
 }
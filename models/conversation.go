@@ -0,0 +1,97 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ConversationRole is the role a member holds inside a group conversation.
+type ConversationRole string
+
+const (
+	ConversationRoleOwner  ConversationRole = "owner"
+	ConversationRoleAdmin  ConversationRole = "admin"
+	ConversationRoleMember ConversationRole = "member"
+)
+
+// Conversation represents a group chat with its members.
+type Conversation struct {
+	ID        string               `json:"conversation_id" bson:"conversation_id"`
+	Name      string               `json:"name" bson:"name"`
+	Owner     string               `json:"owner" bson:"owner"`
+	Members   []ConversationMember `json:"members" bson:"members"`
+	CreatedAt time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at" bson:"updated_at"`
+}
+
+// ConversationMember is a single participant of a group conversation.
+type ConversationMember struct {
+	Username string           `json:"username" bson:"username"`
+	Role     ConversationRole `json:"role" bson:"role"`
+	JoinedAt time.Time        `json:"joined_at" bson:"joined_at"`
+}
+
+// CreateConversationRequest is the payload to create a new group conversation.
+type CreateConversationRequest struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// RenameConversationRequest is the payload to rename a group conversation.
+type RenameConversationRequest struct {
+	ConversationID string `json:"conversation_id"`
+	Name           string `json:"name"`
+}
+
+// ConversationMembersRequest is the payload to add or remove members.
+type ConversationMembersRequest struct {
+	ConversationID string   `json:"conversation_id"`
+	Members        []string `json:"members"`
+}
+
+// ConversationRoleRequest is the payload to change a member's role.
+type ConversationRoleRequest struct {
+	ConversationID string           `json:"conversation_id"`
+	Username       string           `json:"username"`
+	Role           ConversationRole `json:"role"`
+}
+
+// LeaveConversationRequest is the payload to leave a group conversation.
+type LeaveConversationRequest struct {
+	ConversationID string `json:"conversation_id"`
+}
+
+// IsValid checks that the role can be assigned through the role endpoint.
+func (r ConversationRole) IsValid() error {
+	switch r {
+	case ConversationRoleAdmin, ConversationRoleMember:
+		return nil
+	default:
+		return errors.New("invalid role value : admin or member")
+	}
+}
+
+// Member returns the member entry for username, or nil if they are not in the conversation.
+func (c *Conversation) Member(username string) *ConversationMember {
+	for i := range c.Members {
+		if c.Members[i].Username == username {
+			return &c.Members[i]
+		}
+	}
+	return nil
+}
+
+// CanManage reports whether username is the owner or an admin of the conversation.
+func (c *Conversation) CanManage(username string) bool {
+	member := c.Member(username)
+	return member != nil && (member.Role == ConversationRoleOwner || member.Role == ConversationRoleAdmin)
+}
+
+// Usernames returns the usernames of every member.
+func (c *Conversation) Usernames() []string {
+	usernames := make([]string, 0, len(c.Members))
+	for _, member := range c.Members {
+		usernames = append(usernames, member.Username)
+	}
+	return usernames
+}
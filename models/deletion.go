@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrAccountPendingDeletion is returned when a user whose account is scheduled for deletion
+// logs in or uses an API key.
+var ErrAccountPendingDeletion = errors.New("this account is scheduled for deletion, use the link in the email to keep it")
+
+// DeletedUserPrefix starts the placeholder username that replaces a deleted user in the
+// messages kept by the anonymize policy. Usernames starting with it cannot be registered.
+const DeletedUserPrefix = "deleted-"
+
+// DeletionPolicy is what happens to the messages of a deleted account.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete removes the direct chats of the user and the messages they sent to
+	// group conversations
+	DeletionPolicyDelete DeletionPolicy = "delete"
+	// DeletionPolicyAnonymize keeps the messages for the other participants but replaces the
+	// user with a placeholder and removes their media
+	DeletionPolicyAnonymize DeletionPolicy = "anonymize"
+)
+
+// DeleteAccountRequest asks for the authorized user's account to be deleted. Code is only
+// needed when two-factor authentication is enabled.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code,omitempty"`
+}
+
+// DeleteAccountResponse tells when a scheduled account deletion will happen.
+type DeleteAccountResponse struct {
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+// RestoreAccountRequest cancels a scheduled account deletion with the token from the email.
+type RestoreAccountRequest struct {
+	Token string `json:"token"`
+}
+
+// MediaDeletion is a queued removal of an uploaded media file. Failed attempts are retried
+// at RunAt. Deletions queued by URL only, before uploads were recorded, have no PublicID and
+// are dropped without deleting anything.
+type MediaDeletion struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	PublicID     string             `bson:"public_id,omitempty"`
+	ResourceType string             `bson:"resource_type,omitempty"`
+	Attempts     int                `bson:"attempts"`
+	RunAt        time.Time          `bson:"run_at"`
+	CreatedAt    time.Time          `bson:"created_at"`
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// EventProtocolVersion is the version of the real-time event envelope sent over /ws.
+const EventProtocolVersion = 1
+
+// Server to client event types.
+const (
+	EventMessageCreated = "message.created"
+	EventMessageEdited  = "message.edited"
+	EventMessageDeleted = "message.deleted"
+	EventReceipt        = "receipt"
+	EventTyping         = "typing"
+	EventPresence       = "presence"
+	EventContactRequest = "contact.request"
+	EventExportReady    = "export.ready"
+	EventExportFailed   = "export.failed"
+	EventAck            = "ack"
+	EventError          = "error"
+	EventReady          = "ready"
+	EventResync         = "resync"
+)
+
+// Client to server command types.
+const (
+	CommandMessageSend = "message.send"
+	CommandReceipt     = "receipt"
+	CommandTyping      = "typing"
+	CommandPresence    = "presence"
+)
+
+// Event is the envelope of every message the server pushes over the WebSocket. Seq is set on
+// events that are stored for replay and increases monotonically per user.
+type Event struct {
+	Version   int         `json:"v"`
+	Type      string      `json:"type"`
+	ID        string      `json:"id"`
+	Seq       int64       `json:"seq,omitempty"`
+	Timestamp string      `json:"ts"`
+	Payload   interface{} `json:"payload,omitempty"`
+}
+
+// UserEvent is an event stored for a user so it can be replayed after a reconnect. Data
+// holds the event envelope exactly as it was sent.
+type UserEvent struct {
+	Username  string    `bson:"username"`
+	Seq       int64     `bson:"seq"`
+	Type      string    `bson:"type"`
+	Data      string    `bson:"data"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// ReadyPayload is sent once missed events have been replayed, before live events follow.
+// Seq is the latest event sequence number of the user.
+type ReadyPayload struct {
+	Seq int64 `json:"seq"`
+}
+
+// ResyncPayload is sent instead of a replay when the requested events are no longer
+// retained. The client must reload its state over REST.
+type ResyncPayload struct {
+	OldestSeq int64 `json:"oldest_seq"`
+}
+
+// Command is a request sent by the client over the WebSocket. ID is chosen by the client
+// and echoed back in the ack or error event answering the command.
+type Command struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// CommandResult is the payload of the ack and error events answering a command.
+type CommandResult struct {
+	CommandID string      `json:"command_id,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Code      string      `json:"code,omitempty"`
+}
+
+// SendMessageCommand is the payload of a message.send command. Exactly one of RecipientID
+// or ConversationID must be set.
+type SendMessageCommand struct {
+	RecipientID    string `json:"recipient_id"`
+	ConversationID string `json:"conversation_id"`
+	Content        string `json:"content"`
+}
+
+// IsValid checks that the message has a target and some content.
+func (c *SendMessageCommand) IsValid() error {
+	if (c.RecipientID == "") == (c.ConversationID == "") {
+		return errors.New("exactly one of recipient_id or conversation_id is required")
+	}
+	if c.Content == "" {
+		return errors.New("content is required")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ExportStatus is how far the building of a data export got.
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportReady   ExportStatus = "ready"
+	ExportFailed  ExportStatus = "failed"
+)
+
+// ErrExportInProgress is returned when a user asks for a data export while one is being built.
+var ErrExportInProgress = errors.New("a data export is already being prepared")
+
+// Export is an archive of a user's data. Only the hash of the download token is stored; the
+// link is sent to the user once the archive is ready.
+type Export struct {
+	ID          string       `json:"export_id" bson:"export_id"`
+	Username    string       `json:"-" bson:"username"`
+	Status      ExportStatus `json:"status" bson:"status"`
+	Error       string       `json:"error,omitempty" bson:"error,omitempty"`
+	Size        int64        `json:"size,omitempty" bson:"size,omitempty"`
+	TokenHash   string       `json:"-" bson:"token_hash,omitempty"`
+	CreatedAt   time.Time    `json:"created_at" bson:"created_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+// ExportReadyPayload is the payload of the export.ready event.
+type ExportReadyPayload struct {
+	ExportID    string    `json:"export_id"`
+	DownloadURL string    `json:"download_url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// ExportFailedPayload is the payload of the export.failed event.
+type ExportFailedPayload struct {
+	ExportID string `json:"export_id"`
+	Error    string `json:"error"`
+}
+
+// ExportProfile is the profile written to a data export: the user without the password hash.
+type ExportProfile struct {
+	*User
+	// Password shadows the hash of the embedded user, so it is left out
+	Password       string         `json:"password,omitempty"`
+	LinkedAccounts []OIDCIdentity `json:"linked_accounts,omitempty"`
+}
+
+// ExportChat is one chat of a data export: a direct chat with With, or a group conversation.
+// MediaFiles maps the media URLs of the messages to the files holding them in the archive.
+type ExportChat struct {
+	With         string            `json:"with,omitempty"`
+	Conversation *Conversation     `json:"conversation,omitempty"`
+	Messages     []*Message        `json:"messages"`
+	MediaFiles   map[string]string `json:"media_files,omitempty"`
+}
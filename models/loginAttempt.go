@@ -0,0 +1,36 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidCredentials is returned by login for an unknown username and a wrong password
+// alike, so responses do not reveal which usernames exist.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+const (
+	LoginAttemptUser = "user"
+	LoginAttemptIP   = "ip"
+)
+
+// LoginAttempt tracks recent failed logins for a username or a client IP. LockedUntil is set
+// while logins for it are locked out.
+type LoginAttempt struct {
+	Kind          string     `json:"kind" bson:"kind"` // user or ip
+	Subject       string     `json:"subject" bson:"subject"`
+	Failures      int        `json:"failures" bson:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at" bson:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty" bson:"locked_until,omitempty"`
+	ExpiresAt     time.Time  `json:"-" bson:"expires_at"`
+}
+
+// LoginThrottledError is returned while logins are locked out or backing off after failed
+// attempts. RetryAfter is how long the client has to wait.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many failed login attempts, please try again later"
+}
@@ -1,25 +1,94 @@
 package models
 
+import "errors"
+
+var ErrMessageNotFound = errors.New("message not found")
+
 type Message struct {
-	ID          string `form:"message_id" bson:"message_id"`
-	ChatID      string `form:"chat_id" bson:"chat_id"`
-	SenderID    string `form:"sender_id" bson:"sender_id"`
-	RecipientID string `form:"recipient_id" bson:"recipient_id"`
-	Content     string `form:"content" bson:"content"`
-	MediaURL    string `form:"media_url,omitempty" bson:"media_url,omitempty"`
-	Timestamp   string `json:"timestamp" bson:"timestamp"`
-	Status      string `json:"status" bson:"status"`
+	ID             string           `json:"message_id" form:"message_id" bson:"message_id"`
+	ChatID         string           `json:"chat_id" form:"chat_id" bson:"chat_id"`
+	SenderID       string           `json:"sender_id" form:"sender_id" bson:"sender_id"`
+	RecipientID    string           `json:"recipient_id,omitempty" form:"recipient_id" bson:"recipient_id"`
+	ConversationID string           `json:"conversation_id,omitempty" form:"conversation_id" bson:"conversation_id,omitempty"`
+	Content        string           `json:"content" form:"content" bson:"content"`
+	MediaURL       string           `json:"media_url,omitempty" form:"media_url,omitempty" bson:"media_url,omitempty"`
+	Media          *UploadedMedia   `json:"-" form:"-" bson:"media,omitempty"`
+	Timestamp      string           `json:"timestamp" bson:"timestamp"`
+	EditedAt       string           `json:"edited_at,omitempty" bson:"edited_at,omitempty"`
+	Status         string           `json:"status" bson:"status"`
+	Receipts       []MessageReceipt `json:"receipts,omitempty" bson:"receipts,omitempty"`
+}
+
+// UploadedMedia identifies a file the server uploaded to Cloudinary for a message. Only
+// these files are ever downloaded or deleted by the server; a media URL without it is just
+// a link.
+type UploadedMedia struct {
+	PublicID     string `bson:"public_id"`
+	ResourceType string `bson:"resource_type"`
 }
 
+const (
+	MessageStatusSent      = "sent"
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+)
+
+// MessageStatusUpdate is a delivery or read acknowledgement for a message. Clients send
+// message_id and status; the server fills in the acknowledging user and the time before
+// relaying it to the sender.
 type MessageStatusUpdate struct {
-	MessageID string `json:"message_id"`
-	Status    string `json:"status"`
+	MessageID      string `json:"message_id"`
+	Status         string `json:"status"`
+	Username       string `json:"username,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Timestamp      string `json:"timestamp,omitempty"`
+}
+
+// MessageReceipt records when a single recipient received and read a message.
+type MessageReceipt struct {
+	Username    string `json:"username" bson:"username"`
+	DeliveredAt string `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	ReadAt      string `json:"read_at,omitempty" bson:"read_at,omitempty"`
+}
+
+// IsValid checks that the acknowledgement carries a message and a receipt status.
+func (u *MessageStatusUpdate) IsValid() error {
+	if u.MessageID == "" {
+		return errors.New("message_id is required")
+	}
+	switch u.Status {
+	case MessageStatusDelivered, MessageStatusRead:
+		return nil
+	default:
+		return errors.New("invalid status value : delivered or read")
+	}
 }
 
 type GetMessage struct {
-	Content   string `json:"content" bson:"content"`
-	MediaURL  string `json:"media_url,omitempty" bson:"media_url,omitempty"`
-	Timestamp string `json:"timestamp" bson:"timestamp"`
+	ID          string           `json:"message_id" bson:"message_id"`
+	ChatID      string           `json:"chat_id" bson:"chat_id"`
+	SenderID    string           `json:"sender_id" bson:"sender_id"`
+	RecipientID string           `json:"recipient_id,omitempty" bson:"recipient_id"`
+	Content     string           `json:"content" bson:"content"`
+	MediaURL    string           `json:"media_url,omitempty" bson:"media_url,omitempty"`
+	Timestamp   string           `json:"timestamp" bson:"timestamp"`
+	EditedAt    string           `json:"edited_at,omitempty" bson:"edited_at,omitempty"`
+	Status      string           `json:"status" bson:"status"`
+	Receipts    []MessageReceipt `json:"receipts,omitempty" bson:"receipts,omitempty"`
+}
+
+// MessagePageRequest selects one page of a chat history. Before and After are opaque
+// cursors taken from a previous page's next_cursor; at most one of them may be set.
+type MessagePageRequest struct {
+	Before string
+	After  string
+	Limit  int
+}
+
+// MessagePage is one page of a chat history in chronological order.
+type MessagePage struct {
+	Messages   []*GetMessage
+	NextCursor string
 }
 
 type EditMessage struct {
@@ -36,5 +105,7 @@ type DeleteMessage struct {
 }
 
 type DeleteMessageResponse struct {
-	Messsage string `json:"message" bson:"message"`
+	Messsage       string `json:"message" bson:"message"`
+	MessageID      string `json:"message_id,omitempty" bson:"message_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty" bson:"conversation_id,omitempty"`
 }
@@ -0,0 +1,32 @@
+package models
+
+import "errors"
+
+// ErrMFASetupRequired is returned when an account that must use two-factor authentication
+// has not enrolled yet.
+var ErrMFASetupRequired = errors.New("two-factor authentication must be set up for this account")
+
+// TOTPEnrollResponse carries a new TOTP secret for the user to add to their authenticator
+// app, either typed in or scanned from OTPAuthURI as a QR code.
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// MFACodeRequest carries a code from the authenticator app, or a recovery code where noted.
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodesResponse carries recovery codes. They are shown once and only their hashes
+// are stored.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFALoginRequest completes a login that returned an MFA challenge. Code is a code from the
+// authenticator app or an unused recovery code.
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// OIDCIdentity links a user to an account at an OpenID Connect provider.
+type OIDCIdentity struct {
+	Issuer   string    `json:"issuer" bson:"issuer"`
+	Subject  string    `json:"subject" bson:"subject"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// OIDCState remembers an OIDC login between the redirect to the provider and the callback.
+// Only the hashes of the state parameter and of the browser binding are stored.
+type OIDCState struct {
+	StateHash    string    `bson:"state_hash"`
+	BindingHash  string    `bson:"binding_hash"`
+	Nonce        string    `bson:"nonce"`
+	CodeVerifier string    `bson:"code_verifier"`
+	DeviceName   string    `bson:"device_name,omitempty"`
+	CreatedAt    time.Time `bson:"created_at"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+}
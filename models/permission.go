@@ -0,0 +1,45 @@
+package models
+
+// Permission is an action a role may be allowed to perform, checked by
+// security.RequirePermission.
+type Permission string
+
+const (
+	PermissionUserDelete      Permission = "user:delete"
+	PermissionUserRoleManage  Permission = "user:role"
+	PermissionMessageModerate Permission = "message:moderate"
+	PermissionLockoutManage   Permission = "lockout:manage"
+	PermissionAuditRead       Permission = "audit:read"
+	PermissionUserRead        Permission = "user:read"
+	PermissionUserSuspend     Permission = "user:suspend"
+	PermissionUserSessions    Permission = "user:sessions"
+	PermissionUserPassword    Permission = "user:password"
+	PermissionStatsRead       Permission = "stats:read"
+)
+
+// RolePermissions maps each role to the permissions it grants.
+var RolePermissions = map[Role][]Permission{
+	Admin: {
+		PermissionUserDelete,
+		PermissionUserRoleManage,
+		PermissionMessageModerate,
+		PermissionLockoutManage,
+		PermissionAuditRead,
+		PermissionUserRead,
+		PermissionUserSuspend,
+		PermissionUserSessions,
+		PermissionUserPassword,
+		PermissionStatsRead,
+	},
+	Client: {},
+}
+
+// HasPermission reports whether the role grants permission.
+func (r Role) HasPermission(permission Permission) bool {
+	for _, granted := range RolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package models
+
+import "errors"
+
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+const (
+	TypingStart = "start"
+	TypingStop  = "stop"
+)
+
+// PresencePayload is the payload of a presence event. LastSeen is set when the user goes offline.
+type PresencePayload struct {
+	Username string `json:"username"`
+	Status   string `json:"status"`
+	LastSeen string `json:"last_seen,omitempty"`
+}
+
+// PresenceCommand is the payload of a presence command, sent by the client to mark the user
+// as away or back online.
+type PresenceCommand struct {
+	Status string `json:"status"`
+}
+
+// IsValid checks that the status can be set by the client.
+func (c *PresenceCommand) IsValid() error {
+	switch c.Status {
+	case PresenceOnline, PresenceAway:
+		return nil
+	default:
+		return errors.New("invalid status value : online or away")
+	}
+}
+
+// TypingCommand is the payload of a typing command. Exactly one of RecipientID or
+// ConversationID must be set.
+type TypingCommand struct {
+	RecipientID    string `json:"recipient_id"`
+	ConversationID string `json:"conversation_id"`
+	State          string `json:"state"`
+}
+
+// IsValid checks that the command has a target and a typing state.
+func (c *TypingCommand) IsValid() error {
+	if (c.RecipientID == "") == (c.ConversationID == "") {
+		return errors.New("exactly one of recipient_id or conversation_id is required")
+	}
+	switch c.State {
+	case TypingStart, TypingStop:
+		return nil
+	default:
+		return errors.New("invalid state value : start or stop")
+	}
+}
+
+// TypingPayload is the payload of a typing event. ConversationID is set for group conversations.
+type TypingPayload struct {
+	Username       string `json:"username"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	State          string `json:"state"`
+}
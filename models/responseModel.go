@@ -6,17 +6,69 @@ import (
 )
 
 type GenericResponse struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
-	Status  bool        `json:status`
+	Message    string      `json:"message"`
+	Data       interface{} `json:"data"`
+	Status     bool        `json:status`
+	Code       string      `json:"code,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// Machine readable error codes returned in the code field of failed responses.
+const (
+	ErrorCodeContactBlocked   = "contact_blocked"
+	ErrorCodeEmailNotVerified = "email_not_verified"
+	ErrorCodeMFASetupRequired = "mfa_setup_required"
+	ErrorCodeAccountSuspended = "account_suspended"
+	ErrorCodePendingDeletion  = "account_pending_deletion"
+)
+
+// ErrorCode returns the error code for errors clients are expected to handle, or "".
+func ErrorCode(err error) string {
+	switch err {
+	case ErrContactBlocked:
+		return ErrorCodeContactBlocked
+	case ErrEmailNotVerified:
+		return ErrorCodeEmailNotVerified
+	case ErrMFASetupRequired:
+		return ErrorCodeMFASetupRequired
+	case ErrAccountSuspended:
+		return ErrorCodeAccountSuspended
+	case ErrAccountPendingDeletion:
+		return ErrorCodePendingDeletion
+	default:
+		return ""
+	}
 }
 
 func ManageResponse(w http.ResponseWriter, String string, code int, data interface{}, status bool) {
-	response := GenericResponse{
+	writeResponse(w, code, GenericResponse{
 		Message: String,
 		Data:    data,
 		Status:  status,
-	}
+	})
+}
+
+// ManageErrorResponse writes a failed response carrying a machine readable error code.
+func ManageErrorResponse(w http.ResponseWriter, String string, code int, errorCode string) {
+	writeResponse(w, code, GenericResponse{
+		Message: String,
+		Status:  false,
+		Code:    errorCode,
+	})
+}
+
+// ManagePaginatedResponse writes a successful response carrying one page of data and the
+// cursor for the following page. An empty nextCursor means there are no more pages.
+func ManagePaginatedResponse(w http.ResponseWriter, String string, code int, data interface{}, nextCursor string) {
+	writeResponse(w, code, GenericResponse{
+		Message:    String,
+		Data:       data,
+		Status:     true,
+		NextCursor: nextCursor,
+	})
+}
+
+func writeResponse(w http.ResponseWriter, code int, response GenericResponse) {
 	beautifiedJSON, err := json.MarshalIndent(response, "", "  ")
 	if err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -2,7 +2,9 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -12,6 +14,7 @@ type User struct {
 	ID            primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	Username      string             `json:"username" bson:"username" `
 	Email         string             `json:"email" bson:"email" `
+	EmailVerified bool               `json:"email_verified" bson:"email_verified"`
 	Password      string             `json:"password" bson:"password" `
 	AvatarURL     string             `json:"avatar_url" bson:"avatar_url"`
 	StatusMessage string             `json:"status_message" bson:"status_message"`
@@ -22,6 +25,37 @@ type User struct {
 	DateOfBirth   string             `json:"date_of_birth" bson:"date_of_birth"`
 	Role          Role               `json:"role" bson:"role"`
 	Profile       Profile            `json:"profile" bson:"profile"`
+
+	// Type is bot for bot accounts, which only authenticate with API keys, and BotOwner the
+	// user who manages the bot
+	Type     UserType `json:"type,omitempty" bson:"type,omitempty"`
+	BotOwner string   `json:"bot_owner,omitempty" bson:"bot_owner,omitempty"`
+
+	// A suspended user cannot log in or use existing tokens and API keys until an admin
+	// lifts the suspension
+	Suspended     bool       `json:"suspended" bson:"suspended,omitempty"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty" bson:"suspended_at,omitempty"`
+	SuspendedBy   string     `json:"suspended_by,omitempty" bson:"suspended_by,omitempty"`
+	SuspendReason string     `json:"suspend_reason,omitempty" bson:"suspend_reason,omitempty"`
+
+	// DeletionScheduledAt is when the account will be deleted after the user asked for it to
+	// be; until then it can be restored with the link emailed to the user
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty" bson:"deletion_scheduled_at,omitempty"`
+
+	// VerificationSentAt is when the last verification email was sent, for throttling resends
+	VerificationSentAt *time.Time `json:"-" bson:"verification_sent_at,omitempty"`
+
+	// Two-factor authentication. PendingTOTPSecret holds a secret until the user confirms it
+	// with a code, TOTPLastStep the time step of the last accepted code so it cannot be
+	// reused, and RecoveryCodes the hashes of the unused recovery codes.
+	TOTPEnabled       bool     `json:"totp_enabled" bson:"totp_enabled"`
+	TOTPSecret        string   `json:"-" bson:"totp_secret,omitempty"`
+	PendingTOTPSecret string   `json:"-" bson:"pending_totp_secret,omitempty"`
+	TOTPLastStep      int64    `json:"-" bson:"totp_last_step,omitempty"`
+	RecoveryCodes     []string `json:"-" bson:"recovery_codes,omitempty"`
+
+	// OIDCIdentities are the accounts at OpenID Connect providers the user logs in with
+	OIDCIdentities []OIDCIdentity `json:"-" bson:"oidc_identities,omitempty"`
 }
 
 type Profile struct {
@@ -43,35 +77,82 @@ type UpdateUserAndProfile struct {
 	Password      string  `json:"password" bson:"password" `
 	AvatarURL     string  `json:"avatar_url" bson:"avatar_url"`
 	StatusMessage string  `json:"status_message" bson:"status_message"`
-	LastSeen      string  `json:"last_seen" bson:"last_seen"`
 	FirstName     string  `json:"first_name" bson:"first_name"`
 	LastName      string  `json:"last_name" bson:"last_name"`
 	Address       string  `json:"address" bson:"address,omitempty"`
 	DateOfBirth   string  `json:"date_of_birth" bson:"date_of_birth"`
-	Role          Role    `json:"role" bson:"role"`
 	Profile       Profile `json:"profile" bson:"profile"`
 }
 type UserResponse struct {
-	Username    string  `json:"username" bson:"username" `
-	Email       string  `json:"email" bson:"email" `
-	FirstName   string  `json:"first_name" bson:"first_name"`
-	LastName    string  `json:"last_name" bson:"last_name"`
-	Address     string  `json:"address" bson:"address,omitempty"`
-	DateOfBirth string  `json:"date_of_birth" bson:"date_of_birth"`
-	Profile     Profile `json:"profile" bson:"profile"`
+	Username      string   `json:"username" bson:"username" `
+	Email         string   `json:"email" bson:"email" `
+	EmailVerified bool     `json:"email_verified" bson:"email_verified"`
+	TOTPEnabled   bool     `json:"totp_enabled" bson:"totp_enabled"`
+	Type          UserType `json:"type,omitempty" bson:"type,omitempty"`
+	FirstName     string   `json:"first_name" bson:"first_name"`
+	LastName      string   `json:"last_name" bson:"last_name"`
+	Address       string   `json:"address" bson:"address,omitempty"`
+	DateOfBirth   string   `json:"date_of_birth" bson:"date_of_birth"`
+	Profile       Profile  `json:"profile" bson:"profile"`
 }
 
 type LoginUser struct {
-	Username string `json:"username" bson:"username" `
-	Password string `json:"password" bson:"password" `
+	Username   string `json:"username" bson:"username" `
+	Password   string `json:"password" bson:"password" `
+	DeviceName string `json:"device_name,omitempty" bson:"device_name,omitempty"`
 }
 
 type LoginResponse struct {
 	Username     string `json:"username" bson:"username" `
-	Token        string `json:"token" bson:"token" `
-	RefreshToken string `json:"refreshtoken" bson:"refreshtoken" `
+	Token        string `json:"token,omitempty" bson:"token" `
+	RefreshToken string `json:"refreshtoken,omitempty" bson:"refreshtoken" `
+
+	// Set instead of the tokens when the user has to complete two-factor authentication
+	// at /auth/login/2fa
+	MFARequired  bool   `json:"mfa_required,omitempty" bson:"-"`
+	MFAToken     string `json:"mfa_token,omitempty" bson:"-"`
+	MFAExpiresIn int    `json:"mfa_expires_in,omitempty" bson:"-"`
+}
+
+// JwtSession is a login session of one device, stored in the jwt store. Every token issued
+// for it carries SessionID in the "sid" claim. UsedRefreshTokens holds the hashes of the
+// latest refresh tokens that were already exchanged, so a replayed one revokes the session
+// while other stale or unknown ones are only rejected.
+type JwtSession struct {
+	SessionID         string    `json:"session_id" bson:"session_id"`
+	Username          string    `json:"-" bson:"username"`
+	Token             string    `json:"-" bson:"token"`
+	RefreshToken      string    `json:"-" bson:"refreshtoken"`
+	UsedRefreshTokens []string  `json:"-" bson:"used_refresh_tokens"`
+	DeviceName        string    `json:"device_name" bson:"device_name"`
+	IP                string    `json:"ip" bson:"ip"`
+	UserAgent         string    `json:"user_agent" bson:"user_agent"`
+	CreatedAt         time.Time `json:"created_at" bson:"created_at"`
+	LastUsedAt        time.Time `json:"last_used_at" bson:"last_used_at"`
+	Current           bool      `json:"current" bson:"-"`
+}
+
+// RefreshTokenRequest is the payload to exchange a refresh token for a new token pair.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
+// WebSocketTicketResponse is a short-lived credential for the /ws handshake.
+type WebSocketTicketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+// ErrEmailNotVerified is returned for actions that require a verified email address.
+var ErrEmailNotVerified = errors.New("please verify your email address first")
+
+// Actions that can be restricted until the user verifies their email address, configured
+// with EMAIL_VERIFICATION_REQUIRED_FOR.
+const (
+	VerifiedActionMessage = "message"
+	VerifiedActionContact = "contact"
+)
+
 type Role string
 
 const (
@@ -79,6 +160,17 @@ const (
 	Client Role = "CLIENT"
 )
 
+// RoleChangeRequest assigns a new role to a user.
+type RoleChangeRequest struct {
+	Role Role `json:"role"`
+}
+
+// ErrLastAdmin is returned when a change would leave no ADMIN account.
+var ErrLastAdmin = errors.New("the last ADMIN cannot be demoted")
+
+// ErrAccountSuspended is returned when a suspended user logs in or uses a token or API key.
+var ErrAccountSuspended = errors.New("this account is suspended")
+
 func (r *Role) UnmarshalJSON(data []byte) error {
 	var roleStr string
 	if err := json.Unmarshal(data, &roleStr); err != nil {
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeAccountRestore    = "account_restore"
+	TokenPurposeWebSocketTicket   = "ws_ticket"
+)
+
+// UserToken is a single-use token emailed to a user, or the ID of a WebSocket ticket. Only the hash of the token is stored.
+type UserToken struct {
+	TokenHash string    `json:"-" bson:"token_hash"`
+	Username  string    `json:"username" bson:"username"`
+	Purpose   string    `json:"purpose" bson:"purpose"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// ForgotPasswordRequest asks for a password reset link to be emailed.
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest sets a new password with a token from a reset link.
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
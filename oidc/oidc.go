@@ -0,0 +1,442 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"real-time-chat-app/logger"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// metadataTTL is how long the discovery document and signing keys are cached.
+	metadataTTL = time.Hour
+	// keysRefreshInterval is the least time between two fetches of the signing keys when an
+	// ID token names an unknown key, so rotated keys are picked up without letting tokens
+	// trigger a fetch each.
+	keysRefreshInterval = time.Minute
+	// maxResponseSize bounds what is read from the provider.
+	maxResponseSize = 1 << 20
+)
+
+// Config describes the OpenID Connect provider users can log in with.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Default is the provider used by the services, set by Init. It is nil when OIDC login is
+// not configured.
+var Default *Provider
+
+// Init configures the provider from OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET,
+// OIDC_REDIRECT_URL and OIDC_SCOPES. OIDC login stays disabled when OIDC_ISSUER is not set.
+// The discovery document is only fetched on the first login, so the provider being down does
+// not stop the server from starting.
+func Init() error {
+	issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	if issuer == "" {
+		Default = nil
+		return nil
+	}
+	config := Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv("OIDC_SCOPES"), ",", " ")),
+	}
+	if config.ClientID == "" {
+		return errors.New("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+	}
+	if config.RedirectURL == "" {
+		config.RedirectURL = "http://localhost" + os.Getenv("PORT") + "/auth/oidc/callback"
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	Default = NewProvider(config)
+	logger.LogInfo("OIDC login enabled for issuer " + issuer)
+	return nil
+}
+
+// Metadata is the part of the provider's discovery document that is used.
+type Metadata struct {
+	Issuer                   string   `json:"issuer"`
+	AuthorizationEndpoint    string   `json:"authorization_endpoint"`
+	TokenEndpoint            string   `json:"token_endpoint"`
+	JWKSURI                  string   `json:"jwks_uri"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// IDToken holds the verified claims of an ID token.
+type IDToken struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	GivenName         string
+	FamilyName        string
+}
+
+// Provider logs users in with the authorization code flow and PKCE.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *Metadata
+	metadataAt    time.Time
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewProvider returns a provider for config.
+func NewProvider(config Config) *Provider {
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Issuer returns the issuer identifier of the provider.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// AuthCodeURL returns where to send the user to log in. state is returned to the callback
+// unchanged, nonce is echoed in the ID token and codeChallenge is the S256 challenge of the
+// code verifier later passed to Exchange.
+func (p *Provider) AuthCodeURL(state string, nonce string, codeChallenge string) (string, error) {
+	metadata, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems the authorization code at the token endpoint and returns the verified ID
+// token, which must carry nonce.
+func (p *Provider) Exchange(code string, codeVerifier string, nonce string) (*IDToken, error) {
+	metadata, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	secretInBody := p.config.ClientSecret != "" && len(metadata.TokenEndpointAuthMethods) > 0 &&
+		!contains(metadata.TokenEndpointAuthMethods, "client_secret_basic") &&
+		contains(metadata.TokenEndpointAuthMethods, "client_secret_post")
+	if secretInBody {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+	request, err := http.NewRequest(http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" && !secretInBody {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(request, &token)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned %d %s %s", status, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return p.verifyIDToken(token.IDToken, nonce)
+}
+
+// verifyIDToken checks the signature of the ID token against the provider's keys and its
+// issuer, audience, expiry and nonce.
+func (p *Provider) verifyIDToken(rawIDToken string, nonce string) (*IDToken, error) {
+	parser := &jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}}
+	token, err := parser.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(kid)
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid id_token: %v", err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	// The configured issuer has no trailing slash, while providers such as Auth0 use one
+	if issuer, _ := claims["iss"].(string); strings.TrimSuffix(issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("id_token issued by %q", issuer)
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, errors.New("id_token not issued for this client")
+	}
+	if audiences, ok := claims["aud"].([]interface{}); ok && len(audiences) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.config.ClientID {
+			return nil, errors.New("id_token authorized party mismatch")
+		}
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("id_token has no expiry")
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce == "" || tokenNonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	idToken := &IDToken{Issuer: p.config.Issuer}
+	idToken.Subject, _ = claims["sub"].(string)
+	idToken.Email, _ = claims["email"].(string)
+	idToken.PreferredUsername, _ = claims["preferred_username"].(string)
+	idToken.GivenName, _ = claims["given_name"].(string)
+	idToken.FamilyName, _ = claims["family_name"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		idToken.EmailVerified = verified
+	case string:
+		// Some providers send the claim as a string
+		idToken.EmailVerified = verified == "true"
+	}
+	if idToken.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+	return idToken, nil
+}
+
+// discover returns the provider's discovery document, fetching it when the cached copy is
+// missing or stale.
+func (p *Provider) discover() (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil && time.Since(p.metadataAt) < metadataTTL {
+		return p.metadata, nil
+	}
+
+	request, err := http.NewRequest(http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var metadata Metadata
+	status, err := p.doJSON(request, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery returned %d", status)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q", metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+	p.metadata = &metadata
+	p.metadataAt = time.Now()
+	return p.metadata, nil
+}
+
+// key returns the provider's public key kid, fetching the keys again when it is not known.
+func (p *Provider) key(kid string) (interface{}, error) {
+	metadata, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key, ok := p.lookupKey(kid)
+	stale := time.Since(p.keysFetchedAt) > metadataTTL
+	if ok && !stale {
+		return key, nil
+	}
+	if !stale && time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	status, err := p.doJSON(request, &set)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("fetching signing keys: %d %v", status, err)
+	}
+	keys := make(map[string]interface{})
+	for _, raw := range set.Keys {
+		id, publicKey, err := parseJWK(raw)
+		if err != nil {
+			// Skip keys that are not for signatures or of an unsupported type
+			continue
+		}
+		keys[id] = publicKey
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		// Providers with a single key may leave out the kid
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) doJSON(request *http.Request, v interface{}) (int, error) {
+	response, err := p.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return response.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return response.StatusCode, fmt.Errorf("decoding response: %w", err)
+	}
+	return response.StatusCode, nil
+}
+
+// parseJWK returns the kid and public key of a JSON Web Key.
+func parseJWK(raw json.RawMessage) (string, interface{}, error) {
+	var jwk struct {
+		KeyType string `json:"kty"`
+		KeyID   string `json:"kid"`
+		Use     string `json:"use"`
+		N       string `json:"n"`
+		E       string `json:"e"`
+		Curve   string `json:"crv"`
+		X       string `json:"x"`
+		Y       string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", nil, errors.New("not a signing key")
+	}
+
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.KeyID, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return "", nil, errors.New("unsupported curve " + jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.KeyID, &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return "", nil, errors.New("unsupported curve " + jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return "", nil, errors.New("invalid Ed25519 key")
+		}
+		return jwk.KeyID, ed25519.PublicKey(x), nil
+	}
+	return "", nil, errors.New("unsupported key type " + jwk.KeyType)
+}
+
+// NewCodeVerifier returns a random PKCE code verifier, also used for state and nonce values.
+func NewCodeVerifier() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge of verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
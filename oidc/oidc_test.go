@@ -0,0 +1,147 @@
+package oidc_test
+
+import (
+	"net/url"
+	"real-time-chat-app/oidc"
+	"real-time-chat-app/oidc/oidctest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func newTestProvider(t *testing.T, trailingSlash bool) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+	mock := oidctest.NewProvider(t, "chat-app", "client-secret")
+	mock.TrailingSlash = trailingSlash
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       mock.URL(),
+		ClientID:     "chat-app",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:8081/auth/oidc/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	})
+	return mock, provider
+}
+
+// authorize starts a login and returns the code the mock provider redirects back with,
+// along with the code verifier and nonce the client kept.
+func authorize(t *testing.T, mock *oidctest.Provider, provider *oidc.Provider, claims jwt.MapClaims) (string, string, string) {
+	t.Helper()
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatalf("NewCodeVerifier: %v", err)
+	}
+	nonce, _ := oidc.NewCodeVerifier()
+	authURL, err := provider.AuthCodeURL("the-state", nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, state, err := mock.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if state != "the-state" {
+		t.Fatalf("state %q was not passed to the provider", state)
+	}
+	return code, verifier, nonce
+}
+
+func TestExchange(t *testing.T) {
+	for _, trailingSlash := range []bool{false, true} {
+		name := "issuer without trailing slash"
+		if trailingSlash {
+			name = "issuer with trailing slash"
+		}
+		t.Run(name, func(t *testing.T) {
+			mock, provider := newTestProvider(t, trailingSlash)
+			code, verifier, nonce := authorize(t, mock, provider, jwt.MapClaims{
+				"sub":                "user-42",
+				"email":              "jane@example.com",
+				"email_verified":     true,
+				"preferred_username": "jane",
+			})
+
+			idToken, err := provider.Exchange(code, verifier, nonce)
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if idToken.Subject != "user-42" || idToken.Email != "jane@example.com" || !idToken.EmailVerified || idToken.PreferredUsername != "jane" {
+				t.Fatalf("unexpected ID token %+v", idToken)
+			}
+			if idToken.Issuer != provider.Issuer() {
+				t.Fatalf("ID token issuer %q, want the configured %q", idToken.Issuer, provider.Issuer())
+			}
+			if discovery, keys := mock.Requests(); discovery != 1 || keys != 1 {
+				t.Fatalf("fetched discovery %d and keys %d times, want once each", discovery, keys)
+			}
+
+			// The metadata and keys are cached for the next login
+			code, verifier, nonce = authorize(t, mock, provider, jwt.MapClaims{"sub": "user-43"})
+			if _, err := provider.Exchange(code, verifier, nonce); err != nil {
+				t.Fatalf("second Exchange: %v", err)
+			}
+			if discovery, keys := mock.Requests(); discovery != 1 || keys != 1 {
+				t.Fatalf("fetched discovery %d and keys %d times after two logins, want once each", discovery, keys)
+			}
+		})
+	}
+}
+
+func TestAuthCodeURLUsesPKCE(t *testing.T) {
+	mock, provider := newTestProvider(t, false)
+	authURL, err := provider.AuthCodeURL("state", "nonce", oidc.CodeChallenge("verifier"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if !strings.HasPrefix(authURL, mock.URL()+"/authorize?") {
+		t.Fatalf("AuthCodeURL %q does not use the discovered endpoint", authURL)
+	}
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") != oidc.CodeChallenge("verifier") {
+		t.Fatalf("AuthCodeURL %q has no S256 challenge", authURL)
+	}
+	if query.Get("nonce") != "nonce" || query.Get("scope") != "openid email profile" {
+		t.Fatalf("AuthCodeURL %q has wrong nonce or scope", authURL)
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	mock, provider := newTestProvider(t, false)
+	code, _, nonce := authorize(t, mock, provider, nil)
+	other, _ := oidc.NewCodeVerifier()
+	if _, err := provider.Exchange(code, other, nonce); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("Exchange with another code verifier returned %v, want invalid_grant", err)
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	mock, provider := newTestProvider(t, false)
+	code, verifier, _ := authorize(t, mock, provider, nil)
+	if _, err := provider.Exchange(code, verifier, "another-nonce"); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("Exchange with another nonce returned %v, want a nonce mismatch", err)
+	}
+
+	code, verifier, nonce := authorize(t, mock, provider, jwt.MapClaims{"nonce": nil})
+	if _, err := provider.Exchange(code, verifier, nonce); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("Exchange of an ID token without nonce returned %v, want a nonce mismatch", err)
+	}
+}
+
+func TestExchangeRejectsForeignTokens(t *testing.T) {
+	cases := map[string]jwt.MapClaims{
+		"other issuer":   {"iss": "https://attacker.example.com/"},
+		"other audience": {"aud": "another-client"},
+		"no subject":     {"sub": ""},
+	}
+	for name, claims := range cases {
+		t.Run(name, func(t *testing.T) {
+			mock, provider := newTestProvider(t, true)
+			code, verifier, nonce := authorize(t, mock, provider, claims)
+			if idToken, err := provider.Exchange(code, verifier, nonce); err == nil {
+				t.Fatalf("Exchange accepted %+v", idToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// Package oidctest is a mock OpenID Connect provider for tests. It serves the discovery
+// document, its signing keys and a token endpoint that checks the PKCE code verifier, and
+// issues ID tokens with the claims a test asks for.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const keyID = "oidctest-key"
+
+// Provider is a running mock provider. Its issuer is the URL of the server, with a trailing
+// slash when TrailingSlash is set, as some providers such as Auth0 have.
+type Provider struct {
+	ClientID      string
+	ClientSecret  string
+	TrailingSlash bool
+
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu                sync.Mutex
+	grants            map[string]*grant
+	discoveryRequests int
+	keysRequests      int
+}
+
+// grant is an authorization code waiting to be redeemed.
+type grant struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+// NewProvider starts a provider for the client, stopped when the test ends.
+func NewProvider(t *testing.T, clientID string, clientSecret string) *Provider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("oidctest: generating key: %v", err)
+	}
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		grants:       make(map[string]*grant),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.serveDiscovery)
+	mux.HandleFunc("/jwks", p.serveKeys)
+	mux.HandleFunc("/token", p.serveToken)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// URL returns the base URL of the provider, the issuer to configure.
+func (p *Provider) URL() string {
+	return p.server.URL
+}
+
+// Issuer returns the issuer the provider puts in its discovery document and ID tokens.
+func (p *Provider) Issuer() string {
+	if p.TrailingSlash {
+		return p.server.URL + "/"
+	}
+	return p.server.URL
+}
+
+// Requests returns how often the discovery document and the signing keys were fetched.
+func (p *Provider) Requests() (discovery int, keys int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.discoveryRequests, p.keysRequests
+}
+
+// Authorize plays the user logging in at the authorization URL a client redirected to. It
+// returns the code and state the provider would redirect back with. The ID token issued for
+// the code carries claims, which can override the standard claims such as "nonce" or "iss".
+func (p *Provider) Authorize(authURL string, claims jwt.MapClaims) (code string, state string, err error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+	switch {
+	case query.Get("response_type") != "code":
+		return "", "", errors.New("oidctest: response_type must be code")
+	case query.Get("client_id") != p.ClientID:
+		return "", "", errors.New("oidctest: unknown client_id " + query.Get("client_id"))
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		return "", "", errors.New("oidctest: an S256 code_challenge is required")
+	}
+
+	code = randomString()
+	p.mu.Lock()
+	p.grants[code] = &grant{
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		redirectURI: query.Get("redirect_uri"),
+		claims:      claims,
+	}
+	p.mu.Unlock()
+	return code, query.Get("state"), nil
+}
+
+func (p *Provider) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.discoveryRequests++
+	p.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"jwks_uri":                              p.server.URL + "/jwks",
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+	})
+}
+
+func (p *Provider) serveKeys(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.keysRequests++
+	p.mu.Unlock()
+	public := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *Provider) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	grant := p.grants[code]
+	// Codes are single use
+	delete(p.grants, code)
+	p.mu.Unlock()
+	if r.PostForm.Get("grant_type") != "authorization_code" || grant == nil ||
+		r.PostForm.Get("redirect_uri") != grant.redirectURI {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   p.Issuer(),
+		"aud":   p.ClientID,
+		"sub":   "subject-1",
+		"nonce": grant.nonce,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+	}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
@@ -0,0 +1,215 @@
+package repo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListUsers returns one page of the users matching query, ordered by username.
+func ListUsers(query *models.AdminUserQuery) (*models.AdminUserPage, error) {
+	logger.LogInfo("ListUsers repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if query.Search != "" {
+		pattern := containsPattern(query.Search)
+		filter["$or"] = []bson.M{
+			{"username": pattern},
+			{"email": pattern},
+			{"first_name": pattern},
+			{"last_name": pattern},
+		}
+	}
+	if query.Role != "" {
+		filter["role"] = query.Role
+	}
+	switch query.Type {
+	case models.UserTypeBot:
+		filter["type"] = models.UserTypeBot
+	case models.UserTypePerson:
+		filter["type"] = bson.M{"$ne": models.UserTypeBot}
+	}
+	if query.Suspended != nil {
+		if *query.Suspended {
+			filter["suspended"] = true
+		} else {
+			filter["suspended"] = bson.M{"$ne": true}
+		}
+	}
+	if query.Cursor != "" {
+		after, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil || len(after) == 0 {
+			return nil, errors.New("invalid cursor")
+		}
+		filter["username"] = bson.M{"$gt": string(after)}
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "username", Value: 1}}).
+		SetLimit(int64(query.Limit + 1))
+	cursor, err := userCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.LogError("ListUsers repo :: error " + err.Error())
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []*models.AdminUserSummary{}
+	if err := cursor.All(ctx, &users); err != nil {
+		logger.LogError("ListUsers repo :: error decoding " + err.Error())
+		return nil, err
+	}
+
+	page := &models.AdminUserPage{Users: users}
+	if len(users) > query.Limit {
+		page.Users = users[:query.Limit]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(page.Users[query.Limit-1].Username))
+	}
+	logger.LogInfo("ListUsers repo :: ended")
+	return page, nil
+}
+
+// containsPattern matches text anywhere in a field, ignoring case. text is matched literally.
+func containsPattern(text string) bson.M {
+	return bson.M{"$regex": regexp.QuoteMeta(text), "$options": "i"}
+}
+
+// SetUserSuspended suspends or unsuspends the user. by and reason are kept on the user while
+// suspended.
+func SetUserSuspended(username string, suspended bool, by string, reason string) error {
+	logger.LogInfo("SetUserSuspended repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$unset": bson.M{"suspended": "", "suspended_at": "", "suspended_by": "", "suspend_reason": ""}}
+	if suspended {
+		set := bson.M{"suspended": true, "suspended_at": time.Now().UTC(), "suspended_by": by}
+		if reason != "" {
+			set["suspend_reason"] = reason
+		}
+		update = bson.M{"$set": set}
+	}
+	result, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, update)
+	if err != nil {
+		logger.LogError("SetUserSuspended repo :: " + err.Error())
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+	logger.LogInfo("SetUserSuspended repo :: ended")
+	return nil
+}
+
+// CheckAccountActive returns models.ErrAccountSuspended when the user is suspended and
+// models.ErrAccountPendingDeletion when their account is scheduled for deletion, as neither
+// may use their tokens.
+func CheckAccountActive(username string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user struct {
+		Suspended           bool       `bson:"suspended"`
+		DeletionScheduledAt *time.Time `bson:"deletion_scheduled_at"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"suspended": 1, "deletion_scheduled_at": 1})
+	err := userCollection.FindOne(ctx, bson.M{"username": username}, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return errors.New("user not found")
+	}
+	if err != nil {
+		logger.LogError("CheckAccountActive repo :: " + err.Error())
+		return err
+	}
+	if user.Suspended {
+		return models.ErrAccountSuspended
+	}
+	if user.DeletionScheduledAt != nil {
+		return models.ErrAccountPendingDeletion
+	}
+	return nil
+}
+
+// GetUserStats returns the user counts of the admin statistics.
+func GetUserStats() (*models.AdminStats, error) {
+	logger.LogInfo("GetUserStats repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stats := &models.AdminStats{UsersByRole: map[models.Role]int64{}}
+	counts := []struct {
+		filter bson.M
+		dest   *int64
+	}{
+		{bson.M{}, &stats.Users},
+		{bson.M{"type": models.UserTypeBot}, &stats.Bots},
+		{bson.M{"suspended": true}, &stats.SuspendedUsers},
+	}
+	for _, count := range counts {
+		n, err := userCollection.CountDocuments(ctx, count.filter)
+		if err != nil {
+			logger.LogError("GetUserStats repo :: " + err.Error())
+			return nil, err
+		}
+		*count.dest = n
+	}
+
+	cursor, err := userCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$role", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		logger.LogError("GetUserStats repo :: " + err.Error())
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var roles []struct {
+		Role  models.Role `bson:"_id"`
+		Count int64       `bson:"count"`
+	}
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		stats.UsersByRole[role.Role] = role.Count
+	}
+	logger.LogInfo("GetUserStats repo :: ended")
+	return stats, nil
+}
+
+// GetMessagesPerDay returns how many messages were sent on each UTC day since since, oldest
+// first. Days without messages are left out.
+func GetMessagesPerDay(since time.Time) ([]models.DailyMessageCount, error) {
+	logger.LogInfo("GetMessagesPerDay repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Timestamps are stored as RFC 3339 strings in UTC, so they sort and slice by day as text
+	cursor, err := messageCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"timestamp": bson.M{"$gte": since.UTC().Format(time.RFC3339)}}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"$substrBytes": bson.A{"$timestamp", 0, 10}}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		logger.LogError("GetMessagesPerDay repo :: " + err.Error())
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	days := []models.DailyMessageCount{}
+	if err := cursor.All(ctx, &days); err != nil {
+		logger.LogError("GetMessagesPerDay repo :: error decoding " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("GetMessagesPerDay repo :: ended")
+	return days, nil
+}
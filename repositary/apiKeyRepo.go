@@ -0,0 +1,176 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InsertAPIKey stores a new API key.
+func InsertAPIKey(key *models.APIKey) error {
+	logger.LogInfo("InsertAPIKey repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := apiKeyCollection.InsertOne(ctx, key)
+	if err != nil {
+		logger.LogError("InsertAPIKey repo :: error " + err.Error())
+		return errors.New("error storing api key")
+	}
+	logger.LogInfo("InsertAPIKey repo :: ended")
+	return nil
+}
+
+// FetchAPIKey returns the API key with the given ID.
+func FetchAPIKey(keyID string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var key models.APIKey
+	err := apiKeyCollection.FindOne(ctx, bson.M{"key_id": keyID}).Decode(&key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("api key not found")
+		}
+		logger.LogError("FetchAPIKey repo :: error " + err.Error())
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetAPIKeysCreatedBy returns the API keys the user created for themselves and their bots,
+// newest first.
+func GetAPIKeysCreatedBy(username string) ([]*models.APIKey, error) {
+	logger.LogInfo("GetAPIKeysCreatedBy repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := apiKeyCollection.Find(ctx, bson.M{"created_by": username}, findOptions)
+	if err != nil {
+		logger.LogError("GetAPIKeysCreatedBy repo :: error " + err.Error())
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []*models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		logger.LogError("GetAPIKeysCreatedBy repo :: error decoding " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("GetAPIKeysCreatedBy repo :: ended")
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the key if createdBy created it and returns it.
+func RevokeAPIKey(keyID string, createdBy string) (*models.APIKey, error) {
+	logger.LogInfo("RevokeAPIKey repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"key_id": keyID, "created_by": createdBy, "revoked_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var key models.APIKey
+	err := apiKeyCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			logger.LogError("RevokeAPIKey repo :: no active key " + keyID + " for " + createdBy)
+			return nil, errors.New("api key not found")
+		}
+		logger.LogError("RevokeAPIKey repo :: error " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("RevokeAPIKey repo :: ended")
+	return &key, nil
+}
+
+// RevokeAPIKeysForUser revokes every active key acting as the user and returns their IDs.
+func RevokeAPIKeysForUser(username string) ([]string, error) {
+	logger.LogInfo("RevokeAPIKeysForUser repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"username": username, "revoked_at": bson.M{"$exists": false}}
+	cursor, err := apiKeyCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"key_id": 1}))
+	if err != nil {
+		logger.LogError("RevokeAPIKeysForUser repo :: error " + err.Error())
+		return nil, err
+	}
+	var keys []models.APIKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, key.KeyID)
+	}
+
+	_, err = apiKeyCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now().UTC()}})
+	if err != nil {
+		logger.LogError("RevokeAPIKeysForUser repo :: error " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("RevokeAPIKeysForUser repo :: ended")
+	return ids, nil
+}
+
+// TouchAPIKey records that the key was just used.
+func TouchAPIKey(keyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := apiKeyCollection.UpdateOne(ctx, bson.M{"key_id": keyID}, bson.M{"$set": bson.M{"last_used_at": time.Now().UTC()}})
+	return err
+}
+
+// GetBotsOwnedBy returns the bot accounts the user manages.
+func GetBotsOwnedBy(owner string) ([]*models.BotResponse, error) {
+	logger.LogInfo("GetBotsOwnedBy repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"type": models.UserTypeBot, "bot_owner": owner}
+	cursor, err := userCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "username", Value: 1}}))
+	if err != nil {
+		logger.LogError("GetBotsOwnedBy repo :: error " + err.Error())
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	bots := []*models.BotResponse{}
+	if err := cursor.All(ctx, &bots); err != nil {
+		logger.LogError("GetBotsOwnedBy repo :: error decoding " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("GetBotsOwnedBy repo :: ended")
+	return bots, nil
+}
+
+// EnsureAPIKeyIndexes creates the indexes API keys are looked up by.
+func EnsureAPIKeyIndexes() error {
+	logger.LogInfo("EnsureAPIKeyIndexes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := apiKeyCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "created_by", Value: 1}}},
+		{Keys: bson.D{{Key: "username", Value: 1}}},
+	})
+	if err != nil {
+		logger.LogError("EnsureAPIKeyIndexes repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("EnsureAPIKeyIndexes repo :: ended")
+	return nil
+}
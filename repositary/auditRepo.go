@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InsertAuditEvent appends an event to the audit log. The audit log has no update or delete;
+// events only leave it through the TTL index.
+func InsertAuditEvent(event *models.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := auditCollection.InsertOne(ctx, event)
+	if err != nil {
+		logger.LogError("InsertAuditEvent repo :: error " + err.Error())
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		event.ID = id
+	}
+	return nil
+}
+
+// GetAuditEvents returns one page of the audit events matching query, newest first.
+func GetAuditEvents(query *models.AuditQuery) (*models.AuditPage, error) {
+	logger.LogInfo("GetAuditEvents repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if query.Actor != "" {
+		filter["actor"] = query.Actor
+	}
+	if query.Action != "" {
+		filter["action"] = query.Action
+	}
+	if query.Target != "" {
+		filter["target"] = query.Target
+	}
+	if query.Outcome != "" {
+		filter["outcome"] = query.Outcome
+	}
+	if query.IP != "" {
+		filter["ip"] = query.IP
+	}
+	if query.From != nil || query.To != nil {
+		timeRange := bson.M{}
+		if query.From != nil {
+			timeRange["$gte"] = query.From.UTC()
+		}
+		if query.To != nil {
+			timeRange["$lte"] = query.To.UTC()
+		}
+		filter["timestamp"] = timeRange
+	}
+	if query.Cursor != "" {
+		timestamp, eventID, err := utils.DecodeAuditCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		id, err := primitive.ObjectIDFromHex(eventID)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		filter["$or"] = []bson.M{
+			{"timestamp": bson.M{"$lt": timestamp}},
+			{"timestamp": timestamp, "_id": bson.M{"$lt": id}},
+		}
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(query.Limit + 1))
+	cursor, err := auditCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.LogError("GetAuditEvents repo :: error " + err.Error())
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		logger.LogError("GetAuditEvents repo :: error decoding " + err.Error())
+		return nil, err
+	}
+
+	page := &models.AuditPage{Events: events}
+	if len(events) > query.Limit {
+		page.Events = events[:query.Limit]
+		last := page.Events[query.Limit-1]
+		page.NextCursor = utils.EncodeAuditCursor(last.Timestamp, last.ID.Hex())
+	}
+	logger.LogInfo("GetAuditEvents repo :: ended")
+	return page, nil
+}
+
+// EnsureAuditIndexes creates the indexes backing audit log queries and the TTL index that
+// removes events once their retention ends.
+func EnsureAuditIndexes() error {
+	logger.LogInfo("EnsureAuditIndexes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := auditCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "target", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		logger.LogError("EnsureAuditIndexes repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("EnsureAuditIndexes repo :: ended")
+	return nil
+}
@@ -5,14 +5,14 @@ import (
 	"errors"
 	"real-time-chat-app/logger"
 	"real-time-chat-app/models"
+	"strconv"
 	"time"
 
-	"github.com/golang-jwt/jwt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func HandleContactRequest(contactRequest *models.ContactRequest, claims jwt.MapClaims) (string, error) {
+func HandleContactRequest(contactRequest *models.ContactRequest) (string, error) {
 	logger.LogInfo("HandleContactRequest REPO :: started")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -211,50 +211,280 @@ func UpdateContact(contactRequest *models.ContactActionRequest) (string, error)
 		return "", errors.New("Contact you were trying to send request doesnot exist " + contactRequest.ContactID)
 	}
 
-	// Define the filter based on from_user_id and to_user_id
+	switch contactRequest.Action {
+	case models.ActionBlock:
+		return blockContact(ctx, contactRequest.UserID, contactRequest.ContactID)
+	case models.ActionUnblock:
+		return unblockContact(ctx, contactRequest.UserID, contactRequest.ContactID)
+	}
+
+	// Removing requires an accepted contact, whichever side sent the request
+	filter := contactBetween(contactRequest.UserID, contactRequest.ContactID)
+	filter["status"] = models.StatusAccepted
+	update := bson.M{
+		"$set": bson.M{
+			"status": contactRequest.Action,
+		},
+	}
+
+	mong, err := contactCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		logger.LogError("UpdateContact ::error updating contact " + err.Error())
+		return "", errors.New("error accepting contact action")
+	}
+	if mong.MatchedCount == 0 {
+		logger.LogError("UpdateContact ::contact is not connected")
+		return "", errors.New("cannot remove cause contact is not connected")
+	}
+	logger.LogInfo("UpdateContact repo:: ended")
+	return "Contact action accepted", nil
+}
+
+// blockContact marks every contact entry between the users as blocked by userID, creating
+// one if they were never connected.
+func blockContact(ctx context.Context, userID string, contactID string) (string, error) {
+	update := bson.M{
+		"$set":      bson.M{"status": models.StatusBlocked},
+		"$addToSet": bson.M{"blocked_by": userID},
+	}
+	mong, err := contactCollection.UpdateMany(ctx, contactBetween(userID, contactID), update)
+	if err != nil {
+		logger.LogError("blockContact ::error blocking contact " + err.Error())
+		return "", errors.New("error blocking contact")
+	}
+
+	if mong.MatchedCount == 0 {
+		_, err = contactCollection.InsertOne(ctx, bson.M{
+			"from_user_id": userID,
+			"to_user_id":   contactID,
+			"status":       models.StatusBlocked,
+			"blocked_by":   []string{userID},
+		})
+		if err != nil {
+			logger.LogError("blockContact ::error blocking contact " + err.Error())
+			return "", errors.New("error blocking contact")
+		}
+	}
+	logger.LogInfo("UpdateContact repo:: ended, " + userID + " blocked " + contactID)
+	return "Contact blocked", nil
+}
+
+// unblockContact lifts the block userID placed on contactID. The contact entry is marked as
+// removed unless the other user has blocked them as well.
+func unblockContact(ctx context.Context, userID string, contactID string) (string, error) {
+	filter := contactBetween(userID, contactID)
+	filter["blocked_by"] = userID
+	mong, err := contactCollection.UpdateMany(ctx, filter, bson.M{"$pull": bson.M{"blocked_by": userID}})
+	if err != nil {
+		logger.LogError("unblockContact ::error unblocking contact " + err.Error())
+		return "", errors.New("error unblocking contact")
+	}
+	if mong.MatchedCount == 0 {
+		return "", errors.New("contact is not blocked by you")
+	}
+
+	filter = contactBetween(userID, contactID)
+	filter["status"] = models.StatusBlocked
+	filter["blocked_by"] = bson.M{"$size": 0}
+	_, err = contactCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": models.StatusRemoved}})
+	if err != nil {
+		logger.LogError("unblockContact ::error unblocking contact " + err.Error())
+		return "", errors.New("error unblocking contact")
+	}
+	logger.LogInfo("UpdateContact repo:: ended, " + userID + " unblocked " + contactID)
+	return "Contact unblocked", nil
+}
+
+// IsBlocked reports whether either user has blocked the other.
+func IsBlocked(userA string, userB string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := contactBetween(userA, userB)
+	filter["status"] = models.StatusBlocked
+	count, err := contactCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		logger.LogError("IsBlocked repo :: error " + err.Error())
+		return false, errors.New("error checking contact block")
+	}
+	return count > 0, nil
+}
+
+// GetBlockedContacts returns the usernames the user has blocked.
+func GetBlockedContacts(username string) ([]string, error) {
+	logger.LogInfo("GetBlockedContacts repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := contactCollection.Find(ctx, bson.M{"blocked_by": username})
+	if err != nil {
+		logger.LogError("GetBlockedContacts repo :: error finding contacts: " + err.Error())
+		return nil, errors.New("error finding blocked contacts")
+	}
+	defer cursor.Close(ctx)
+
+	blocked := []string{}
+	for cursor.Next(ctx) {
+		var contact models.Contact
+		if err := cursor.Decode(&contact); err != nil {
+			logger.LogError("GetBlockedContacts repo :: error decoding contact: " + err.Error())
+			return nil, errors.New("error decoding contact")
+		}
+		if contact.FromUserID == username {
+			blocked = append(blocked, contact.ToUserID)
+		} else {
+			blocked = append(blocked, contact.FromUserID)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		logger.LogError("GetBlockedContacts repo :: cursor iteration error: " + err.Error())
+		return nil, errors.New("error iterating through contacts")
+	}
+	logger.LogInfo("GetBlockedContacts repo :: ended")
+	return blocked, nil
+}
+
+// MigrateContactBlocks records the blocking user on contacts blocked before blocked_by was
+// introduced, when only the sender of the request could block. It is safe to run on every start.
+func MigrateContactBlocks() error {
+	logger.LogInfo("MigrateContactBlocks repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
 	filter := bson.M{
-		"from_user_id": contactRequest.UserID,
-		"to_user_id":   contactRequest.ContactID,
+		"status":     models.StatusBlocked,
+		"blocked_by": bson.M{"$exists": false},
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"blocked_by": bson.A{"$from_user_id"}}}},
 	}
+	result, err := contactCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		logger.LogError("MigrateContactBlocks repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("MigrateContactBlocks repo :: ended, migrated " + strconv.FormatInt(result.ModifiedCount, 10) + " contacts")
+	return nil
+}
 
-	var existingRequest models.ContactRequest
-	err = contactCollection.FindOne(ctx, filter).Decode(&existingRequest)
-	if err != nil && err != mongo.ErrNoDocuments {
-		logger.LogError("HandleContactRequest ::error in sending the request" + err.Error())
-		return "", errors.New("error finding the contact request" + err.Error())
+// contactBetween matches the contact entries between two users in either direction.
+func contactBetween(userA string, userB string) bson.M {
+	return bson.M{
+		"$or": []bson.M{
+			{"from_user_id": userA, "to_user_id": userB},
+			{"from_user_id": userB, "to_user_id": userA},
+		},
 	}
-	switch existingRequest.Status {
-	case "accepted":
-		{
+}
 
-			// Update the request status to "accepted"
-			update := bson.M{
-				"$set": bson.M{
-					"status": contactRequest.Action,
-				},
-			}
+// GetAcceptedContacts returns the usernames of every accepted contact of the user, whichever
+// side sent the request, leaving out contacts blocked in either direction.
+func GetAcceptedContacts(username string) ([]string, error) {
+	logger.LogInfo("GetAcceptedContacts repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-			mong, err := contactCollection.UpdateOne(ctx, filter, update)
+	filter := bson.M{
+		"status": bson.M{"$in": []string{models.StatusAccepted, models.StatusBlocked}},
+		"$or": []bson.M{
+			{"from_user_id": username},
+			{"to_user_id": username},
+		},
+	}
 
-			if err != nil {
-				logger.LogError("HandleContactRequest ::error accepting contact request" + err.Error())
-				return "", errors.New("error accepting contact action")
-			}
+	cursor, err := contactCollection.Find(ctx, filter)
+	if err != nil {
+		logger.LogError("GetAcceptedContacts repo :: error finding contacts: " + err.Error())
+		return nil, errors.New("error finding contacts")
+	}
+	defer cursor.Close(ctx)
 
-			if mong.ModifiedCount > 0 {
-				logger.LogInfo("Contact successfully updated.")
-				return "Contact action accepted", nil
-			} else if mong.UpsertedCount > 0 {
-				logger.LogInfo("New contact inserted as part of upsert operation.")
-				return "Contact action accepted as a new entry", nil
-			} else {
-				logger.LogError("HandleContactRequest ::No changes made to the contact request.")
-				return "", errors.New("no changes made to the contact action, first send pending request")
-			}
+	accepted := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var contact models.Contact
+		if err := cursor.Decode(&contact); err != nil {
+			logger.LogError("GetAcceptedContacts repo :: error decoding contact: " + err.Error())
+			return nil, errors.New("error decoding contact")
+		}
+		other := contact.ToUserID
+		if contact.ToUserID == username {
+			other = contact.FromUserID
+		}
+		// A block in either direction wins over an accepted entry in the other
+		if contact.Status == models.StatusBlocked {
+			accepted[other] = false
+		} else if _, seen := accepted[other]; !seen {
+			accepted[other] = true
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		logger.LogError("GetAcceptedContacts repo :: cursor iteration error: " + err.Error())
+		return nil, errors.New("error iterating through contacts")
+	}
 
+	var contacts []string
+	for contact, ok := range accepted {
+		if ok {
+			contacts = append(contacts, contact)
 		}
+	}
+	logger.LogInfo("GetAcceptedContacts repo :: ended")
+	return contacts, nil
+}
+
+// UpdateContactLastOnline records when the user was last online on the contact entries of
+// the users who added them.
+func UpdateContactLastOnline(username string, lastOnline time.Time) error {
+	logger.LogInfo("UpdateContactLastOnline repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
+	filter := bson.M{"to_user_id": username}
+	update := bson.M{"$set": bson.M{"last_online": lastOnline}}
+	_, err := contactCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		logger.LogError("UpdateContactLastOnline repo :: error " + err.Error())
+		return errors.New("error updating contact last online")
 	}
-	logger.LogInfo("UpdateContact repo:: ended")
-	return "", errors.New("cannot block or remove cause contact is not connected")
+	logger.LogInfo("UpdateContactLastOnline repo :: ended")
+	return nil
+}
+
+// GetContactsOfUser returns every contact entry the user is on either side of.
+func GetContactsOfUser(username string) ([]*models.Contact, error) {
+	logger.LogInfo("GetContactsOfUser repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": []bson.M{{"from_user_id": username}, {"to_user_id": username}}}
+	cursor, err := contactCollection.Find(ctx, filter)
+	if err != nil {
+		logger.LogError("GetContactsOfUser repo :: error " + err.Error())
+		return nil, errors.New("error finding contacts")
+	}
+	defer cursor.Close(ctx)
+
+	contacts := []*models.Contact{}
+	if err := cursor.All(ctx, &contacts); err != nil {
+		logger.LogError("GetContactsOfUser repo :: error decoding " + err.Error())
+		return nil, errors.New("error decoding contacts")
+	}
+	logger.LogInfo("GetContactsOfUser repo :: ended")
+	return contacts, nil
+}
+
+// DeleteContactsOfUser removes every contact entry the user is on either side of.
+func DeleteContactsOfUser(username string) (int64, error) {
+	logger.LogInfo("DeleteContactsOfUser repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": []bson.M{{"from_user_id": username}, {"to_user_id": username}}}
+	result, err := contactCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		logger.LogError("DeleteContactsOfUser repo :: error " + err.Error())
+		return 0, errors.New("error deleting contacts")
+	}
+	logger.LogInfo("DeleteContactsOfUser repo :: ended")
+	return result.DeletedCount, nil
 }
@@ -0,0 +1,215 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func CreateConversation(conversation *models.Conversation) error {
+	logger.LogInfo("CreateConversation repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, member := range conversation.Members {
+		_, err := FetchUserByUsername(member.Username)
+		if err != nil {
+			logger.LogError("CreateConversation repo :: member does not exist " + member.Username)
+			return errors.New("user does not exist " + member.Username)
+		}
+	}
+
+	_, err := conversationCollection.InsertOne(ctx, conversation)
+	if err != nil {
+		logger.LogError("CreateConversation repo :: error " + err.Error())
+		return errors.New("error creating the conversation")
+	}
+	logger.LogInfo("CreateConversation repo :: ended")
+	return nil
+}
+
+func FetchConversation(conversationID string) (*models.Conversation, error) {
+	logger.LogInfo("FetchConversation repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"conversation_id": conversationID}
+
+	var conversation models.Conversation
+	err := conversationCollection.FindOne(ctx, filter).Decode(&conversation)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			logger.LogError("FetchConversation repo :: conversation not found " + conversationID)
+			return nil, errors.New("conversation not found")
+		}
+		logger.LogError("FetchConversation repo :: error " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("FetchConversation repo :: ended")
+	return &conversation, nil
+}
+
+func GetConversationsForUser(username string) ([]*models.Conversation, error) {
+	logger.LogInfo("GetConversationsForUser repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"members.username": username}
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "updated_at", Value: -1}})
+
+	cursor, err := conversationCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.LogError("GetConversationsForUser repo :: error " + err.Error())
+		return nil, errors.New("error finding conversations: " + err.Error())
+	}
+	defer cursor.Close(ctx)
+
+	var conversations []*models.Conversation
+	for cursor.Next(ctx) {
+		var conversation models.Conversation
+		if err := cursor.Decode(&conversation); err != nil {
+			logger.LogError("GetConversationsForUser repo :: error decoding conversation: " + err.Error())
+			return nil, errors.New("error decoding conversation: " + err.Error())
+		}
+		conversations = append(conversations, &conversation)
+	}
+
+	if err := cursor.Err(); err != nil {
+		logger.LogError("GetConversationsForUser repo :: cursor iteration error: " + err.Error())
+		return nil, errors.New("error iterating through conversations: " + err.Error())
+	}
+
+	logger.LogInfo("GetConversationsForUser repo :: ended")
+	return conversations, nil
+}
+
+func RenameConversation(conversationID string, name string) error {
+	logger.LogInfo("RenameConversation repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"conversation_id": conversationID}
+	update := bson.M{
+		"$set": bson.M{
+			"name":       name,
+			"updated_at": time.Now().UTC(),
+		},
+	}
+
+	result, err := conversationCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		logger.LogError("RenameConversation repo :: error " + err.Error())
+		return errors.New("error renaming the conversation")
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("conversation not found")
+	}
+	logger.LogInfo("RenameConversation repo :: ended")
+	return nil
+}
+
+func AddConversationMembers(conversationID string, members []models.ConversationMember) error {
+	logger.LogInfo("AddConversationMembers repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, member := range members {
+		_, err := FetchUserByUsername(member.Username)
+		if err != nil {
+			logger.LogError("AddConversationMembers repo :: member does not exist " + member.Username)
+			return errors.New("user does not exist " + member.Username)
+		}
+	}
+
+	filter := bson.M{"conversation_id": conversationID}
+	update := bson.M{
+		"$push": bson.M{"members": bson.M{"$each": members}},
+		"$set":  bson.M{"updated_at": time.Now().UTC()},
+	}
+
+	_, err := conversationCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		logger.LogError("AddConversationMembers repo :: error " + err.Error())
+		return errors.New("error adding members to the conversation")
+	}
+	logger.LogInfo("AddConversationMembers repo :: ended")
+	return nil
+}
+
+func RemoveConversationMembers(conversationID string, usernames []string) error {
+	logger.LogInfo("RemoveConversationMembers repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"conversation_id": conversationID}
+	update := bson.M{
+		"$pull": bson.M{"members": bson.M{"username": bson.M{"$in": usernames}}},
+		"$set":  bson.M{"updated_at": time.Now().UTC()},
+	}
+
+	_, err := conversationCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		logger.LogError("RemoveConversationMembers repo :: error " + err.Error())
+		return errors.New("error removing members from the conversation")
+	}
+	logger.LogInfo("RemoveConversationMembers repo :: ended")
+	return nil
+}
+
+func UpdateConversationMemberRole(conversationID string, username string, role models.ConversationRole) error {
+	logger.LogInfo("UpdateConversationMemberRole repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"conversation_id":  conversationID,
+		"members.username": username,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"members.$.role": role,
+			"updated_at":     time.Now().UTC(),
+		},
+	}
+	if role == models.ConversationRoleOwner {
+		update["$set"].(bson.M)["owner"] = username
+	}
+
+	result, err := conversationCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		logger.LogError("UpdateConversationMemberRole repo :: error " + err.Error())
+		return errors.New("error updating the member role")
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("user is not a member of the conversation")
+	}
+	logger.LogInfo("UpdateConversationMemberRole repo :: ended")
+	return nil
+}
+
+func DeleteConversation(conversationID string) error {
+	logger.LogInfo("DeleteConversation repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := conversationCollection.DeleteOne(ctx, bson.M{"conversation_id": conversationID})
+	if err != nil {
+		logger.LogError("DeleteConversation repo :: error " + err.Error())
+		return errors.New("error deleting the conversation")
+	}
+	logger.LogInfo("DeleteConversation repo :: ended")
+	return nil
+}
+
+func GetConversationMessages(conversationID string, page *models.MessagePageRequest) (*models.MessagePage, error) {
+	logger.LogInfo("GetConversationMessages repo :: started")
+	// Group messages use the conversation ID as their chat ID
+	return getChatMessages(conversationID, page)
+}
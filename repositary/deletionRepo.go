@@ -0,0 +1,173 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ScheduleAccountDeletion marks the account of the user for deletion at the given time. It
+// fails when a deletion is already scheduled.
+func ScheduleAccountDeletion(username string, at time.Time) error {
+	logger.LogInfo("ScheduleAccountDeletion repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"username": username, "deletion_scheduled_at": bson.M{"$exists": false}}
+	result, err := userCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"deletion_scheduled_at": at}})
+	if err != nil {
+		logger.LogError("ScheduleAccountDeletion repo :: " + err.Error())
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("the account is already scheduled for deletion")
+	}
+	logger.LogInfo("ScheduleAccountDeletion repo :: ended")
+	return nil
+}
+
+// CancelAccountDeletion removes the scheduled deletion of the user's account.
+func CancelAccountDeletion(username string) error {
+	logger.LogInfo("CancelAccountDeletion repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"username": username, "deletion_scheduled_at": bson.M{"$exists": true}}
+	result, err := userCollection.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"deletion_scheduled_at": ""}})
+	if err != nil {
+		logger.LogError("CancelAccountDeletion repo :: " + err.Error())
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("the account is not scheduled for deletion")
+	}
+	logger.LogInfo("CancelAccountDeletion repo :: ended")
+	return nil
+}
+
+// GetAccountsDueForDeletion returns up to limit usernames whose scheduled deletion time has
+// passed.
+func GetAccountsDueForDeletion(now time.Time, limit int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"deletion_scheduled_at": bson.M{"$lte": now}}
+	findOptions := options.Find().SetProjection(bson.M{"username": 1}).SetLimit(limit)
+	cursor, err := userCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.LogError("GetAccountsDueForDeletion repo :: " + err.Error())
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []struct {
+		Username string `bson:"username"`
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		logger.LogError("GetAccountsDueForDeletion repo :: error decoding " + err.Error())
+		return nil, err
+	}
+	usernames := make([]string, 0, len(users))
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+	return usernames, nil
+}
+
+// ScheduleMediaDeletion queues the removal of the uploaded media files.
+func ScheduleMediaDeletion(media []models.UploadedMedia) error {
+	logger.LogInfo("ScheduleMediaDeletion repo :: started")
+	if len(media) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	jobs := make([]interface{}, 0, len(media))
+	for _, file := range media {
+		jobs = append(jobs, &models.MediaDeletion{
+			PublicID:     file.PublicID,
+			ResourceType: file.ResourceType,
+			RunAt:        now,
+			CreatedAt:    now,
+		})
+	}
+	if _, err := mediaDeletionCollection.InsertMany(ctx, jobs); err != nil {
+		logger.LogError("ScheduleMediaDeletion repo :: " + err.Error())
+		return errors.New("error scheduling media deletion")
+	}
+	logger.LogInfo("ScheduleMediaDeletion repo :: ended")
+	return nil
+}
+
+// ClaimMediaDeletion takes the next due media deletion and postpones it by lease, so no
+// other server picks it up meanwhile and it is retried if it is not deleted. It returns nil
+// when none is due.
+func ClaimMediaDeletion(lease time.Duration) (*models.MediaDeletion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	update := bson.M{
+		"$set": bson.M{"run_at": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+	var job models.MediaDeletion
+	err := mediaDeletionCollection.FindOneAndUpdate(ctx, bson.M{"run_at": bson.M{"$lte": now}}, update, opts).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		logger.LogError("ClaimMediaDeletion repo :: " + err.Error())
+		return nil, err
+	}
+	return &job, nil
+}
+
+// DeleteMediaDeletion removes a media deletion from the queue once it is done.
+func DeleteMediaDeletion(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := mediaDeletionCollection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		logger.LogError("DeleteMediaDeletion repo :: " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// EnsureDeletionIndexes creates the indexes used to find due account and media deletions.
+func EnsureDeletionIndexes() error {
+	logger.LogInfo("EnsureDeletionIndexes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := userCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "deletion_scheduled_at", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		logger.LogError("EnsureDeletionIndexes repo :: error " + err.Error())
+		return err
+	}
+	_, err = mediaDeletionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "run_at", Value: 1}},
+	})
+	if err != nil {
+		logger.LogError("EnsureDeletionIndexes repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("EnsureDeletionIndexes repo :: ended")
+	return nil
+}
@@ -0,0 +1,156 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultEventRetentionDays is how long stored events can be replayed when
+// EVENT_RETENTION_DAYS is not set.
+const defaultEventRetentionDays = 7
+
+// NextEventSeq allocates the next event sequence number of the user.
+func NextEventSeq(username string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := eventCounterCollection.FindOneAndUpdate(ctx, bson.M{"_id": username}, bson.M{"$inc": bson.M{"seq": 1}}, opts).Decode(&counter)
+	if err != nil {
+		logger.LogError("NextEventSeq repo :: error " + err.Error())
+		return 0, errors.New("error allocating event sequence")
+	}
+	return counter.Seq, nil
+}
+
+// CurrentEventSeq returns the latest event sequence number allocated to the user, or 0.
+func CurrentEventSeq(username string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := eventCounterCollection.FindOne(ctx, bson.M{"_id": username}).Decode(&counter)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		logger.LogError("CurrentEventSeq repo :: error " + err.Error())
+		return 0, errors.New("error fetching event sequence")
+	}
+	return counter.Seq, nil
+}
+
+func SaveEvent(event *models.UserEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := eventCollection.InsertOne(ctx, event)
+	if err != nil {
+		logger.LogError("SaveEvent repo :: error " + err.Error())
+		return errors.New("error saving event")
+	}
+	return nil
+}
+
+// GetEventsSince returns up to limit stored events of the user with a sequence number
+// greater than since, in sequence order.
+func GetEventsSince(username string, since int64, limit int64) ([]*models.UserEvent, error) {
+	logger.LogInfo("GetEventsSince repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"username": username,
+		"seq":      bson.M{"$gt": since},
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(limit)
+
+	cursor, err := eventCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.LogError("GetEventsSince repo :: error " + err.Error())
+		return nil, errors.New("error fetching events")
+	}
+	defer cursor.Close(ctx)
+
+	var events []*models.UserEvent
+	for cursor.Next(ctx) {
+		var event models.UserEvent
+		if err := cursor.Decode(&event); err != nil {
+			logger.LogError("GetEventsSince repo :: error decoding event " + err.Error())
+			return nil, errors.New("error decoding events")
+		}
+		events = append(events, &event)
+	}
+	if err := cursor.Err(); err != nil {
+		logger.LogError("GetEventsSince repo :: cursor error " + err.Error())
+		return nil, errors.New("error fetching events")
+	}
+	logger.LogInfo("GetEventsSince repo :: ended")
+	return events, nil
+}
+
+// DeleteEventsOfUser removes the stored events and the event sequence of the user.
+func DeleteEventsOfUser(username string) error {
+	logger.LogInfo("DeleteEventsOfUser repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := eventCollection.DeleteMany(ctx, bson.M{"username": username}); err != nil {
+		logger.LogError("DeleteEventsOfUser repo :: error " + err.Error())
+		return errors.New("error deleting events")
+	}
+	if _, err := eventCounterCollection.DeleteOne(ctx, bson.M{"_id": username}); err != nil {
+		logger.LogError("DeleteEventsOfUser repo :: error " + err.Error())
+		return errors.New("error deleting event sequence")
+	}
+	logger.LogInfo("DeleteEventsOfUser repo :: ended")
+	return nil
+}
+
+// EnsureEventIndexes creates the index used to replay events in order and the TTL index
+// expiring events after EVENT_RETENTION_DAYS.
+func EnsureEventIndexes() error {
+	logger.LogInfo("EnsureEventIndexes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	retentionDays := defaultEventRetentionDays
+	if value := os.Getenv("EVENT_RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 {
+			return errors.New("EVENT_RETENTION_DAYS must be a positive number")
+		}
+		retentionDays = days
+	}
+
+	_, err := eventCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(retentionDays * 24 * 60 * 60)),
+		},
+	})
+	if err != nil {
+		logger.LogError("EnsureEventIndexes repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("EnsureEventIndexes repo :: ended")
+	return nil
+}
@@ -0,0 +1,216 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InsertExport stores a new pending export. It fails with models.ErrExportInProgress while
+// another export of the user is pending.
+func InsertExport(export *models.Export) error {
+	logger.LogInfo("InsertExport repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := exportCollection.InsertOne(ctx, export)
+	if mongo.IsDuplicateKeyError(err) {
+		return models.ErrExportInProgress
+	}
+	if err != nil {
+		logger.LogError("InsertExport repo :: error " + err.Error())
+		return errors.New("error storing export")
+	}
+	logger.LogInfo("InsertExport repo :: ended")
+	return nil
+}
+
+// CompleteExport marks the export as ready to be downloaded with the token hashed to
+// tokenHash until expiresAt.
+func CompleteExport(exportID string, tokenHash string, size int64, expiresAt time.Time) error {
+	logger.LogInfo("CompleteExport repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"status":       models.ExportReady,
+		"token_hash":   tokenHash,
+		"size":         size,
+		"completed_at": time.Now().UTC(),
+		"expires_at":   expiresAt,
+	}}
+	result, err := exportCollection.UpdateOne(ctx, bson.M{"export_id": exportID, "status": models.ExportPending}, update)
+	if err != nil {
+		logger.LogError("CompleteExport repo :: error " + err.Error())
+		return errors.New("error completing export")
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("export is no longer pending")
+	}
+	logger.LogInfo("CompleteExport repo :: ended")
+	return nil
+}
+
+// FailExport marks the export as failed with the reason. It is listed until expiresAt.
+func FailExport(exportID string, reason string, expiresAt time.Time) error {
+	logger.LogInfo("FailExport repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"status":       models.ExportFailed,
+		"error":        reason,
+		"completed_at": time.Now().UTC(),
+		"expires_at":   expiresAt,
+	}}
+	if _, err := exportCollection.UpdateOne(ctx, bson.M{"export_id": exportID}, update); err != nil {
+		logger.LogError("FailExport repo :: error " + err.Error())
+		return errors.New("error failing export")
+	}
+	logger.LogInfo("FailExport repo :: ended")
+	return nil
+}
+
+// FailStaleExports marks exports still pending since before as failed, such as those whose
+// server stopped while building them, and returns how many there were. They are listed
+// until expiresAt.
+func FailStaleExports(before time.Time, expiresAt time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"status": models.ExportPending, "created_at": bson.M{"$lt": before}}
+	update := bson.M{"$set": bson.M{
+		"status":       models.ExportFailed,
+		"error":        "the export did not finish in time",
+		"completed_at": time.Now().UTC(),
+		"expires_at":   expiresAt,
+	}}
+	result, err := exportCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		logger.LogError("FailStaleExports repo :: error " + err.Error())
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// GetExportsOfUser returns the exports of the user, newest first.
+func GetExportsOfUser(username string) ([]*models.Export, error) {
+	logger.LogInfo("GetExportsOfUser repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := exportCollection.Find(ctx, bson.M{"username": username}, findOptions)
+	if err != nil {
+		logger.LogError("GetExportsOfUser repo :: error " + err.Error())
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	exports := []*models.Export{}
+	if err := cursor.All(ctx, &exports); err != nil {
+		logger.LogError("GetExportsOfUser repo :: error decoding " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("GetExportsOfUser repo :: ended")
+	return exports, nil
+}
+
+// FetchReadyExport returns the ready, unexpired export downloaded with the token hashed to
+// tokenHash.
+func FetchReadyExport(tokenHash string) (*models.Export, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"status":     models.ExportReady,
+		"expires_at": bson.M{"$gt": time.Now().UTC()},
+	}
+	var export models.Export
+	err := exportCollection.FindOne(ctx, filter).Decode(&export)
+	if err == mongo.ErrNoDocuments {
+		return nil, errors.New("export not found or expired")
+	}
+	if err != nil {
+		logger.LogError("FetchReadyExport repo :: error " + err.Error())
+		return nil, err
+	}
+	return &export, nil
+}
+
+// GetExpiredExports returns the finished exports that expired by now.
+func GetExpiredExports(now time.Time) ([]*models.Export, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"status": bson.M{"$ne": models.ExportPending}, "expires_at": bson.M{"$lte": now}}
+	cursor, err := exportCollection.Find(ctx, filter)
+	if err != nil {
+		logger.LogError("GetExpiredExports repo :: error " + err.Error())
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	exports := []*models.Export{}
+	if err := cursor.All(ctx, &exports); err != nil {
+		logger.LogError("GetExpiredExports repo :: error decoding " + err.Error())
+		return nil, err
+	}
+	return exports, nil
+}
+
+// DeleteExports removes the exports with the given IDs.
+func DeleteExports(exportIDs []string) error {
+	if len(exportIDs) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := exportCollection.DeleteMany(ctx, bson.M{"export_id": bson.M{"$in": exportIDs}}); err != nil {
+		logger.LogError("DeleteExports repo :: error " + err.Error())
+		return errors.New("error deleting exports")
+	}
+	return nil
+}
+
+// EnsureExportIndexes creates the export lookup indexes and a partial unique index allowing
+// one pending export per user.
+func EnsureExportIndexes() error {
+	logger.LogInfo("EnsureExportIndexes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := exportCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "export_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "created_at", Value: -1}}},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().
+				SetName("one_pending_export_per_user").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": models.ExportPending}),
+		},
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}},
+	})
+	if err != nil {
+		logger.LogError("EnsureExportIndexes repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("EnsureExportIndexes repo :: ended")
+	return nil
+}
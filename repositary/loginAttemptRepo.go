@@ -0,0 +1,148 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetLoginAttempt returns the failed login record for the username or IP, or nil when there
+// is none.
+func GetLoginAttempt(kind string, subject string) (*models.LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var attempt models.LoginAttempt
+	err := loginAttemptCollection.FindOne(ctx, bson.M{"kind": kind, "subject": subject}).Decode(&attempt)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		logger.LogError("GetLoginAttempt repo :: error " + err.Error())
+		return nil, errors.New("error fetching login attempts")
+	}
+	return &attempt, nil
+}
+
+// RecordLoginFailure counts a failed login for the username or IP and returns the updated
+// record. Failures older than window that are not locked out are forgotten first.
+func RecordLoginFailure(kind string, subject string, window time.Duration) (*models.LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	stale := bson.M{
+		"kind":            kind,
+		"subject":         subject,
+		"last_failure_at": bson.M{"$lt": now.Add(-window)},
+		"$or": []bson.M{
+			{"locked_until": bson.M{"$exists": false}},
+			{"locked_until": bson.M{"$lt": now}},
+		},
+	}
+	if _, err := loginAttemptCollection.DeleteOne(ctx, stale); err != nil {
+		logger.LogError("RecordLoginFailure repo :: error " + err.Error())
+		return nil, errors.New("error recording login attempt")
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"last_failure_at": now},
+		"$max": bson.M{"expires_at": now.Add(window)},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var attempt models.LoginAttempt
+	err := loginAttemptCollection.FindOneAndUpdate(ctx, bson.M{"kind": kind, "subject": subject}, update, opts).Decode(&attempt)
+	if err != nil {
+		logger.LogError("RecordLoginFailure repo :: error " + err.Error())
+		return nil, errors.New("error recording login attempt")
+	}
+	return &attempt, nil
+}
+
+// LockLogin locks out logins for the username or IP until the given time.
+func LockLogin(kind string, subject string, until time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{"locked_until": until},
+		"$max": bson.M{"expires_at": until},
+	}
+	_, err := loginAttemptCollection.UpdateOne(ctx, bson.M{"kind": kind, "subject": subject}, update)
+	if err != nil {
+		logger.LogError("LockLogin repo :: error " + err.Error())
+		return errors.New("error locking login")
+	}
+	logger.LogInfo("LockLogin repo :: locked " + kind + " " + subject)
+	return nil
+}
+
+// ClearLoginAttempts forgets the failed logins of the username or IP, lifting any lockout.
+// It reports false when there was nothing to clear.
+func ClearLoginAttempts(kind string, subject string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := loginAttemptCollection.DeleteOne(ctx, bson.M{"kind": kind, "subject": subject})
+	if err != nil {
+		logger.LogError("ClearLoginAttempts repo :: error " + err.Error())
+		return false, errors.New("error clearing login attempts")
+	}
+	return result.DeletedCount == 1, nil
+}
+
+// GetLockedLogins returns the usernames and IPs currently locked out, the longest locked first.
+func GetLockedLogins() ([]*models.LoginAttempt, error) {
+	logger.LogInfo("GetLockedLogins repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"locked_until": bson.M{"$gt": time.Now().UTC()}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "locked_until", Value: -1}})
+	cursor, err := loginAttemptCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.LogError("GetLockedLogins repo :: error " + err.Error())
+		return nil, errors.New("error fetching lockouts")
+	}
+	defer cursor.Close(ctx)
+
+	attempts := []*models.LoginAttempt{}
+	if err := cursor.All(ctx, &attempts); err != nil {
+		logger.LogError("GetLockedLogins repo :: error decoding " + err.Error())
+		return nil, errors.New("error decoding lockouts")
+	}
+	logger.LogInfo("GetLockedLogins repo :: ended")
+	return attempts, nil
+}
+
+// EnsureLoginAttemptIndexes creates the lookup index and a TTL index removing records once
+// their failures are outside the window and any lockout has ended.
+func EnsureLoginAttemptIndexes() error {
+	logger.LogInfo("EnsureLoginAttemptIndexes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := loginAttemptCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "subject", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		logger.LogError("EnsureLoginAttemptIndexes repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("EnsureLoginAttemptIndexes repo :: ended")
+	return nil
+}
@@ -3,9 +3,9 @@ package repo
 import (
 	"context"
 	"errors"
-	"fmt"
 	"real-time-chat-app/logger"
 	"real-time-chat-app/models"
+	"real-time-chat-app/utils"
 	"strconv"
 	"time"
 
@@ -18,7 +18,11 @@ func SaveMessage(message *models.Message) error {
 	logger.LogInfo("SendMessage repo :: started")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	message.ChatID = message.SenderID + " -> " + message.RecipientID
+	if message.ConversationID != "" {
+		message.ChatID = message.ConversationID
+	} else {
+		message.ChatID = utils.CanonicalChatID(message.SenderID, message.RecipientID)
+	}
 	_, err := messageCollection.InsertOne(ctx, message)
 	if err != nil {
 		logger.LogInfo("SendMessage repo :: error " + err.Error())
@@ -28,92 +32,196 @@ func SaveMessage(message *models.Message) error {
 	return nil
 }
 
-func GetMessage(username string, reciever string) ([]*models.GetMessage, error) {
+func GetMessage(username string, reciever string, page *models.MessagePageRequest) (*models.MessagePage, error) {
 	logger.LogInfo("GetMessage repo :: started")
+	logger.LogInfo("GetMessage from" + reciever + " for user " + username)
+	return getChatMessages(utils.CanonicalChatID(username, reciever), page)
+}
+
+// getChatMessages returns one page of a chat ordered by (timestamp, message_id).
+// Without a cursor or with "before" it walks backwards from the newest message; with
+// "after" it walks forwards. Messages in the page are always in chronological order.
+func getChatMessages(chatID string, page *models.MessagePageRequest) (*models.MessagePage, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	filter := bson.M{
-		"sender_id":    username,
-		"recipient_id": reciever,
-	}
 
-	// var allMessages []bson.M
-	// cursor, err := messageCollection.Find(ctx, bson.M{})
-	// if err != nil {
-	// 	logger.LogError("Error fetching all messages: " + err.Error())
-	// 	return nil, errors.New("error fetching messages")
-	// }
-	// defer cursor.Close(ctx)
-
-	// // Iterate through the cursor and decode each document
-	// if err := cursor.All(ctx, &allMessages); err != nil {
-	// 	logger.LogError("Error decoding all messages: " + err.Error())
-	// 	return nil, errors.New("error decoding messages")
-	// }
-
-	// logger.LogInfo(fmt.Sprintf("All Messages: %+v", allMessages))
+	filter := bson.M{"chat_id": chatID}
+	direction := -1
+	cursorValue := page.Before
+	if page.After != "" {
+		direction = 1
+		cursorValue = page.After
+	}
+	if cursorValue != "" {
+		timestamp, messageID, err := utils.DecodeMessageCursor(cursorValue)
+		if err != nil {
+			logger.LogError("getChatMessages :: invalid cursor " + err.Error())
+			return nil, err
+		}
+		operator := "$lt"
+		if direction == 1 {
+			operator = "$gt"
+		}
+		filter["$or"] = []bson.M{
+			{"timestamp": bson.M{operator: timestamp}},
+			{"timestamp": timestamp, "message_id": bson.M{operator: messageID}},
+		}
+	}
 
-	logger.LogInfo("GetMessage from" + reciever + " for user " + username)
 	findOptions := options.Find()
-	findOptions.SetSort(bson.D{{Key: "timestamp", Value: 1}})
-	fmt.Println(filter)
+	findOptions.SetSort(bson.D{{Key: "timestamp", Value: direction}, {Key: "message_id", Value: direction}})
+	findOptions.SetLimit(int64(page.Limit + 1))
+
 	cursor, err := messageCollection.Find(ctx, filter, findOptions)
 	if err != nil {
-		logger.LogError("GetMessage :: error " + err.Error())
-		logger.LogError("GetMessage :: error " + err.Error())
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
+		logger.LogError("getChatMessages :: error " + err.Error())
 		return nil, err
 	}
 	defer cursor.Close(ctx)
-	fmt.Println(cursor)
-	// Parse the results into a slice of ContactRequest objects
-	var contacts []*models.GetMessage
+
+	var messages []*models.GetMessage
 	for cursor.Next(ctx) {
-		var contact models.GetMessage
-		if err := cursor.Decode(&contact); err != nil {
-			logger.LogError("GetMessage :: error decoding contact: " + err.Error())
-			return nil, errors.New("error decoding contact: " + err.Error())
+		var message models.GetMessage
+		if err := cursor.Decode(&message); err != nil {
+			logger.LogError("getChatMessages :: error decoding message: " + err.Error())
+			return nil, errors.New("error decoding message: " + err.Error())
 		}
-		contacts = append(contacts, &contact)
+		messages = append(messages, &message)
 	}
 
-	fmt.Println(contacts)
+	if err := cursor.Err(); err != nil {
+		logger.LogError("getChatMessages :: cursor iteration error: " + err.Error())
+		return nil, errors.New("error iterating through messages: " + err.Error())
+	}
 
-	// Check for any errors during cursor iteration
+	result := &models.MessagePage{Messages: messages}
+	if len(messages) > page.Limit {
+		result.Messages = messages[:page.Limit]
+		last := result.Messages[page.Limit-1]
+		result.NextCursor = utils.EncodeMessageCursor(last.Timestamp, last.ID)
+	}
+	if direction == -1 {
+		for i, j := 0, len(result.Messages)-1; i < j; i, j = i+1, j-1 {
+			result.Messages[i], result.Messages[j] = result.Messages[j], result.Messages[i]
+		}
+	}
+
+	logger.LogInfo("getChatMessages :: ended")
+	return result, nil
+}
+
+// EnsureMessageIndexes creates the indexes backing chat history pagination, message lookups,
+// the daily message statistics and the clean up of deleted accounts.
+func EnsureMessageIndexes() error {
+	logger.LogInfo("EnsureMessageIndexes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := messageCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "chat_id", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "message_id", Value: 1}}},
+		{Keys: bson.D{{Key: "message_id", Value: 1}}},
+		{Keys: bson.D{{Key: "timestamp", Value: 1}}},
+		{Keys: bson.D{{Key: "sender_id", Value: 1}}},
+		{Keys: bson.D{{Key: "recipient_id", Value: 1}}},
+	})
+	if err != nil {
+		logger.LogError("EnsureMessageIndexes repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("EnsureMessageIndexes repo :: ended")
+	return nil
+}
+
+// MigrateCanonicalChatIDs backfills the canonical chat ID on direct messages that were
+// stored with the legacy "sender -> recipient" ChatID. It is safe to run on every start.
+func MigrateCanonicalChatIDs() error {
+	logger.LogInfo("MigrateCanonicalChatIDs repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	filter := bson.M{
+		"chat_id":         bson.M{"$regex": " -> "},
+		"conversation_id": bson.M{"$exists": false},
+	}
+	findOptions := options.Find().SetProjection(bson.M{"message_id": 1, "sender_id": 1, "recipient_id": 1})
+
+	cursor, err := messageCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		logger.LogError("MigrateCanonicalChatIDs repo :: error " + err.Error())
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := messageCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		writes = writes[:0]
+		return err
+	}
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var message models.Message
+		if err := cursor.Decode(&message); err != nil {
+			logger.LogError("MigrateCanonicalChatIDs repo :: error decoding message: " + err.Error())
+			return err
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"message_id": message.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"chat_id": utils.CanonicalChatID(message.SenderID, message.RecipientID)}}))
+		migrated++
+		if len(writes) == 500 {
+			if err := flush(); err != nil {
+				logger.LogError("MigrateCanonicalChatIDs repo :: bulk write error " + err.Error())
+				return err
+			}
+		}
+	}
 	if err := cursor.Err(); err != nil {
-		logger.LogError("GetMessage :: cursor iteration error: " + err.Error())
-		return nil, errors.New("error iterating through contacts: " + err.Error())
+		logger.LogError("MigrateCanonicalChatIDs repo :: cursor iteration error: " + err.Error())
+		return err
+	}
+	if err := flush(); err != nil {
+		logger.LogError("MigrateCanonicalChatIDs repo :: bulk write error " + err.Error())
+		return err
 	}
 
-	logger.LogInfo("GetMessage repo :: ended")
-	return contacts, nil
+	logger.LogInfo("MigrateCanonicalChatIDs repo :: ended, migrated " + strconv.Itoa(migrated) + " messages")
+	return nil
 }
 
 func EditMessage(editMessage *models.EditMessage) (*models.Message, error) {
 	logger.LogInfo("EditMessage  service :: started ")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	// Only the sender may edit their own message
 	filter := bson.M{
 		"message_id": editMessage.ID,
+		"sender_id":  editMessage.FromUserID,
 	}
-	fmt.Println(filter)
 	var originalmessage *models.Message
 	err := messageCollection.FindOne(ctx, filter).Decode(&originalmessage)
+	if err == mongo.ErrNoDocuments {
+		logger.LogError("EditMessage repo :: message not found with ID: " + editMessage.ID)
+		return nil, models.ErrMessageNotFound
+	}
 	if err != nil {
 		logger.LogError("EditMessage repo :: cannot fetch the original message " + err.Error())
 		return nil, errors.New("unable to update the message ")
 	}
 	logger.LogInfo("document fetch ::" + strconv.Itoa(len(filter)))
 	originalmessage.Content = editMessage.NewText
-	originalmessage.Timestamp = time.Now().Format(time.RFC3339) // Update timestamp manually if needed
+	// The original timestamp is kept so the message keeps its place in the paginated history
+	originalmessage.EditedAt = utils.GetCurrentTimestamp()
 	originalmessage.Status = "edited sent"
 
 	// Persist the changes to the database
 	update := bson.M{"$set": bson.M{
 		"content":   originalmessage.Content,
-		"timestamp": originalmessage.Timestamp,
+		"edited_at": originalmessage.EditedAt,
 		"status":    originalmessage.Status,
 	}}
 	_, updateErr := messageCollection.UpdateOne(ctx, filter, update)
@@ -125,30 +233,327 @@ func EditMessage(editMessage *models.EditMessage) (*models.Message, error) {
 	return originalmessage, nil
 }
 
-func MessageDelete(deleteMessage *models.DeleteMessage) (*models.DeleteMessageResponse, error) {
+// FetchMessage returns the message with the ID, or models.ErrMessageNotFound.
+func FetchMessage(messageID string) (*models.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var message models.Message
+	err := messageCollection.FindOne(ctx, bson.M{"message_id": messageID}).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return nil, models.ErrMessageNotFound
+	}
+	if err != nil {
+		logger.LogError("FetchMessage repo :: error " + err.Error())
+		return nil, err
+	}
+	return &message, nil
+}
+
+// MessageDelete deletes a message of its sender and returns the deleted message.
+func MessageDelete(deleteMessage *models.DeleteMessage) (*models.Message, error) {
 	logger.LogInfo("MessageDelete service :: started")
 
 	// Prepare the context with a timeout for the database operation
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	fmt.Println(deleteMessage.ID)
-	filter := bson.M{"message_id": deleteMessage.ID}
+	// Only the sender may delete their own message; moderators use DeleteMessageByID
+	filter := bson.M{"message_id": deleteMessage.ID, "sender_id": deleteMessage.FromUserID}
 
-	deletedResult, err := messageCollection.DeleteOne(ctx, filter)
+	var deletedMessage models.Message
+	err := messageCollection.FindOneAndDelete(ctx, filter).Decode(&deletedMessage)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			logger.LogError("MessageDelete service :: message not found with ID: " + deleteMessage.ID)
+			return nil, models.ErrMessageNotFound
+		}
 		logger.LogError("MessageDelete service :: error deleting message: " + err.Error())
 		return nil, errors.New("error deleting message")
 	}
 
-	if deletedResult.DeletedCount == 0 {
-		logger.LogError("MessageDelete service :: message not found with ID: " + deleteMessage.ID)
-		return nil, errors.New("message not found")
+	logger.LogInfo("MessageDelete service :: message deleted successfully, ID: " + deleteMessage.ID)
+	return &deletedMessage, nil
+}
+
+// DeleteMessageByID deletes a message whoever sent it and returns the deleted message.
+// It backs moderation, so the caller is responsible for checking permissions.
+func DeleteMessageByID(messageID string) (*models.Message, error) {
+	logger.LogInfo("DeleteMessageByID repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var deletedMessage models.Message
+	err := messageCollection.FindOneAndDelete(ctx, bson.M{"message_id": messageID}).Decode(&deletedMessage)
+	if err == mongo.ErrNoDocuments {
+		logger.LogError("DeleteMessageByID repo :: message not found with ID: " + messageID)
+		return nil, models.ErrMessageNotFound
 	}
+	if err != nil {
+		logger.LogError("DeleteMessageByID repo :: error deleting message: " + err.Error())
+		return nil, errors.New("error deleting message")
+	}
+	logger.LogInfo("DeleteMessageByID repo :: ended")
+	return &deletedMessage, nil
+}
 
-	logger.LogInfo("MessageDelete service :: message deleted successfully, ID: " + deleteMessage.ID)
-	messageResponse := &models.DeleteMessageResponse{
-		Messsage: "Message deleted Successfully",
+// UpdateMessageReceipt records a delivery or read acknowledgement from update.Username.
+// Only a recipient of the message may acknowledge it, and each timestamp is written once,
+// so repeated acknowledgements are harmless. A read implies delivery.
+func UpdateMessageReceipt(update *models.MessageStatusUpdate) (*models.Message, error) {
+	logger.LogInfo("UpdateMessageReceipt repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var message models.Message
+	err := messageCollection.FindOne(ctx, bson.M{"message_id": update.MessageID}).Decode(&message)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, models.ErrMessageNotFound
+		}
+		logger.LogError("UpdateMessageReceipt repo :: error " + err.Error())
+		return nil, err
+	}
+
+	if message.SenderID == update.Username {
+		return nil, errors.New("cannot acknowledge your own message")
+	}
+	if message.ConversationID != "" {
+		conversation, err := FetchConversation(message.ConversationID)
+		if err != nil {
+			return nil, err
+		}
+		if conversation.Member(update.Username) == nil {
+			return nil, errors.New("you are not a member of the conversation")
+		}
+	} else if message.RecipientID != update.Username {
+		return nil, errors.New("you are not the recipient of the message")
+	}
+
+	if update.Status == models.MessageStatusRead {
+		if err := setReceiptField(ctx, update.MessageID, update.Username, "delivered_at", update.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+	field := "delivered_at"
+	if update.Status == models.MessageStatusRead {
+		field = "read_at"
+	}
+	if err := setReceiptField(ctx, update.MessageID, update.Username, field, update.Timestamp); err != nil {
+		return nil, err
+	}
+
+	// Direct messages also carry the overall status; it never moves backwards from read
+	if message.ConversationID == "" {
+		filter := bson.M{"message_id": update.MessageID, "status": bson.M{"$ne": models.MessageStatusRead}}
+		_, err = messageCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": update.Status}})
+		if err != nil {
+			logger.LogError("UpdateMessageReceipt repo :: error updating status " + err.Error())
+			return nil, errors.New("unable to update the message status")
+		}
+	}
+
+	logger.LogInfo("UpdateMessageReceipt repo :: ended")
+	return &message, nil
+}
+
+// setReceiptField sets field on the username's receipt unless it is already set,
+// creating the receipt if the user has none yet.
+func setReceiptField(ctx context.Context, messageID string, username string, field string, timestamp string) error {
+	filter := bson.M{
+		"message_id": messageID,
+		"receipts":   bson.M{"$elemMatch": bson.M{"username": username, field: bson.M{"$exists": false}}},
+	}
+	result, err := messageCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"receipts.$." + field: timestamp}})
+	if err != nil {
+		logger.LogError("setReceiptField :: error " + err.Error())
+		return errors.New("unable to update the message receipt")
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	filter = bson.M{"message_id": messageID, "receipts.username": bson.M{"$ne": username}}
+	update := bson.M{"$push": bson.M{"receipts": bson.M{"username": username, field: timestamp}}}
+	_, err = messageCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		logger.LogError("setReceiptField :: error " + err.Error())
+		return errors.New("unable to update the message receipt")
+	}
+	return nil
+}
+
+// directMessagesOf matches the direct messages the user sent or received.
+func directMessagesOf(username string) bson.M {
+	return bson.M{
+		"$or":             []bson.M{{"sender_id": username}, {"recipient_id": username}},
+		"conversation_id": bson.M{"$exists": false},
+	}
+}
+
+// GetDirectChatPeers returns the users the user has direct chats with, including the user
+// themselves when they sent messages to themselves.
+func GetDirectChatPeers(username string) ([]string, error) {
+	logger.LogInfo("GetDirectChatPeers repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seen := map[string]bool{}
+	peers := []string{}
+	for _, field := range []string{"recipient_id", "sender_id"} {
+		filter := bson.M{"conversation_id": bson.M{"$exists": false}}
+		if field == "recipient_id" {
+			filter["sender_id"] = username
+		} else {
+			filter["recipient_id"] = username
+		}
+		values, err := messageCollection.Distinct(ctx, field, filter)
+		if err != nil {
+			logger.LogError("GetDirectChatPeers repo :: error " + err.Error())
+			return nil, err
+		}
+		for _, value := range values {
+			if peer, ok := value.(string); ok && peer != "" && !seen[peer] {
+				seen[peer] = true
+				peers = append(peers, peer)
+			}
+		}
+	}
+	logger.LogInfo("GetDirectChatPeers repo :: ended")
+	return peers, nil
+}
+
+// GetChatHistory returns every message of a chat in chronological order.
+func GetChatHistory(chatID string) ([]*models.Message, error) {
+	logger.LogInfo("GetChatHistory repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "message_id", Value: 1}})
+	cursor, err := messageCollection.Find(ctx, bson.M{"chat_id": chatID}, findOptions)
+	if err != nil {
+		logger.LogError("GetChatHistory repo :: error " + err.Error())
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	messages := []*models.Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		logger.LogError("GetChatHistory repo :: error decoding " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("GetChatHistory repo :: ended")
+	return messages, nil
+}
+
+// GetMediaSentBy returns the media files the server uploaded for messages the user sent.
+// Media URLs without an upload record are links and are left out.
+func GetMediaSentBy(username string) ([]models.UploadedMedia, error) {
+	logger.LogInfo("GetMediaSentBy repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"sender_id": username, "media.public_id": bson.M{"$nin": []interface{}{nil, ""}}}
+	cursor, err := messageCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"media": 1}))
+	if err != nil {
+		logger.LogError("GetMediaSentBy repo :: error " + err.Error())
+		return nil, err
+	}
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		logger.LogError("GetMediaSentBy repo :: error decoding " + err.Error())
+		return nil, err
+	}
+	media := []models.UploadedMedia{}
+	seen := map[models.UploadedMedia]bool{}
+	for _, message := range messages {
+		if message.Media != nil && !seen[*message.Media] {
+			seen[*message.Media] = true
+			media = append(media, *message.Media)
+		}
+	}
+	logger.LogInfo("GetMediaSentBy repo :: ended")
+	return media, nil
+}
+
+// DeleteMessagesOfUser deletes the direct chats of the user, both sides of them, and the
+// messages they sent to group conversations.
+func DeleteMessagesOfUser(username string) (int64, error) {
+	logger.LogInfo("DeleteMessagesOfUser repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": []bson.M{directMessagesOf(username), {"sender_id": username}}}
+	result, err := messageCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		logger.LogError("DeleteMessagesOfUser repo :: error " + err.Error())
+		return 0, errors.New("error deleting messages")
+	}
+	logger.LogInfo("DeleteMessagesOfUser repo :: ended")
+	return result.DeletedCount, nil
+}
+
+// AnonymizeMessagesOfUser replaces the user with placeholder in every message they sent,
+// received or acknowledged and removes the media they attached. Direct chats move to the
+// chat ID between the other participant and placeholder, so a new account reusing the
+// username cannot read them.
+func AnonymizeMessagesOfUser(username string, placeholder string) (int64, error) {
+	logger.LogInfo("AnonymizeMessagesOfUser repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Find the other participant of every direct chat before the chat IDs change
+	peers, err := GetDirectChatPeers(username)
+	if err != nil {
+		return 0, errors.New("error anonymizing messages")
+	}
+
+	var modified int64
+	for _, peer := range peers {
+		other := peer
+		if peer == username {
+			other = placeholder
+		}
+		oldChatID := utils.CanonicalChatID(username, peer)
+		newChatID := utils.CanonicalChatID(placeholder, other)
+		result, err := messageCollection.UpdateMany(ctx,
+			bson.M{"chat_id": oldChatID, "sender_id": username},
+			bson.M{"$set": bson.M{"sender_id": placeholder, "chat_id": newChatID}, "$unset": bson.M{"media_url": "", "media": ""}})
+		if err != nil {
+			logger.LogError("AnonymizeMessagesOfUser repo :: error " + err.Error())
+			return modified, errors.New("error anonymizing messages")
+		}
+		modified += result.ModifiedCount
+		result, err = messageCollection.UpdateMany(ctx,
+			bson.M{"chat_id": bson.M{"$in": []string{oldChatID, newChatID}}, "recipient_id": username},
+			bson.M{"$set": bson.M{"recipient_id": placeholder, "chat_id": newChatID}})
+		if err != nil {
+			logger.LogError("AnonymizeMessagesOfUser repo :: error " + err.Error())
+			return modified, errors.New("error anonymizing messages")
+		}
+		modified += result.ModifiedCount
+	}
+
+	result, err := messageCollection.UpdateMany(ctx,
+		bson.M{"sender_id": username},
+		bson.M{"$set": bson.M{"sender_id": placeholder}, "$unset": bson.M{"media_url": "", "media": ""}})
+	if err != nil {
+		logger.LogError("AnonymizeMessagesOfUser repo :: error " + err.Error())
+		return modified, errors.New("error anonymizing messages")
+	}
+	modified += result.ModifiedCount
+
+	receiptOptions := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"receipt.username": username}},
+	})
+	_, err = messageCollection.UpdateMany(ctx,
+		bson.M{"receipts.username": username},
+		bson.M{"$set": bson.M{"receipts.$[receipt].username": placeholder}},
+		receiptOptions)
+	if err != nil {
+		logger.LogError("AnonymizeMessagesOfUser repo :: error " + err.Error())
+		return modified, errors.New("error anonymizing message receipts")
 	}
-	return messageResponse, nil
+	logger.LogInfo("AnonymizeMessagesOfUser repo :: ended")
+	return modified, nil
 }
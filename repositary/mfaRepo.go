@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"real-time-chat-app/logger"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SetPendingTOTPSecret stores a TOTP secret waiting to be confirmed by the user.
+func SetPendingTOTPSecret(username string, secret string) error {
+	logger.LogInfo("SetPendingTOTPSecret repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"pending_totp_secret": secret}})
+	if err != nil {
+		logger.LogError("SetPendingTOTPSecret repo :: error " + err.Error())
+		return errors.New("error storing the secret")
+	}
+	logger.LogInfo("SetPendingTOTPSecret repo :: ended")
+	return nil
+}
+
+// EnableTOTP turns on two-factor authentication with the confirmed secret and replaces the
+// recovery codes. step is the time step of the code used to confirm the secret.
+func EnableTOTP(username string, secret string, step int64, recoveryCodeHashes []string) error {
+	logger.LogInfo("EnableTOTP repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"totp_enabled":   true,
+			"totp_secret":    secret,
+			"totp_last_step": step,
+			"recovery_codes": recoveryCodeHashes,
+		},
+		"$unset": bson.M{"pending_totp_secret": ""},
+	}
+	result, err := userCollection.UpdateOne(ctx, bson.M{"username": username, "pending_totp_secret": secret}, update)
+	if err != nil {
+		logger.LogError("EnableTOTP repo :: error " + err.Error())
+		return errors.New("error enabling two-factor authentication")
+	}
+	if result.MatchedCount == 0 {
+		// A newer enrollment replaced the secret in the meantime
+		logger.LogError("EnableTOTP repo :: pending secret changed for " + username)
+		return errors.New("two-factor enrollment was restarted, please enroll again")
+	}
+	logger.LogInfo("EnableTOTP repo :: ended")
+	return nil
+}
+
+// DisableTOTP turns off two-factor authentication and removes the secret and recovery codes.
+func DisableTOTP(username string) error {
+	logger.LogInfo("DisableTOTP repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{"totp_enabled": false},
+		"$unset": bson.M{
+			"totp_secret":         "",
+			"pending_totp_secret": "",
+			"totp_last_step":      "",
+			"recovery_codes":      "",
+		},
+	}
+	_, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, update)
+	if err != nil {
+		logger.LogError("DisableTOTP repo :: error " + err.Error())
+		return errors.New("error disabling two-factor authentication")
+	}
+	logger.LogInfo("DisableTOTP repo :: ended")
+	return nil
+}
+
+// ReplaceRecoveryCodes stores a new set of recovery code hashes, invalidating the old codes.
+func ReplaceRecoveryCodes(username string, recoveryCodeHashes []string) error {
+	logger.LogInfo("ReplaceRecoveryCodes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"recovery_codes": recoveryCodeHashes}})
+	if err != nil {
+		logger.LogError("ReplaceRecoveryCodes repo :: error " + err.Error())
+		return errors.New("error storing recovery codes")
+	}
+	logger.LogInfo("ReplaceRecoveryCodes repo :: ended")
+	return nil
+}
+
+// ClaimTOTPStep records step as the last accepted TOTP code of the user. It reports false
+// when a code of the same or a later step was already accepted, so each code works once.
+func ClaimTOTPStep(username string, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"username": username,
+		"$or": []bson.M{
+			{"totp_last_step": bson.M{"$exists": false}},
+			{"totp_last_step": bson.M{"$lt": step}},
+		},
+	}
+	result, err := userCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totp_last_step": step}})
+	if err != nil {
+		logger.LogError("ClaimTOTPStep repo :: error " + err.Error())
+		return false, errors.New("error checking the code")
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// UseRecoveryCode removes the recovery code hash from the user, reporting false when it was
+// not one of their unused codes.
+func UseRecoveryCode(username string, recoveryCodeHash string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"username": username, "recovery_codes": recoveryCodeHash}
+	result, err := userCollection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"recovery_codes": recoveryCodeHash}})
+	if err != nil {
+		logger.LogError("UseRecoveryCode repo :: error " + err.Error())
+		return false, errors.New("error checking the recovery code")
+	}
+	return result.MatchedCount == 1, nil
+}
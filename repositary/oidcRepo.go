@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InsertOIDCState stores the state of an OIDC login until the provider redirects back.
+func InsertOIDCState(state *models.OIDCState) error {
+	logger.LogInfo("InsertOIDCState repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := oidcStateCollection.InsertOne(ctx, state)
+	if err != nil {
+		logger.LogError("InsertOIDCState repo :: error " + err.Error())
+		return errors.New("error storing login state")
+	}
+	logger.LogInfo("InsertOIDCState repo :: ended")
+	return nil
+}
+
+// ConsumeOIDCState deletes the unexpired login state with the given hash and returns it, so a
+// callback can only be completed once.
+func ConsumeOIDCState(stateHash string) (*models.OIDCState, error) {
+	logger.LogInfo("ConsumeOIDCState repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"state_hash": stateHash,
+		"expires_at": bson.M{"$gt": time.Now().UTC()},
+	}
+	var state models.OIDCState
+	err := oidcStateCollection.FindOneAndDelete(ctx, filter).Decode(&state)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			logger.LogError("ConsumeOIDCState repo :: no valid state found")
+			return nil, errors.New("login state is invalid or expired")
+		}
+		logger.LogError("ConsumeOIDCState repo :: error " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("ConsumeOIDCState repo :: ended")
+	return &state, nil
+}
+
+// FetchUserByOIDCIdentity returns the user linked to the provider account, or nil when no
+// user is linked.
+func FetchUserByOIDCIdentity(issuer string, subject string) (*models.User, error) {
+	logger.LogInfo("FetchUserByOIDCIdentity repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"oidc_identities": bson.M{"$elemMatch": bson.M{"issuer": issuer, "subject": subject}}}
+	var user models.User
+	err := userCollection.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		logger.LogError("FetchUserByOIDCIdentity repo :: error " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("FetchUserByOIDCIdentity repo :: ended")
+	return &user, nil
+}
+
+// LinkOIDCIdentity adds the provider account to the user's identities.
+func LinkOIDCIdentity(username string, identity models.OIDCIdentity) error {
+	logger.LogInfo("LinkOIDCIdentity repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$push": bson.M{"oidc_identities": identity}})
+	if err != nil {
+		logger.LogError("LinkOIDCIdentity repo :: error " + err.Error())
+		return errors.New("error linking account")
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("user not found")
+	}
+	logger.LogInfo("LinkOIDCIdentity repo :: ended")
+	return nil
+}
+
+// UsernameExists reports whether the username is taken.
+func UsernameExists(username string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := userCollection.CountDocuments(ctx, bson.M{"username": username})
+	if err != nil {
+		logger.LogError("UsernameExists repo :: error " + err.Error())
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// EnsureOIDCIndexes creates the login state lookup index, a TTL index removing abandoned
+// logins, and a unique index so a provider account is linked to at most one user.
+func EnsureOIDCIndexes() error {
+	logger.LogInfo("EnsureOIDCIndexes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := oidcStateCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "state_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		logger.LogError("EnsureOIDCIndexes repo :: error " + err.Error())
+		return err
+	}
+
+	_, err = userCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "oidc_identities.issuer", Value: 1}, {Key: "oidc_identities.subject", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"oidc_identities": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		logger.LogError("EnsureOIDCIndexes repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("EnsureOIDCIndexes repo :: ended")
+	return nil
+}
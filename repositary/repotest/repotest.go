@@ -0,0 +1,115 @@
+// Package repotest runs code using the repository against a mock MongoDB deployment, for
+// tests of the packages built on it.
+package repotest
+
+import (
+	"io"
+	"log"
+	"real-time-chat-app/database"
+	"real-time-chat-app/logger"
+	repo "real-time-chat-app/repositary"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Database is the database name the mock replies are for.
+const Database = "chat_test"
+
+var tables = []string{
+	"MONGO_TABLE_USER", "MONGO_TABLE_JWT_STORE", "MONGO_TABLE_CONTACT", "MONGO_TABLE_MESSAGE",
+	"MONGO_TABLE_CONVERSATION", "MONGO_TABLE_EVENT", "MONGO_TABLE_EVENT_COUNTER", "MONGO_TABLE_USER_TOKEN",
+	"MONGO_TABLE_LOGIN_ATTEMPT", "MONGO_TABLE_OIDC_STATE", "MONGO_TABLE_API_KEY", "MONGO_TABLE_AUDIT",
+	"MONGO_TABLE_MEDIA_DELETION", "MONGO_TABLE_EXPORT",
+}
+
+// Run runs f as a subtest of t with the repository using a mock deployment. The deployment
+// answers every command with the next reply f queued with mt.AddMockResponses, so f queues
+// one reply per command in the order the code under test sends them, and can inspect the
+// commands sent with Commands. Each table is named after its variable, e.g. user for
+// MONGO_TABLE_USER.
+func Run(t *testing.T, name string, f func(mt *mtest.T)) {
+	t.Helper()
+	logger.Logger = log.New(io.Discard, "", 0)
+	t.Setenv("MONGO_DATABASE", Database)
+	for _, table := range tables {
+		t.Setenv(table, Table(table))
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run(name, func(mt *mtest.T) {
+		database.UseClient(mt.Client)
+		repo.InitCollections()
+		f(mt)
+	})
+}
+
+// Table returns the collection name Run gives the table of the MONGO_TABLE_* variable.
+func Table(variable string) string {
+	name := []byte(variable[len("MONGO_TABLE_"):])
+	for i, c := range name {
+		if c >= 'A' && c <= 'Z' {
+			name[i] = c + 'a' - 'A'
+		}
+	}
+	return string(name)
+}
+
+// Cursor is the reply to a find or aggregate command returning docs.
+func Cursor(docs ...interface{}) bson.D {
+	batch := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		batch = append(batch, Doc(doc))
+	}
+	return mtest.CreateCursorResponse(0, Database+".mock", mtest.FirstBatch, batch...)
+}
+
+// Count is the reply to the aggregate command of CountDocuments.
+func Count(n int64) bson.D {
+	if n == 0 {
+		return Cursor()
+	}
+	return Cursor(bson.D{{Key: "n", Value: n}})
+}
+
+// Written is the reply to an insert, update or delete command affecting n documents.
+func Written(n int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+// Value is the reply to a findAndModify command finding doc, nil when nothing matched.
+func Value(doc interface{}) bson.D {
+	if doc == nil {
+		return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil})
+	}
+	return mtest.CreateSuccessResponse(bson.E{Key: "value", Value: Doc(doc)})
+}
+
+// Doc converts a model or map to the document the repository would read from the database.
+func Doc(value interface{}) bson.D {
+	raw, err := bson.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+// Commands returns the commands named name, such as "insert" or "update", sent to the
+// collection of the MONGO_TABLE_* variable table so far, in order.
+func Commands(mt *mtest.T, name string, table string) []bson.Raw {
+	var commands []bson.Raw
+	for _, started := range mt.GetAllStartedEvents() {
+		if started.CommandName != name {
+			continue
+		}
+		if collection, ok := started.Command.Lookup(name).StringValueOK(); ok && collection == Table(table) {
+			commands = append(commands, started.Command)
+		}
+	}
+	return commands
+}
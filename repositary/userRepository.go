@@ -3,10 +3,13 @@ package repo
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"real-time-chat-app/database"
 	"real-time-chat-app/logger"
 	"real-time-chat-app/models"
+	"real-time-chat-app/utils"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -16,20 +19,57 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// maxUsedRefreshTokens bounds how many exchanged refresh tokens are remembered per session.
+	maxUsedRefreshTokens = 100
+	// mfaChallengeTTL is how long the user has to enter the second factor after the password.
+	mfaChallengeTTL = 5 * time.Minute
+)
+
 // Declare the collection globally, but initialize it after InitMongoDB is called
 var userCollection *mongo.Collection
 var jwtCollection *mongo.Collection
 var contactCollection *mongo.Collection
 var messageCollection *mongo.Collection
+var conversationCollection *mongo.Collection
+var eventCollection *mongo.Collection
+var eventCounterCollection *mongo.Collection
+var userTokenCollection *mongo.Collection
+var loginAttemptCollection *mongo.Collection
+var oidcStateCollection *mongo.Collection
+var apiKeyCollection *mongo.Collection
+var auditCollection *mongo.Collection
+var mediaDeletionCollection *mongo.Collection
+var exportCollection *mongo.Collection
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
 
 // Initialize userCollection after the MongoDB connection is established
 func InitRepository() {
 	database.InitMongoDB()
+	InitCollections()
+}
 
+// InitCollections looks up the collections named by the MONGO_TABLE_* variables in the
+// database client, which InitRepository connects and tests replace with database.UseClient.
+func InitCollections() {
 	userCollection = database.GetCollection(os.Getenv("MONGO_TABLE_USER"))
 	jwtCollection = database.GetCollection(os.Getenv("MONGO_TABLE_JWT_STORE"))
 	contactCollection = database.GetCollection(os.Getenv("MONGO_TABLE_CONTACT"))
 	messageCollection = database.GetCollection(os.Getenv("MONGO_TABLE_MESSAGE"))
+	conversationCollection = database.GetCollection(os.Getenv("MONGO_TABLE_CONVERSATION"))
+	eventCollection = database.GetCollection(os.Getenv("MONGO_TABLE_EVENT"))
+	eventCounterCollection = database.GetCollection(os.Getenv("MONGO_TABLE_EVENT_COUNTER"))
+	userTokenCollection = database.GetCollection(os.Getenv("MONGO_TABLE_USER_TOKEN"))
+	loginAttemptCollection = database.GetCollection(os.Getenv("MONGO_TABLE_LOGIN_ATTEMPT"))
+	oidcStateCollection = database.GetCollection(os.Getenv("MONGO_TABLE_OIDC_STATE"))
+	apiKeyCollection = database.GetCollection(os.Getenv("MONGO_TABLE_API_KEY"))
+	auditCollection = database.GetCollection(os.Getenv("MONGO_TABLE_AUDIT"))
+	mediaDeletionCollection = database.GetCollection(os.Getenv("MONGO_TABLE_MEDIA_DELETION"))
+	exportCollection = database.GetCollection(os.Getenv("MONGO_TABLE_EXPORT"))
 	logger.LogInfo("Repository Initialized with MongoDB collections")
 }
 
@@ -64,7 +104,11 @@ func InsertUser(user *models.User) error {
 	return nil
 }
 
-func IsLoggedinUserExist(user *models.LoginUser) (string, string, error) {
+// IsLoggedinUserExist checks the credentials and starts a new session for the device
+// described by session, returning its access and refresh tokens. For users with two-factor
+// authentication enabled only a short-lived MFA challenge token is returned, and the session
+// is started once the second factor is verified.
+func IsLoggedinUserExist(user *models.LoginUser, session *models.JwtSession) (*models.LoginResponse, error) {
 	logger.LogInfo("IsLoggedinUserExist :: started")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -75,9 +119,12 @@ func IsLoggedinUserExist(user *models.LoginUser) (string, string, error) {
 	err := userCollection.FindOne(ctx, filter).Decode(&existingUser)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return "", "", errors.New("user not found")
+			// Spend the same time as for a wrong password so timing does not reveal the user is missing
+			CompareHashAndPassword(dummyPasswordHash(), user.Password)
+			logger.LogError("IsLoggedinUserExist :: user not found")
+			return nil, models.ErrInvalidCredentials
 		}
-		return "", "", err
+		return nil, err
 	}
 
 	logger.LogInfo("IsLoggedinUserExist :: user fetch from username : " + existingUser.Email)
@@ -87,34 +134,119 @@ func IsLoggedinUserExist(user *models.LoginUser) (string, string, error) {
 
 	if err != nil {
 		logger.LogError("IsLoggedinUserExist ::invalid password :CompareHashAndPassword ")
-		return "", "", errors.New("invalid password")
+		return nil, models.ErrInvalidCredentials
+	}
+	if existingUser.Type == models.UserTypeBot {
+		// Bots only authenticate with API keys
+		logger.LogError("IsLoggedinUserExist :: password login attempted for bot " + existingUser.Username)
+		return nil, models.ErrInvalidCredentials
 	}
 
 	logger.LogInfo("IsLoggedinUserExist :: Hashed password check success : ")
+	logger.LogInfo("IsLoggedinUserExist :: ended")
+	return StartLogin(&existingUser, session)
+}
+
+// StartLogin logs in a user whose first factor was checked: it starts a new session for the
+// device described by session, or for users with two-factor authentication enabled returns a
+// short-lived MFA challenge token instead. Suspended users and accounts scheduled for
+// deletion are refused.
+func StartLogin(user *models.User, session *models.JwtSession) (*models.LoginResponse, error) {
+	if user.Suspended {
+		logger.LogError("StartLogin :: login of suspended user " + user.Username)
+		return nil, models.ErrAccountSuspended
+	}
+	if user.DeletionScheduledAt != nil {
+		logger.LogError("StartLogin :: login of user pending deletion " + user.Username)
+		return nil, models.ErrAccountPendingDeletion
+	}
+	if user.TOTPEnabled {
+		mfaToken, err := generateMFAChallengeJWT(*user, session.DeviceName)
+		if err != nil {
+			return nil, err
+		}
+		logger.LogInfo("StartLogin :: second factor required for " + user.Username)
+		return &models.LoginResponse{
+			Username:     user.Username,
+			MFARequired:  true,
+			MFAToken:     mfaToken,
+			MFAExpiresIn: int(mfaChallengeTTL.Seconds()),
+		}, nil
+	}
 
+	token, refreshtoken, err := StartJwtSession(user, session)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResponse{
+		Username:     user.Username,
+		Token:        token,
+		RefreshToken: refreshtoken,
+	}, nil
+}
+
+// dummyPasswordHash returns a bcrypt hash compared against when the user does not exist.
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte(utils.GenerateUUID()), bcrypt.DefaultCost)
+		if err != nil {
+			logger.LogError("dummyPasswordHash :: " + err.Error())
+			return
+		}
+		dummyHash = string(hash)
+	})
+	return dummyHash
+}
+
+// StartJwtSession starts a new session of the user for the device described by session and
+// returns its access and refresh tokens.
+func StartJwtSession(user *models.User, session *models.JwtSession) (string, string, error) {
 	// Generate a JWT token here (you can use any JWT library to generate the token)
 	// You can use `jwt-go` or `golang-jwt/jwt` for this purpose.
-	token, err := generateJWT(existingUser)
+	// Every login starts a new session, which every refresh token issued for it belongs to
+	session.SessionID = utils.GenerateUUID()
+	token, refreshtoken, err := GenerateTokenPair(user, session.SessionID)
 	if err != nil {
-		logger.LogError("IsLoggedinUserExist :: Unable to get JWT token ")
 		return "", "", err
 	}
-	refreshtoken, err := generateRefreshTokenJWT(existingUser)
+
+	now := time.Now().UTC()
+	session.Username = user.Username
+	session.Token = token
+	session.RefreshToken = refreshtoken
+	session.UsedRefreshTokens = []string{}
+	session.CreatedAt = now
+	session.LastUsedAt = now
+	err = InsertJwtSession(session)
 	if err != nil {
-		logger.LogError("IsLoggedinUserExist :: Unable to get refresh JWT token  ")
-		return "", "", err
+		logger.LogError("StartJwtSession :: Unable to store JWT token in DB ")
+		return "", "", errors.New("unable to store jwt token in db ")
 	}
+	return token, refreshtoken, nil
+}
+
+// MFAEnforced reports whether the user must use two-factor authentication, which is the case
+// for admins when MFA_REQUIRED_FOR_ADMINS is true.
+func MFAEnforced(user *models.User) bool {
+	return user.Role == models.Admin && os.Getenv("MFA_REQUIRED_FOR_ADMINS") == "true"
+}
 
-	tok, ref, err := InsertJwtTokenForUser(token, refreshtoken, &existingUser)
+// GenerateTokenPair issues an access token and a refresh token for the session.
+func GenerateTokenPair(user *models.User, sessionID string) (string, string, error) {
+	token, err := generateJWT(*user, sessionID)
 	if err != nil {
-		logger.LogError("IsLoggedinUserExist :: Unable to store JWT token in DB ")
-		return "", "", errors.New("unable to store jwt token in db ")
+		logger.LogError("GenerateTokenPair :: Unable to get JWT token ")
+		return "", "", err
 	}
-	logger.LogInfo("IsLoggedinUserExist :: ended")
-	return tok, ref, nil
+	refreshtoken, err := generateRefreshTokenJWT(*user, sessionID)
+	if err != nil {
+		logger.LogError("GenerateTokenPair :: Unable to get refresh JWT token  ")
+		return "", "", err
+	}
+	return token, refreshtoken, nil
 }
 
-func generateJWT(user models.User) (string, error) {
+func generateJWT(user models.User, sessionID string) (string, error) {
 	// Create claims with user data
 	claims := jwt.MapClaims{
 		"user_id":    user.ID.Hex(), // User ID (in case you want to identify the user by ID)
@@ -122,24 +254,28 @@ func generateJWT(user models.User) (string, error) {
 		"First Name": user.FirstName,
 		"Last Name":  user.LastName,
 		"role":       user.Role,                             // User's email
+		"typ":        utils.TokenTypeAccess,                 // Token type, only access tokens authenticate requests
+		"sid":        sessionID,                             // Session the token belongs to
 		"exp":        time.Now().Add(time.Hour * 24).Unix(), // Token expiration time (1 day)
 	}
+	if MFAEnforced(&user) && !user.TOTPEnabled {
+		// Only the two-factor enrollment endpoints accept the token until the user enrolls
+		claims["mfa_setup"] = true
+	}
 
 	logger.LogInfo("generateJWT :: claim map formed ")
 
-	// Create a new token with claims and sign it with the secret key
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secretKey := []byte(os.Getenv("JWT_SECRET_KEY"))
-	tokenString, err := token.SignedString(secretKey)
+	// Sign the token with the active key of the keyring
+	tokenString, err := utils.SignToken(claims)
 	if err != nil {
-		logger.LogError("generateJWT :: error in  Create a new token with claims and sign it with the secret key" + err.Error())
+		logger.LogError("generateJWT :: error in signing the token with claims " + err.Error())
 		return "", err
 	}
 
 	return tokenString, nil
 }
 
-func generateRefreshTokenJWT(user models.User) (string, error) {
+func generateRefreshTokenJWT(user models.User, sessionID string) (string, error) {
 	// Create claims with user data
 	claims := jwt.MapClaims{
 		"user_id":    user.ID.Hex(), // User ID (in case you want to identify the user by ID)
@@ -147,23 +283,43 @@ func generateRefreshTokenJWT(user models.User) (string, error) {
 		"First Name": user.FirstName,
 		"Last Name":  user.LastName,
 		"role":       user.Role,                                 // User's email
+		"typ":        utils.TokenTypeRefresh,                    // Token type, only accepted by /auth/refresh
+		"sid":        sessionID,                                 // Session the token belongs to, shared by every rotation since login
+		"jti":        utils.GenerateUUID(),                      // Keeps tokens issued within the same second distinct
 		"exp":        time.Now().Add(time.Hour * 24 * 7).Unix(), // Token expiration time (7 day)
 	}
 
 	logger.LogInfo("generateRefreshTokenJWT :: claim map formed ")
 
-	// Create a new token with claims and sign it with the secret key
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secretKey := []byte(os.Getenv("JWT_SECRET_KEY"))
-	tokenString, err := token.SignedString(secretKey)
+	// Sign the token with the active key of the keyring
+	tokenString, err := utils.SignToken(claims)
 	if err != nil {
-		logger.LogError("generateRefreshTokenJWT :: error in  Create a new token with claims and sign it with the secret key" + err.Error())
+		logger.LogError("generateRefreshTokenJWT :: error in signing the token with claims " + err.Error())
 		return "", err
 	}
 
 	return tokenString, nil
 }
 
+// generateMFAChallengeJWT issues the token that proves the password was checked, exchanged at
+// /auth/login/2fa together with the second factor. The device name given at login is
+// carried over to the session.
+func generateMFAChallengeJWT(user models.User, deviceName string) (string, error) {
+	claims := jwt.MapClaims{
+		"username": user.Username,
+		"typ":      utils.TokenTypeMFA,
+		"dev":      deviceName,
+		"jti":      utils.GenerateUUID(),
+		"exp":      time.Now().Add(mfaChallengeTTL).Unix(),
+	}
+	tokenString, err := utils.SignToken(claims)
+	if err != nil {
+		logger.LogError("generateMFAChallengeJWT :: unable to sign token " + err.Error())
+		return "", err
+	}
+	return tokenString, nil
+}
+
 // FetchUserByUsername fetches a user from the database using their username.
 func FetchUserByUsername(username string) (*models.User, error) {
 	logger.LogInfo("FetchUserByUsername :: starting")
@@ -185,6 +341,128 @@ func FetchUserByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
+// FetchUserByEmail returns the user registered with the email address.
+func FetchUserByEmail(email string) (*models.User, error) {
+	logger.LogInfo("FetchUserByEmail :: starting")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			logger.LogError("FetchUserByEmail :: user not found")
+			return nil, errors.New("user not found")
+		}
+		logger.LogError("FetchUserByEmail :: " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("FetchUserByEmail :: ending ")
+	return &user, nil
+}
+
+// UpdatePassword replaces the user's password hash.
+func UpdatePassword(username string, hashedPassword string) error {
+	logger.LogInfo("UpdatePassword repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"password": hashedPassword}})
+	if err != nil {
+		logger.LogError("UpdatePassword repo :: error " + err.Error())
+		return errors.New("error updating password")
+	}
+	if result.MatchedCount == 0 {
+		logger.LogError("UpdatePassword repo :: user not found " + username)
+		return errors.New("user not found")
+	}
+	logger.LogInfo("UpdatePassword repo :: ended")
+	return nil
+}
+
+// MarkEmailVerified records that the user confirmed their email address.
+func MarkEmailVerified(username string) error {
+	logger.LogInfo("MarkEmailVerified repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set":   bson.M{"email_verified": true},
+		"$unset": bson.M{"verification_sent_at": ""},
+	}
+	result, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, update)
+	if err != nil {
+		logger.LogError("MarkEmailVerified repo :: error " + err.Error())
+		return errors.New("error verifying email")
+	}
+	if result.MatchedCount == 0 {
+		logger.LogError("MarkEmailVerified repo :: user not found " + username)
+		return errors.New("user not found")
+	}
+	logger.LogInfo("MarkEmailVerified repo :: ended")
+	return nil
+}
+
+// ClaimVerificationEmail records that a verification email is being sent to the unverified
+// user, unless one was already sent within interval. It reports false when the user is
+// verified or has to wait.
+func ClaimVerificationEmail(username string, interval time.Duration) (bool, error) {
+	logger.LogInfo("ClaimVerificationEmail repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	filter := bson.M{
+		"username":       username,
+		"email_verified": false,
+		"$or": []bson.M{
+			{"verification_sent_at": bson.M{"$exists": false}},
+			{"verification_sent_at": bson.M{"$lte": now.Add(-interval)}},
+		},
+	}
+	result, err := userCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"verification_sent_at": now}})
+	if err != nil {
+		logger.LogError("ClaimVerificationEmail repo :: error " + err.Error())
+		return false, errors.New("error updating user")
+	}
+	logger.LogInfo("ClaimVerificationEmail repo :: ended")
+	return result.MatchedCount == 1, nil
+}
+
+// MigrateEmailVerification marks users created before email verification existed as
+// verified, so existing accounts keep working.
+func MigrateEmailVerification() error {
+	logger.LogInfo("MigrateEmailVerification repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := userCollection.UpdateMany(ctx,
+		bson.M{"email_verified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"email_verified": true}},
+	)
+	if err != nil {
+		logger.LogError("MigrateEmailVerification repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo(fmt.Sprintf("MigrateEmailVerification repo :: marked %d existing users as verified", result.ModifiedCount))
+	return nil
+}
+
+// UpdateLastSeen records when the user was last connected.
+func UpdateLastSeen(username string, lastSeen string) error {
+	logger.LogInfo("UpdateLastSeen repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := userCollection.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"last_seen": lastSeen}})
+	if err != nil {
+		logger.LogError("UpdateLastSeen repo :: error " + err.Error())
+		return errors.New("error updating last seen")
+	}
+	logger.LogInfo("UpdateLastSeen repo :: ended")
+	return nil
+}
+
 func CompareHashAndPassword(fetchedUserPassword string, loginUserPassword string) error {
 	// Compare the stored hash with the provided password
 	err := bcrypt.CompareHashAndPassword([]byte(fetchedUserPassword), []byte(loginUserPassword))
@@ -194,54 +472,163 @@ func CompareHashAndPassword(fetchedUserPassword string, loginUserPassword string
 	return nil
 }
 
-func InsertJwtTokenForUser(token string, refreshToken string, user *models.User) (string, string, error) {
+// InsertJwtSession stores a new session.
+func InsertJwtSession(session *models.JwtSession) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"username": user.Username}
+	_, err := jwtCollection.InsertOne(ctx, session)
+	if err != nil {
+		logger.LogError("InsertJwtSession :: Unable to store JWT token in DB " + err.Error())
+		return err
+	}
+	return nil
+}
 
-	loginResp := &models.LoginResponse{
-		Username:     user.Username,
-		RefreshToken: refreshToken,
-		Token:        token,
+// FetchJwtSession returns a stored session by its ID.
+func FetchJwtSession(sessionID string) (*models.JwtSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var session models.JwtSession
+	err := jwtCollection.FindOne(ctx, bson.M{"session_id": sessionID}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			logger.LogError("FetchJwtSession :: No session found: " + sessionID)
+			return nil, errors.New("no session found")
+		}
+		logger.LogError("FetchJwtSession :: Error fetching session: " + err.Error())
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetJwtSessionsForUser returns every session of the user, most recently used first.
+func GetJwtSessionsForUser(username string) ([]*models.JwtSession, error) {
+	logger.LogInfo("GetJwtSessionsForUser :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}})
+	cursor, err := jwtCollection.Find(ctx, bson.M{"username": username}, findOptions)
+	if err != nil {
+		logger.LogError("GetJwtSessionsForUser :: error finding sessions: " + err.Error())
+		return nil, errors.New("error finding sessions")
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []*models.JwtSession{}
+	for cursor.Next(ctx) {
+		var session models.JwtSession
+		if err := cursor.Decode(&session); err != nil {
+			logger.LogError("GetJwtSessionsForUser :: error decoding session: " + err.Error())
+			return nil, errors.New("error decoding session")
+		}
+		sessions = append(sessions, &session)
+	}
+	if err := cursor.Err(); err != nil {
+		logger.LogError("GetJwtSessionsForUser :: cursor iteration error: " + err.Error())
+		return nil, errors.New("error iterating through sessions")
+	}
+	logger.LogInfo("GetJwtSessionsForUser :: ended")
+	return sessions, nil
+}
+
+// TouchJwtSession records that the session was just used.
+func TouchJwtSession(sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"last_used_at": time.Now().UTC()}}
+	_, err := jwtCollection.UpdateOne(ctx, bson.M{"session_id": sessionID}, update)
+	if err != nil {
+		logger.LogError("TouchJwtSession :: Unable to update session " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// RotateJwtTokens replaces the session tokens if refreshToken is still the current refresh
+// token, recording it as used. It reports false when the token was already rotated.
+func RotateJwtTokens(sessionID string, refreshToken string, newToken string, newRefreshToken string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"session_id":   sessionID,
+		"refreshtoken": refreshToken,
 	}
 	update := bson.M{
-		"$set": loginResp, // Replace the document with the new data
+		"$set": bson.M{
+			"token":        newToken,
+			"refreshtoken": newRefreshToken,
+			"last_used_at": time.Now().UTC(),
+		},
+		"$push": bson.M{
+			"used_refresh_tokens": bson.M{
+				"$each":  []string{utils.HashToken(refreshToken)},
+				"$slice": -maxUsedRefreshTokens,
+			},
+		},
 	}
-	opts := options.Update().SetUpsert(true)
-	_, err := jwtCollection.UpdateOne(ctx, filter, update, opts)
+	result, err := jwtCollection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		logger.LogError("InsertJwtTokenForUser :: Unable to store JWT token in DB " + err.Error())
-		return "", "", err
+		logger.LogError("RotateJwtTokens :: Unable to rotate JWT token in DB " + err.Error())
+		return false, err
 	}
-	return token, refreshToken, nil
+	return result.MatchedCount == 1, nil
 }
 
-func FetchJwtTokenForUser(username string) (*models.LoginResponse, error) {
+// DeleteJwtSession ends a single session of the user.
+func DeleteJwtSession(username string, sessionID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Define the filter to find the user's token
-	filter := bson.M{"username": username}
+	result, err := jwtCollection.DeleteOne(ctx, bson.M{"username": username, "session_id": sessionID})
+	if err != nil {
+		logger.LogError("DeleteJwtSession :: Error while removing session " + sessionID + " - " + err.Error())
+		return errors.New("failed to end the session")
+	}
+	if result.DeletedCount == 0 {
+		logger.LogError("DeleteJwtSession :: No session " + sessionID + " for user: " + username)
+		return errors.New("session not found")
+	}
+	logger.LogInfo("DeleteJwtSession :: Successfully ended session " + sessionID + " of user: " + username)
+	return nil
+}
 
-	// Define a variable to hold the result
-	var loginResp models.LoginResponse
+// DeleteOtherJwtSessions ends every session of the user except keepSessionID, returning the
+// IDs of the sessions ended.
+func DeleteOtherJwtSessions(username string, keepSessionID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	// Perform the query to find the document
-	err := jwtCollection.FindOne(ctx, filter).Decode(&loginResp)
+	filter := bson.M{"username": username, "session_id": bson.M{"$ne": keepSessionID}}
+	var sessionIDs []string
+	cursor, err := jwtCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"session_id": 1}))
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			logger.LogError("FetchJwtTokenForUser :: No JWT token found for user: " + username)
-			return nil, errors.New("no JWT token found for the user")
+		logger.LogError("DeleteOtherJwtSessions :: error finding sessions: " + err.Error())
+		return nil, errors.New("failed to end the sessions")
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var session models.JwtSession
+		if err := cursor.Decode(&session); err != nil {
+			return nil, errors.New("failed to end the sessions")
 		}
-		logger.LogError("FetchJwtTokenForUser :: Error fetching JWT token: " + err.Error())
-		return nil, err
+		sessionIDs = append(sessionIDs, session.SessionID)
 	}
 
-	logger.LogInfo("FetchJwtTokenForUser :: Successfully fetched JWT token for user: " + username)
-	return &loginResp, nil
+	_, err = jwtCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		logger.LogError("DeleteOtherJwtSessions :: Error while removing sessions of user: " + username + " - " + err.Error())
+		return nil, errors.New("failed to end the sessions")
+	}
+	logger.LogInfo("DeleteOtherJwtSessions :: Successfully ended other sessions of user: " + username)
+	return sessionIDs, nil
 }
 
+// LogoutUser ends every session of the user.
 func LogoutUser(username string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -249,8 +636,8 @@ func LogoutUser(username string) error {
 	// Define the filter to identify the user's token
 	filter := bson.M{"username": username}
 
-	// Attempt to delete the user's token document from the collection
-	result, err := jwtCollection.DeleteOne(ctx, filter)
+	// Attempt to delete the user's token documents from the collection
+	result, err := jwtCollection.DeleteMany(ctx, filter)
 	if err != nil {
 		logger.LogError("Logout :: Error while removing JWT token from DB for user: " + username + " - " + err.Error())
 		return errors.New("failed to logout the user")
@@ -266,6 +653,35 @@ func LogoutUser(username string) error {
 	return nil
 }
 
+// EnsureSessionIndexes creates the indexes for session lookups. Sessions stored before
+// sessions had IDs are removed first; their tokens carry no session ID and are no longer
+// accepted.
+func EnsureSessionIndexes() error {
+	logger.LogInfo("EnsureSessionIndexes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := jwtCollection.DeleteMany(ctx, bson.M{"session_id": bson.M{"$exists": false}})
+	if err != nil {
+		logger.LogError("EnsureSessionIndexes repo :: error " + err.Error())
+		return err
+	}
+
+	_, err = jwtCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "session_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "username", Value: 1}}},
+	})
+	if err != nil {
+		logger.LogError("EnsureSessionIndexes repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("EnsureSessionIndexes repo :: ended")
+	return nil
+}
+
 func UserFetchFromDB(username string) (*models.UserResponse, error) {
 	logger.LogInfo("UserFetchFromDB :: started")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -313,12 +729,10 @@ func UserAndProfileUpdate(username string, updateUser *models.UpdateUserAndProfi
 		"password":       updateUser.Password,
 		"avatar_url":     updateUser.AvatarURL,
 		"status_message": updateUser.StatusMessage,
-		"last_seen":      updateUser.LastSeen,
 		"first_name":     updateUser.FirstName,
 		"last_name":      updateUser.LastName,
 		"address":        updateUser.Address,
 		"date_of_birth":  updateUser.DateOfBirth,
-		"role":           updateUser.Role,
 		"profile": bson.M{
 			"bio":                  updateUser.Profile.Bio,
 			"is_profile_public":    updateUser.Profile.IsProfilePublic,
@@ -380,18 +794,12 @@ func handleInvalidDatainUpdate(updateUser *models.UpdateUserAndProfile, user *mo
 	if updateUser.StatusMessage == "" {
 		updateUser.StatusMessage = user.StatusMessage
 	}
-	if updateUser.LastSeen == "" {
-		updateUser.LastSeen = user.LastSeen
-	}
 	if updateUser.Address == "" {
 		updateUser.Address = user.Address
 	}
 	if updateUser.DateOfBirth == "" {
 		updateUser.DateOfBirth = user.DateOfBirth
 	}
-	if updateUser.Role == "" {
-		updateUser.Role = user.Role
-	}
 	if updateUser.Profile.Bio == "" {
 		updateUser.Profile.Bio = user.Profile.Bio
 	}
@@ -441,18 +849,67 @@ func DeleteUser(username string) error {
 
 	deletedResult, err := userCollection.DeleteOne(ctx, filter)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			logger.LogError("user not found")
-			return errors.New("user not found")
-		}
-
-		return nil
+		logger.LogError("DeleteUser :: error " + err.Error())
+		return err
 	}
 	if deletedResult.DeletedCount == 0 {
 		logger.LogError("user not found with username " + username)
 		return errors.New("user not found with username " + username)
 	}
-	logger.LogInfo("User Deleted from the database" + string(deletedResult.DeletedCount))
-	logger.LogInfo("DeleteUser ::  started")
+	logger.LogInfo("User Deleted from the database " + username)
+	logger.LogInfo("DeleteUser ::  ended")
 	return nil
 }
+
+// SetUserRole assigns role to the user and returns the role they had before. Demoting the
+// last ADMIN fails with models.ErrLastAdmin. A count taken before the update would let two
+// admins demoting each other at once both pass, so the ADMIN is demoted first and promoted
+// back when no ADMIN is left.
+func SetUserRole(username string, role models.Role) (models.Role, error) {
+	logger.LogInfo("SetUserRole repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	var user models.User
+	err := userCollection.FindOneAndUpdate(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"role": role}}, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		logger.LogError("SetUserRole repo :: user not found " + username)
+		return "", errors.New("user not found")
+	}
+	if err != nil {
+		logger.LogError("SetUserRole repo :: " + err.Error())
+		return "", err
+	}
+
+	if user.Role == models.Admin && role != models.Admin {
+		admins, err := userCollection.CountDocuments(ctx, bson.M{"role": models.Admin})
+		if err != nil || admins == 0 {
+			// Only undo this demotion, not a later change of the role
+			restore := bson.M{"username": username, "role": role}
+			if _, restoreErr := userCollection.UpdateOne(ctx, restore, bson.M{"$set": bson.M{"role": models.Admin}}); restoreErr != nil {
+				logger.LogError("SetUserRole repo :: unable to restore ADMIN role of " + username + " " + restoreErr.Error())
+			}
+			if err != nil {
+				logger.LogError("SetUserRole repo :: unable to count admins " + err.Error())
+				return "", err
+			}
+			return user.Role, models.ErrLastAdmin
+		}
+	}
+	logger.LogInfo("SetUserRole repo :: ended")
+	return user.Role, nil
+}
+
+// CountUsersWithRole returns how many users have role.
+func CountUsersWithRole(role models.Role) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := userCollection.CountDocuments(ctx, bson.M{"role": role})
+	if err != nil {
+		logger.LogError("CountUsersWithRole repo :: " + err.Error())
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InsertUserToken stores a new single-use token.
+func InsertUserToken(token *models.UserToken) error {
+	logger.LogInfo("InsertUserToken repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := userTokenCollection.InsertOne(ctx, token)
+	if err != nil {
+		logger.LogError("InsertUserToken repo :: error " + err.Error())
+		return errors.New("error storing token")
+	}
+	logger.LogInfo("InsertUserToken repo :: ended")
+	return nil
+}
+
+// ConsumeUserToken deletes the unexpired token with the given hash and purpose and returns
+// it, so each token can be used only once.
+func ConsumeUserToken(tokenHash string, purpose string) (*models.UserToken, error) {
+	logger.LogInfo("ConsumeUserToken repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"purpose":    purpose,
+		"expires_at": bson.M{"$gt": time.Now().UTC()},
+	}
+	var token models.UserToken
+	err := userTokenCollection.FindOneAndDelete(ctx, filter).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			logger.LogError("ConsumeUserToken repo :: no valid token found")
+			return nil, errors.New("token is invalid or expired")
+		}
+		logger.LogError("ConsumeUserToken repo :: error " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("ConsumeUserToken repo :: ended")
+	return &token, nil
+}
+
+// DeleteUserTokens removes every outstanding token of the user for the purpose.
+func DeleteUserTokens(username string, purpose string) error {
+	logger.LogInfo("DeleteUserTokens repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := userTokenCollection.DeleteMany(ctx, bson.M{"username": username, "purpose": purpose})
+	if err != nil {
+		logger.LogError("DeleteUserTokens repo :: error " + err.Error())
+		return errors.New("error deleting tokens")
+	}
+	logger.LogInfo("DeleteUserTokens repo :: ended")
+	return nil
+}
+
+// DeleteAllUserTokens removes every outstanding token of the user, whatever its purpose.
+func DeleteAllUserTokens(username string) error {
+	logger.LogInfo("DeleteAllUserTokens repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := userTokenCollection.DeleteMany(ctx, bson.M{"username": username})
+	if err != nil {
+		logger.LogError("DeleteAllUserTokens repo :: error " + err.Error())
+		return errors.New("error deleting tokens")
+	}
+	logger.LogInfo("DeleteAllUserTokens repo :: ended")
+	return nil
+}
+
+// EnsureUserTokenIndexes creates the token lookup index and a TTL index removing tokens once
+// they expire.
+func EnsureUserTokenIndexes() error {
+	logger.LogInfo("EnsureUserTokenIndexes repo :: started")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := userTokenCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "purpose", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		logger.LogError("EnsureUserTokenIndexes repo :: error " + err.Error())
+		return err
+	}
+	logger.LogInfo("EnsureUserTokenIndexes repo :: ended")
+	return nil
+}
@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"real-time-chat-app/controllers"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminRoutes registers the administration routes. Each route requires the permission
+// for what it manages.
+func AdminRoutes(r *gin.Engine) {
+	logger.LogInfo("Admin Routes ...")
+	admin := r.Group("/admin")
+	admin.Use(security.GinAuthMiddleware())
+	{
+		lockouts := admin.Group("/lockouts", security.RequirePermission(models.PermissionLockoutManage))
+		lockouts.GET("", func(c *gin.Context) {
+			controllers.GetLockoutsController(c)
+		})
+		lockouts.DELETE("/:kind/:subject", func(c *gin.Context) {
+			controllers.ClearLockoutController(c)
+		})
+		admin.GET("/users", security.RequirePermission(models.PermissionUserRead), func(c *gin.Context) {
+			controllers.ListUsersController(c)
+		})
+		admin.GET("/users/:username", security.RequirePermission(models.PermissionUserRead), func(c *gin.Context) {
+			controllers.GetUserController(c)
+		})
+		admin.POST("/users/:username/suspend", security.RequirePermission(models.PermissionUserSuspend), func(c *gin.Context) {
+			controllers.SuspendUserController(c)
+		})
+		admin.POST("/users/:username/unsuspend", security.RequirePermission(models.PermissionUserSuspend), func(c *gin.Context) {
+			controllers.UnsuspendUserController(c)
+		})
+		admin.POST("/users/:username/logout", security.RequirePermission(models.PermissionUserSessions), func(c *gin.Context) {
+			controllers.ForceLogoutController(c)
+		})
+		admin.POST("/users/:username/reset-password", security.RequirePermission(models.PermissionUserPassword), func(c *gin.Context) {
+			controllers.AdminResetPasswordController(c)
+		})
+		admin.PUT("/users/:username/role", security.RequirePermission(models.PermissionUserRoleManage), func(c *gin.Context) {
+			controllers.ChangeUserRoleController(c)
+		})
+		admin.GET("/stats", security.RequirePermission(models.PermissionStatsRead), func(c *gin.Context) {
+			controllers.GetStatsController(c)
+		})
+		admin.DELETE("/messages/:id", security.RequirePermission(models.PermissionMessageModerate), func(c *gin.Context) {
+			controllers.ModerateDeleteMessageController(c)
+		})
+		admin.GET("/audit", security.RequirePermission(models.PermissionAuditRead), func(c *gin.Context) {
+			controllers.GetAuditEventsController(c)
+		})
+	}
+}
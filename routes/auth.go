@@ -18,9 +18,31 @@ func AuthRoutes(r *gin.Engine) {
 		})
 		// Uncomment and modify the following if needed
 		auth.POST("/login", func(c *gin.Context) {
-
-			// Call SignUpController with ResponseWriter and Request
-			controllers.LoginController(c.Writer, c.Request)
+			controllers.LoginController(c)
+		})
+		auth.POST("/login/2fa", func(c *gin.Context) {
+			controllers.LoginMFAController(c)
+		})
+		auth.GET("/oidc/login", func(c *gin.Context) {
+			controllers.OIDCLoginController(c)
+		})
+		auth.GET("/oidc/callback", func(c *gin.Context) {
+			controllers.OIDCCallbackController(c)
+		})
+		auth.POST("/refresh", func(c *gin.Context) {
+			controllers.RefreshTokenController(c)
+		})
+		auth.POST("/password/forgot", func(c *gin.Context) {
+			controllers.ForgotPasswordController(c)
+		})
+		auth.POST("/password/reset", func(c *gin.Context) {
+			controllers.ResetPasswordController(c)
+		})
+		auth.POST("/account/restore", func(c *gin.Context) {
+			controllers.RestoreAccountController(c)
+		})
+		auth.GET("/verify", func(c *gin.Context) {
+			controllers.VerifyEmailController(c)
 		})
 		auth.Use(security.GinAuthMiddleware())
 		{
@@ -29,6 +51,37 @@ func AuthRoutes(r *gin.Engine) {
 				// Call SignUpController with ResponseWriter and Request
 				controllers.LogoutController(c)
 			})
+
+			auth.POST("/ws-ticket", func(c *gin.Context) {
+				controllers.WebSocketTicketController(c)
+			})
+
+			auth.POST("/verify/resend", func(c *gin.Context) {
+				controllers.ResendVerificationController(c)
+			})
+
+			auth.POST("/2fa/enroll", func(c *gin.Context) {
+				controllers.EnrollTOTPController(c)
+			})
+			auth.POST("/2fa/confirm", func(c *gin.Context) {
+				controllers.ConfirmTOTPController(c)
+			})
+			auth.POST("/2fa/disable", func(c *gin.Context) {
+				controllers.DisableTOTPController(c)
+			})
+			auth.POST("/2fa/recovery-codes", func(c *gin.Context) {
+				controllers.RegenerateRecoveryCodesController(c)
+			})
+
+			auth.GET("/sessions", func(c *gin.Context) {
+				controllers.GetSessionsController(c)
+			})
+			auth.DELETE("/sessions/:id", func(c *gin.Context) {
+				controllers.RevokeSessionController(c)
+			})
+			auth.POST("/sessions/logout-others", func(c *gin.Context) {
+				controllers.LogoutOtherSessionsController(c)
+			})
 		}
 	}
 }
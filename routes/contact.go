@@ -28,6 +28,10 @@ func ContactRoutes(r *gin.Engine) {
 			contact.POST("/action", func(c *gin.Context) {
 				controllers.BlockOrRemoveContact(c)
 			})
+
+			contact.GET("/blocked", func(c *gin.Context) {
+				controllers.GetBlockedContacts(c)
+			})
 		}
 
 	}
@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"real-time-chat-app/controllers"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ConversationRoutes(r *gin.Engine) {
+	logger.LogInfo("ConversationRoutes Routes ...")
+	conversation := r.Group("/conversation")
+	{
+		conversation.Use(security.GinAuthMiddleware())
+		{
+			conversation.POST("/create", func(c *gin.Context) {
+				controllers.CreateConversationController(c)
+			})
+
+			conversation.GET("/get", func(c *gin.Context) {
+				controllers.GetConversationsController(c)
+			})
+
+			conversation.PATCH("/rename", func(c *gin.Context) {
+				controllers.RenameConversationController(c)
+			})
+
+			conversation.POST("/add", func(c *gin.Context) {
+				controllers.AddConversationMembersController(c)
+			})
+
+			conversation.POST("/remove", func(c *gin.Context) {
+				controllers.RemoveConversationMembersController(c)
+			})
+
+			conversation.POST("/role", func(c *gin.Context) {
+				controllers.ConversationRoleController(c)
+			})
+
+			conversation.POST("/leave", func(c *gin.Context) {
+				controllers.LeaveConversationController(c)
+			})
+
+			conversation.GET("/messages", func(c *gin.Context) {
+				controllers.ConversationMessagesController(c)
+			})
+		}
+	}
+}
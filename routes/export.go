@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"real-time-chat-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportRoutes registers the download of data exports, authenticated by the token in the link.
+func ExportRoutes(r *gin.Engine) {
+	r.GET("/export/download", func(c *gin.Context) {
+		controllers.DownloadExportController(c)
+	})
+}
@@ -0,0 +1,197 @@
+package routes
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/mailer"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/repositary/repotest"
+	"real-time-chat-app/services"
+	"real-time-chat-app/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	logger.Logger = log.New(io.Discard, "", 0)
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_KEYS_DIR", t.TempDir())
+	if err := utils.InitKeyring(); err != nil {
+		t.Fatalf("InitKeyring: %v", err)
+	}
+	mailer.Default = mailer.NewMemoryMailer()
+
+	r := gin.New()
+	AuthRoutes(r)
+	UserRoutes(r)
+	AdminRoutes(r)
+	return r
+}
+
+// login returns an access token of user and queues the replies the auth middleware reads
+// the session and suspension with, for each of the passes of the middleware on the route.
+func login(mt *mtest.T, user *models.User, passes int) string {
+	mt.Helper()
+	token, _, err := repo.GenerateTokenPair(user, "session-"+user.Username)
+	if err != nil {
+		mt.Fatalf("GenerateTokenPair: %v", err)
+	}
+	for i := 0; i < passes; i++ {
+		mt.AddMockResponses(
+			repotest.Cursor(&models.JwtSession{SessionID: "session-" + user.Username, Username: user.Username, LastUsedAt: time.Now().UTC()}),
+			repotest.Cursor(bson.M{"suspended": false}),
+		)
+	}
+	return token
+}
+
+func serve(r *gin.Engine, method string, target string, token string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestSignupCannotChooseAdminRole(t *testing.T) {
+	r := newTestRouter(t)
+	repotest.Run(t, "signup", func(mt *mtest.T) {
+		body := `{"username":"mallory","email":"mallory@example.com","password":"secret123","first_name":"Mallory",` +
+			`"last_name":"Doe","date_of_birth":"1990-01-01","address":"Somewhere","role":"ADMIN"}`
+		recorder := serve(r, http.MethodPost, "/auth/signup", "", body)
+		if recorder.Code != http.StatusBadRequest {
+			mt.Fatalf("signup as ADMIN returned %d, want 400: %s", recorder.Code, recorder.Body)
+		}
+		if inserts := repotest.Commands(mt, "insert", "MONGO_TABLE_USER"); len(inserts) != 0 {
+			mt.Fatalf("signup as ADMIN stored a user: %v", inserts)
+		}
+	})
+
+	repotest.Run(t, "create user", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			repotest.Count(0),
+			repotest.Written(1),
+			repotest.Written(0),
+			repotest.Written(1),
+		)
+		user := &models.User{Username: "mallory", Email: "mallory@example.com", Password: "secret123", Role: models.Admin}
+		if err := services.CreateUser(user); err != nil {
+			mt.Fatalf("CreateUser: %v", err)
+		}
+		inserts := repotest.Commands(mt, "insert", "MONGO_TABLE_USER")
+		if len(inserts) != 1 {
+			mt.Fatalf("CreateUser sent %d user inserts, want 1", len(inserts))
+		}
+		stored := inserts[0].Lookup("documents", "0", "role").StringValue()
+		if stored != string(models.Client) {
+			mt.Fatalf("CreateUser stored role %q, want CLIENT", stored)
+		}
+	})
+}
+
+func TestProfileUpdateIgnoresRole(t *testing.T) {
+	r := newTestRouter(t)
+	repotest.Run(t, "update", func(mt *mtest.T) {
+		client := &models.User{Username: "mallory", Role: models.Client}
+		// UserRoutes adds the auth middleware to the group three times
+		token := login(mt, client, 3)
+		mt.AddMockResponses(
+			repotest.Cursor(client),
+			repotest.Written(1),
+			repotest.Cursor(&models.UserResponse{Username: "mallory", FirstName: "Mal"}),
+			repotest.Written(1),
+		)
+
+		recorder := serve(r, http.MethodPost, "/user/updateUserAndProfile?username=mallory", token,
+			`{"first_name":"Mal","role":"ADMIN"}`)
+		if recorder.Code != http.StatusOK {
+			mt.Fatalf("profile update returned %d: %s", recorder.Code, recorder.Body)
+		}
+		updates := repotest.Commands(mt, "update", "MONGO_TABLE_USER")
+		if len(updates) != 1 {
+			mt.Fatalf("profile update sent %d updates, want 1", len(updates))
+		}
+		set := updates[0].Lookup("updates", "0", "u", "$set")
+		if got := set.Document().Lookup("first_name").StringValue(); got != "Mal" {
+			mt.Fatalf("first_name set to %q, want Mal", got)
+		}
+		if _, err := set.Document().LookupErr("role"); err == nil {
+			mt.Fatalf("profile update changed the role: %v", set)
+		}
+	})
+}
+
+func TestClientCannotChangeRoles(t *testing.T) {
+	r := newTestRouter(t)
+	repotest.Run(t, "promote self", func(mt *mtest.T) {
+		token := login(mt, &models.User{Username: "mallory", Role: models.Client}, 1)
+
+		recorder := serve(r, http.MethodPut, "/admin/users/mallory/role", token, `{"role":"ADMIN"}`)
+		if recorder.Code != http.StatusForbidden {
+			mt.Fatalf("CLIENT changing a role got %d, want 403: %s", recorder.Code, recorder.Body)
+		}
+		for _, command := range []string{"update", "findAndModify"} {
+			if sent := repotest.Commands(mt, command, "MONGO_TABLE_USER"); len(sent) != 0 {
+				mt.Fatalf("CLIENT changing a role sent %s %v", command, sent)
+			}
+		}
+	})
+}
+
+func TestLastAdminCannotBeDemoted(t *testing.T) {
+	r := newTestRouter(t)
+	repotest.Run(t, "demote", func(mt *mtest.T) {
+		admin := &models.User{Username: "alice", Role: models.Admin}
+		token := login(mt, admin, 1)
+		// Another admin demoted alice's last fellow admin at the same time, so none is left
+		mt.AddMockResponses(
+			repotest.Value(admin),
+			repotest.Count(0),
+			repotest.Written(1),
+			repotest.Written(1),
+		)
+
+		recorder := serve(r, http.MethodPut, "/admin/users/alice/role", token, `{"role":"CLIENT"}`)
+		if recorder.Code != http.StatusConflict {
+			mt.Fatalf("demoting the last ADMIN returned %d, want 409: %s", recorder.Code, recorder.Body)
+		}
+		updates := repotest.Commands(mt, "update", "MONGO_TABLE_USER")
+		if len(updates) != 1 {
+			mt.Fatalf("sent %d updates, want the one restoring the role", len(updates))
+		}
+		update := updates[0].Lookup("updates", "0")
+		if got := update.Document().Lookup("q", "role").StringValue(); got != string(models.Client) {
+			mt.Fatalf("restore matched role %q, want CLIENT so only this demotion is undone", got)
+		}
+		if got := update.Document().Lookup("u", "$set", "role").StringValue(); got != string(models.Admin) {
+			mt.Fatalf("restore set role %q, want ADMIN", got)
+		}
+	})
+
+	repotest.Run(t, "other admin left", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			repotest.Value(&models.User{Username: "bob", Role: models.Admin}),
+			repotest.Count(1),
+		)
+		previous, err := repo.SetUserRole("bob", models.Client)
+		if err != nil || previous != models.Admin {
+			mt.Fatalf("SetUserRole = %q, %v; want ADMIN, nil", previous, err)
+		}
+		if updates := repotest.Commands(mt, "update", "MONGO_TABLE_USER"); len(updates) != 0 {
+			mt.Fatalf("the demotion was undone with another ADMIN left: %v", updates)
+		}
+	})
+}
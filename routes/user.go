@@ -3,6 +3,7 @@ package routes
 import (
 	"real-time-chat-app/controllers"
 	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
 	"real-time-chat-app/security"
 
 	"github.com/gin-gonic/gin"
@@ -30,11 +31,41 @@ func UserRoutes(r *gin.Engine) {
 		}
 		user.Use(security.GinAuthMiddleware())
 		{
-			user.DELETE("/deleteUser", func(c *gin.Context) {
+			user.DELETE("/deleteUser", security.RequirePermission(models.PermissionUserDelete), func(c *gin.Context) {
 
 				// Call SignUpController with ResponseWriter and Request
 				controllers.DeleteUserController(c)
 			})
+
+			user.POST("/account/delete", func(c *gin.Context) {
+				controllers.DeleteAccountController(c)
+			})
+			user.POST("/export", func(c *gin.Context) {
+				controllers.RequestExportController(c)
+			})
+			user.GET("/export", func(c *gin.Context) {
+				controllers.GetExportsController(c)
+			})
+
+			user.POST("/apikeys", func(c *gin.Context) {
+				controllers.CreateAPIKeyController(c)
+			})
+			user.GET("/apikeys", func(c *gin.Context) {
+				controllers.GetAPIKeysController(c)
+			})
+			user.DELETE("/apikeys/:id", func(c *gin.Context) {
+				controllers.RevokeAPIKeyController(c)
+			})
+
+			user.POST("/bots", func(c *gin.Context) {
+				controllers.CreateBotController(c)
+			})
+			user.GET("/bots", func(c *gin.Context) {
+				controllers.GetBotsController(c)
+			})
+			user.DELETE("/bots/:username", func(c *gin.Context) {
+				controllers.DeleteBotController(c)
+			})
 		}
 	}
 }
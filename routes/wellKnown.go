@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"real-time-chat-app/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WellKnownRoutes registers the public discovery documents under /.well-known.
+func WellKnownRoutes(r *gin.Engine) {
+	r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		controllers.JWKSController(c)
+	})
+}
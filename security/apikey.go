@@ -0,0 +1,127 @@
+package security
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader is the header API keys are sent in.
+const APIKeyHeader = "X-API-Key"
+
+var ErrInvalidAPIKey = errors.New("invalid, expired or revoked api key")
+
+// apiKeyTouchInterval is how stale a key's last used time may get before a request updates it.
+const apiKeyTouchInterval = time.Minute
+
+// apiKeyRouteScopes maps route prefixes to the scopes API keys need for them: the read scope
+// for GET requests and the write scope for the others. Routes not listed here cannot be
+// used with an API key.
+var apiKeyRouteScopes = []struct {
+	prefix string
+	read   models.APIKeyScope
+	write  models.APIKeyScope
+}{
+	{"/message/", models.ScopeMessagesRead, models.ScopeMessagesWrite},
+	{"/contact/", models.ScopeContactsRead, models.ScopeContactsWrite},
+	{"/conversation/", models.ScopeConversationsRead, models.ScopeConversationsWrite},
+	{"/user/fetchUser", models.ScopeProfileRead, models.ScopeProfileWrite},
+	{"/user/updateUserAndProfile", models.ScopeProfileRead, models.ScopeProfileWrite},
+}
+
+// AuthenticateAPIKey returns the principal an API key acts as. Keys authenticate as the user
+// or bot they were created for, limited to their scopes.
+func AuthenticateAPIKey(key string) (*Principal, error) {
+	keyID, ok := utils.ParseAPIKey(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	apiKey, err := repo.FetchAPIKey(keyID)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(key)), []byte(apiKey.KeyHash)) != 1 {
+		logger.LogError("AuthenticateAPIKey :: wrong secret for key " + keyID)
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now().UTC()
+	if !apiKey.Active(now) {
+		logger.LogError("AuthenticateAPIKey :: inactive key " + keyID)
+		return nil, ErrInvalidAPIKey
+	}
+	user, err := repo.FetchUserByUsername(apiKey.Username)
+	if err != nil {
+		logger.LogError("AuthenticateAPIKey :: user of key " + keyID + " not found")
+		return nil, ErrInvalidAPIKey
+	}
+	if user.Suspended {
+		logger.LogError("AuthenticateAPIKey :: key " + keyID + " of suspended user " + user.Username)
+		return nil, models.ErrAccountSuspended
+	}
+	if user.DeletionScheduledAt != nil {
+		logger.LogError("AuthenticateAPIKey :: key " + keyID + " of user pending deletion " + user.Username)
+		return nil, models.ErrAccountPendingDeletion
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		if err := repo.TouchAPIKey(keyID); err != nil {
+			logger.LogError("AuthenticateAPIKey :: " + err.Error())
+		}
+	}
+	return &Principal{
+		Username:  user.Username,
+		UserID:    user.ID.Hex(),
+		Role:      user.Role,
+		SessionID: utils.APIKeySessionID(keyID),
+		APIKeyID:  keyID,
+		Scopes:    apiKey.Scopes,
+	}, nil
+}
+
+// apiKeyScopeFor returns the scope an API key needs for the route, or false when API keys
+// cannot use it.
+func apiKeyScopeFor(method string, path string) (models.APIKeyScope, bool) {
+	for _, route := range apiKeyRouteScopes {
+		if strings.HasPrefix(path, route.prefix) {
+			if method == http.MethodGet || method == http.MethodHead {
+				return route.read, true
+			}
+			return route.write, true
+		}
+	}
+	return "", false
+}
+
+// authenticateAPIKeyRequest authenticates a request made with an API key and checks the key
+// may use the route, writing the error response when not.
+func authenticateAPIKeyRequest(c *gin.Context, key string) (*Principal, bool) {
+	principal, err := AuthenticateAPIKey(key)
+	if err == models.ErrAccountSuspended || err == models.ErrAccountPendingDeletion {
+		models.ManageErrorResponse(c.Writer, err.Error(), http.StatusForbidden, models.ErrorCode(err))
+		return nil, false
+	}
+	if err != nil {
+		models.ManageResponse(c.Writer, err.Error(), http.StatusUnauthorized, nil, false)
+		return nil, false
+	}
+	scope, ok := apiKeyScopeFor(c.Request.Method, c.FullPath())
+	if !ok {
+		logger.LogError("authenticateAPIKeyRequest :: api keys cannot use " + c.FullPath())
+		models.ManageResponse(c.Writer, "This endpoint cannot be used with an API key", http.StatusForbidden, nil, false)
+		return nil, false
+	}
+	if !principal.HasScope(scope) {
+		logger.LogError("authenticateAPIKeyRequest :: key " + principal.APIKeyID + " lacks " + string(scope))
+		models.ManageResponse(c.Writer, "API key scope required : "+string(scope), http.StatusForbidden, nil, false)
+		return nil, false
+	}
+	return principal, true
+}
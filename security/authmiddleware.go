@@ -1,22 +1,45 @@
 package security
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
-	"os"
 	"real-time-chat-app/logger"
 	"real-time-chat-app/models"
 	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 )
 
-// GinAuthMiddleware is a middleware that checks if the JWT token is valid
+var (
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrMissingUsername = errors.New("invalid claims: username missing")
+	ErrSessionNotFound = errors.New("session expired or login again")
+)
+
+// WebSocketSubprotocol is the subprotocol browsers offer alongside the token, e.g.
+// new WebSocket(url, ["bearer", token]), since they cannot set an Authorization header.
+const WebSocketSubprotocol = "bearer"
+
+// GinAuthMiddleware is a middleware that checks if the JWT token is valid, or the API key
+// in the X-API-Key header when there is one
 func GinAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		logger.LogInfo("GinAuthMiddleware ... :: started")
+		if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" {
+			principal, ok := authenticateAPIKeyRequest(c, apiKey)
+			if !ok {
+				c.Abort()
+				return
+			}
+			c.Set(principalKey, principal)
+			logger.LogInfo("GinAuthMiddleware ... :: ended, api key " + principal.APIKeyID)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
@@ -25,100 +48,184 @@ func GinAuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		secretKey := []byte(os.Getenv("JWT_SECRET_KEY"))
-		// Parse and validate the JWT token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				logger.LogError("unexpected signing method")
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return secretKey, nil
-		})
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		claims, err := ValidateToken(tokenString, utils.TokenTypeAccess)
+		switch err {
+		case nil:
+		case ErrMissingUsername:
+			models.ManageResponse(c.Writer, "Invalid claims: username missing", http.StatusBadRequest, nil, false)
 			c.Abort()
 			return
-		}
-
-		// Extract claims and store them in context
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if ok {
-			c.Set("user", claims)
-		} else {
-			models.ManageResponse(c.Writer, "Unable to parse claims", http.StatusBadRequest, nil, false)
+		case ErrSessionNotFound:
+			models.ManageResponse(c.Writer, "Session expired or Login again", http.StatusNonAuthoritativeInfo, nil, false)
+			c.Abort()
+			return
+		case models.ErrAccountSuspended, models.ErrAccountPendingDeletion:
+			models.ManageErrorResponse(c.Writer, err.Error(), http.StatusForbidden, models.ErrorCode(err))
+			c.Abort()
+			return
+		default:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		username, ok := claims["username"].(string)
-		if !ok || username == "" {
-			models.ManageResponse(c.Writer, "Invalid claims: username missing", http.StatusBadRequest, nil, false)
+		if mfaSetupPending(claims) && !mfaSetupAllowed(c.FullPath()) {
+			logger.LogError("GinAuthMiddleware :: two-factor setup required for " + c.FullPath())
+			models.ManageErrorResponse(c.Writer, models.ErrMFASetupRequired.Error(), http.StatusForbidden, models.ErrorCodeMFASetupRequired)
 			c.Abort()
 			return
 		}
 
-		// Check if the session exists in jwtCollection
-		_, err = repo.FetchJwtTokenForUser(username)
+		principal, err := NewPrincipal(claims)
 		if err != nil {
-			logger.LogError("Session not found for user: " + username)
-			models.ManageResponse(c.Writer, "Session expired or Login again", http.StatusNonAuthoritativeInfo, nil, false)
+			models.ManageResponse(c.Writer, "Invalid claims: username missing", http.StatusBadRequest, nil, false)
 			c.Abort()
 			return
 		}
 
-		// Safely extract the role
-		// userRoleStr, exists := claims["role"].(string)
-		// if !exists {
-		// 	c.JSON(http.StatusUnauthorized, gin.H{"error": "role not found in token"})
-		// 	c.Abort()
-		// 	return
-		// }
-
-		// // Parse the role string into the Role type
-		// userRole, err := models.
-		// if err != nil {
-		// 	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid role"})
-		// 	c.Abort()
-		// 	return
-		// }
-		// Store the role and claims in the context
+		// Store the authenticated caller in the context
+		c.Set(principalKey, principal)
 		logger.LogInfo("GinAuthMiddleware ... :: ended")
 	}
 }
 
-func GetClaims(c *gin.Context) jwt.MapClaims {
-	authHeader := c.GetHeader("Authorization")
-	logger.LogInfo("GetClaims :: started")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
-		c.Abort()
-		return nil
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	secretKey := []byte(os.Getenv("JWT_SECRET_KEY"))
-	// Parse and validate the JWT token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			logger.LogInfo("unexpected signing method")
-			return nil, fmt.Errorf("unexpected signing method")
+// sessionTouchInterval is how stale a session's last used time may get before a request
+// updates it, so that every request does not write to the jwt store.
+const sessionTouchInterval = time.Minute
+
+// ValidateToken checks the signature, expiry and type of tokenString, that the session it
+// was issued for still exists in the jwt store and that the user is neither suspended nor
+// scheduled for deletion, returning the token claims.
+func ValidateToken(tokenString string, tokenType string) (jwt.MapClaims, error) {
+	claims, err := utils.ParseToken(tokenString)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if utils.TokenType(claims) != tokenType {
+		logger.LogError("ValidateToken :: unexpected token type " + utils.TokenType(claims))
+		return nil, ErrInvalidToken
+	}
+
+	username, ok := claims["username"].(string)
+	if !ok || username == "" {
+		return nil, ErrMissingUsername
+	}
+
+	// Check if the session exists in jwtCollection
+	sessionID, _ := claims["sid"].(string)
+	if sessionID == "" {
+		logger.LogError("ValidateToken :: token without session for user: " + username)
+		return nil, ErrSessionNotFound
+	}
+	session, err := repo.FetchJwtSession(sessionID)
+	if err != nil || session.Username != username {
+		logger.LogError("Session not found for user: " + username)
+		return nil, ErrSessionNotFound
+	}
+	// Checked on every request, so a session that outlived a suspension or a deletion request
+	// cannot be used
+	err = repo.CheckAccountActive(username)
+	if err == models.ErrAccountSuspended || err == models.ErrAccountPendingDeletion {
+		logger.LogError("ValidateToken :: token of " + username + " refused, " + err.Error())
+		return nil, err
+	}
+	if err != nil {
+		logger.LogError("ValidateToken :: " + err.Error())
+		return nil, ErrInvalidToken
+	}
+	if time.Since(session.LastUsedAt) > sessionTouchInterval {
+		if err := repo.TouchJwtSession(sessionID); err != nil {
+			logger.LogError("ValidateToken :: " + err.Error())
+		}
+	}
+	return claims, nil
+}
+
+// mfaSetupPending reports whether the token belongs to a user who must enroll in two-factor
+// authentication before using the API.
+func mfaSetupPending(claims jwt.MapClaims) bool {
+	pending, _ := claims["mfa_setup"].(bool)
+	return pending
+}
+
+// mfaSetupAllowed reports whether the route can be used before two-factor enrollment.
+func mfaSetupAllowed(path string) bool {
+	return strings.HasPrefix(path, "/auth/2fa/") || path == "/auth/logout"
+}
+
+// AuthenticateWebSocket validates the credentials of a WebSocket upgrade request. The token
+// may be sent as an Authorization header, as the second value of the Sec-WebSocket-Protocol
+// header after "bearer", or as a short-lived, single-use ticket from /auth/ws-ticket in the
+// ticket query parameter. Bots and other API clients can send an API key in the X-API-Key
+// header instead, which needs both message scopes. Returns the authenticated user.
+func AuthenticateWebSocket(r *http.Request) (*Principal, error) {
+	if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+		principal, err := AuthenticateAPIKey(apiKey)
+		if err != nil {
+			return nil, err
+		}
+		if !principal.HasScope(models.ScopeMessagesRead) || !principal.HasScope(models.ScopeMessagesWrite) {
+			return nil, errors.New("api key scopes messages:read and messages:write required")
 		}
-		return secretKey, nil
-	})
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-		c.Abort()
-		return nil
+		return principal, nil
+	}
+
+	claims, err := authenticateWebSocket(r)
+	if err != nil {
+		return nil, err
+	}
+	if mfaSetupPending(claims) {
+		return nil, models.ErrMFASetupRequired
+	}
+	return NewPrincipal(claims)
+}
+
+func authenticateWebSocket(r *http.Request) (jwt.MapClaims, error) {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		return ValidateToken(strings.TrimPrefix(authHeader, "Bearer "), utils.TokenTypeAccess)
+	}
+
+	protocols := websocketProtocols(r)
+	if len(protocols) == 2 && protocols[0] == WebSocketSubprotocol {
+		return ValidateToken(protocols[1], utils.TokenTypeAccess)
 	}
 
-	// Extract claims and store them in context
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		models.ManageResponse(c.Writer, "Unable to parse claims", http.StatusBadRequest, nil, false)
-		c.Abort()
-		return nil
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		return consumeWebSocketTicket(ticket)
 	}
-	logger.LogInfo("GetClaims :: ended")
-	return claims
 
+	return nil, ErrInvalidToken
+}
+
+// consumeWebSocketTicket validates a ticket from /auth/ws-ticket and consumes its ID, so each
+// ticket opens at most one connection.
+func consumeWebSocketTicket(ticket string) (jwt.MapClaims, error) {
+	claims, err := ValidateToken(ticket, utils.TokenTypeWSTicket)
+	if err != nil {
+		return nil, err
+	}
+	ticketID, _ := claims["jti"].(string)
+	if ticketID == "" {
+		return nil, ErrInvalidToken
+	}
+	username, _ := claims["username"].(string)
+	stored, err := repo.ConsumeUserToken(utils.HashToken(ticketID), models.TokenPurposeWebSocketTicket)
+	if err != nil || stored.Username != username {
+		logger.LogError("consumeWebSocketTicket :: ticket already used or expired")
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func websocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	return protocols
 }
@@ -0,0 +1,90 @@
+package security
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/repositary/repotest"
+	"real-time-chat-app/services"
+	"real-time-chat-app/utils"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestWebSocketTicketIsSingleUse(t *testing.T) {
+	t.Setenv("JWT_KEYS_DIR", t.TempDir())
+	if err := utils.InitKeyring(); err != nil {
+		t.Fatalf("InitKeyring: %v", err)
+	}
+	repotest.Run(t, "ticket", func(mt *mtest.T) {
+		mt.AddMockResponses(repotest.Written(1))
+		ticket, _, err := services.IssueWebSocketTicket("alice", "session-alice")
+		if err != nil {
+			mt.Fatalf("IssueWebSocketTicket: %v", err)
+		}
+		inserts := repotest.Commands(mt, "insert", "MONGO_TABLE_USER_TOKEN")
+		if len(inserts) != 1 {
+			mt.Fatalf("stored %d ticket IDs, want 1", len(inserts))
+		}
+		var stored models.UserToken
+		if err := bson.Unmarshal(inserts[0].Lookup("documents", "0").Document(), &stored); err != nil {
+			mt.Fatalf("decoding the stored ticket ID: %v", err)
+		}
+		if stored.Username != "alice" || stored.Purpose != models.TokenPurposeWebSocketTicket {
+			mt.Fatalf("unexpected stored ticket ID %+v", stored)
+		}
+
+		request := httptest.NewRequest("GET", "/ws?ticket="+url.QueryEscape(ticket), nil)
+		session := &models.JwtSession{SessionID: "session-alice", Username: "alice", LastUsedAt: time.Now().UTC()}
+		mt.AddMockResponses(
+			repotest.Cursor(session),
+			repotest.Cursor(bson.M{"suspended": false}),
+			repotest.Value(&stored),
+		)
+		principal, err := AuthenticateWebSocket(request)
+		if err != nil {
+			mt.Fatalf("AuthenticateWebSocket: %v", err)
+		}
+		if principal.Username != "alice" || principal.SessionID != "session-alice" {
+			mt.Fatalf("unexpected principal %+v", principal)
+		}
+		consumed := repotest.Commands(mt, "findAndModify", "MONGO_TABLE_USER_TOKEN")
+		if len(consumed) != 1 || consumed[0].Lookup("query", "token_hash").StringValue() != stored.TokenHash {
+			mt.Fatalf("the ticket ID was not consumed: %v", consumed)
+		}
+
+		// The ID is gone, so the same ticket cannot open another connection
+		mt.AddMockResponses(
+			repotest.Cursor(session),
+			repotest.Cursor(bson.M{"suspended": false}),
+			repotest.Value(nil),
+		)
+		if _, err := AuthenticateWebSocket(request); err != ErrInvalidToken {
+			mt.Fatalf("reusing the ticket returned %v, want %v", err, ErrInvalidToken)
+		}
+	})
+}
+
+func TestValidateTokenRefusesAccountPendingDeletion(t *testing.T) {
+	t.Setenv("JWT_KEYS_DIR", t.TempDir())
+	if err := utils.InitKeyring(); err != nil {
+		t.Fatalf("InitKeyring: %v", err)
+	}
+	repotest.Run(t, "pending deletion", func(mt *mtest.T) {
+		token, _, err := repo.GenerateTokenPair(&models.User{Username: "alice", Role: models.Client}, "session-alice")
+		if err != nil {
+			mt.Fatalf("GenerateTokenPair: %v", err)
+		}
+		mt.AddMockResponses(
+			repotest.Cursor(&models.JwtSession{SessionID: "session-alice", Username: "alice", LastUsedAt: time.Now().UTC()}),
+			repotest.Cursor(bson.M{"deletion_scheduled_at": time.Now().Add(24 * time.Hour)}),
+		)
+		if _, err := ValidateToken(token, utils.TokenTypeAccess); err != models.ErrAccountPendingDeletion {
+			mt.Fatalf("ValidateToken = %v, want %v", err, models.ErrAccountPendingDeletion)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package security
+
+import (
+	"net/http"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// principalKey is the Gin context key GinAuthMiddleware stores the Principal under.
+const principalKey = "principal"
+
+// Principal is the authenticated caller of a request. Callers authenticated with an API key
+// have APIKeyID and the key's Scopes set.
+type Principal struct {
+	Username  string
+	UserID    string
+	Role      models.Role
+	SessionID string
+	APIKeyID  string               `json:",omitempty"`
+	Scopes    []models.APIKeyScope `json:",omitempty"`
+}
+
+// NewPrincipal builds the principal from the claims of a validated token.
+func NewPrincipal(claims jwt.MapClaims) (*Principal, error) {
+	username, _ := claims["username"].(string)
+	if username == "" {
+		return nil, ErrMissingUsername
+	}
+	userID, _ := claims["user_id"].(string)
+	role, _ := claims["role"].(string)
+	sessionID, _ := claims["sid"].(string)
+	return &Principal{
+		Username:  username,
+		UserID:    userID,
+		Role:      models.Role(role),
+		SessionID: sessionID,
+	}, nil
+}
+
+// Can reports whether the principal's role grants permission. API keys never carry the
+// permissions of their user's role.
+func (p *Principal) Can(permission models.Permission) bool {
+	if p.APIKeyID != "" {
+		return false
+	}
+	return p.Role.HasPermission(permission)
+}
+
+// HasScope reports whether the principal may use scope: always for users logged in with a
+// token, and for API keys when the key was given it.
+func (p *Principal) HasScope(scope models.APIKeyScope) bool {
+	if p.APIKeyID == "" {
+		return true
+	}
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPrincipal returns the principal stored by GinAuthMiddleware, or nil on routes without it.
+func GetPrincipal(c *gin.Context) *Principal {
+	value, exists := c.Get(principalKey)
+	if !exists {
+		return nil
+	}
+	principal, _ := value.(*Principal)
+	return principal
+}
+
+// RequirePermission is a middleware, applied after GinAuthMiddleware, that only lets through
+// principals whose role grants every one of the permissions.
+func RequirePermission(permissions ...models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := GetPrincipal(c)
+		if principal == nil {
+			logger.LogError("RequirePermission :: no principal for " + c.FullPath())
+			models.ManageResponse(c.Writer, "Unauthorized", http.StatusUnauthorized, nil, false)
+			c.Abort()
+			return
+		}
+
+		var missing []string
+		for _, permission := range permissions {
+			if !principal.Can(permission) {
+				missing = append(missing, string(permission))
+			}
+		}
+		if len(missing) > 0 {
+			logger.LogError("RequirePermission :: " + principal.Username + " lacks " + strings.Join(missing, ", ") + " for " + c.FullPath())
+			models.ManageResponse(c.Writer, "Permission required : "+strings.Join(missing, ", "), http.StatusForbidden, nil, false)
+			c.Abort()
+			return
+		}
+	}
+}
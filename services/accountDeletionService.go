@@ -0,0 +1,297 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"real-time-chat-app/config"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/mailer"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// defaultAccountDeletionGrace is how long a user can undo deleting their account unless
+	// ACCOUNT_DELETION_GRACE_DAYS says otherwise.
+	defaultAccountDeletionGrace = 14 * 24 * time.Hour
+	// lifecycleInterval is how often due account and media deletions are carried out.
+	lifecycleInterval = 5 * time.Minute
+	// accountDeletionBatch bounds how many accounts are deleted per run.
+	accountDeletionBatch = 20
+	// mediaDeletionLease is how long a claimed media deletion waits before it is retried.
+	mediaDeletionLease = 10 * time.Minute
+	// maxMediaDeletionAttempts is how often a media file is tried before it is given up on.
+	maxMediaDeletionAttempts = 5
+)
+
+var (
+	ErrIncorrectPassword   = errors.New("the password is incorrect")
+	ErrInvalidRestoreToken = errors.New("restore token is invalid or expired")
+)
+
+// RequestAccountDeletion schedules the deletion of the user's account after the grace period,
+// once the password and, with two-factor authentication enabled, a code confirm it. The user
+// is emailed a link to keep the account and is logged out everywhere; logins and API keys
+// are refused until the account is restored or deleted.
+func RequestAccountDeletion(username string, request *models.DeleteAccountRequest) (*models.DeleteAccountResponse, error) {
+	logger.LogInfo("RequestAccountDeletion service :: started")
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user.Type == models.UserTypeBot {
+		return nil, errors.New("bots are deleted by their owner")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password)) != nil {
+		return nil, ErrIncorrectPassword
+	}
+	if user.TOTPEnabled {
+		if err := verifySecondFactor(user, request.Code, true); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := utils.GenerateSecureToken()
+	if err != nil {
+		logger.LogError("RequestAccountDeletion service :: unable to generate token " + err.Error())
+		return nil, errors.New("unable to create restore token")
+	}
+	grace := envDuration("ACCOUNT_DELETION_GRACE_DAYS", 24*time.Hour, defaultAccountDeletionGrace)
+	now := time.Now().UTC()
+	scheduledFor := now.Add(grace)
+	if err := repo.ScheduleAccountDeletion(username, scheduledFor); err != nil {
+		return nil, err
+	}
+	if err := repo.DeleteUserTokens(username, models.TokenPurposeAccountRestore); err != nil {
+		logger.LogError("RequestAccountDeletion service :: " + err.Error())
+	}
+	err = repo.InsertUserToken(&models.UserToken{
+		TokenHash: utils.HashToken(token),
+		Username:  username,
+		Purpose:   models.TokenPurposeAccountRestore,
+		CreatedAt: now,
+		ExpiresAt: scheduledFor,
+	})
+	if err == nil {
+		err = mailer.Send(&mailer.Message{
+			To:      user.Email,
+			Subject: "Your account will be deleted",
+			Body: "Hi " + user.FirstName + ",\n\n" +
+				"Your account and your data will be deleted on " + scheduledFor.Format("2 January 2006 15:04 MST") + ". " +
+				"You have been logged out everywhere.\n\n" +
+				"If you change your mind, open the link below before then to keep your account. It can be used once.\n\n" +
+				accountRestoreLink(token) + "\n",
+		})
+	}
+	if err != nil {
+		// Without the email the user could not undo the deletion
+		logger.LogError("RequestAccountDeletion service :: unable to send restore email to " + username + " " + err.Error())
+		if cancelErr := repo.CancelAccountDeletion(username); cancelErr != nil {
+			logger.LogError("RequestAccountDeletion service :: " + cancelErr.Error())
+		}
+		return nil, errors.New("unable to send the confirmation email, the account was not scheduled for deletion")
+	}
+
+	endUserSessions(username)
+	logger.LogInfo("RequestAccountDeletion service :: ended")
+	return &models.DeleteAccountResponse{ScheduledFor: scheduledFor}, nil
+}
+
+// RestoreAccount cancels a scheduled account deletion with the token from the email and
+// returns the username of the restored account. The user logs in again as usual.
+func RestoreAccount(request *models.RestoreAccountRequest) (string, error) {
+	logger.LogInfo("RestoreAccount service :: started")
+	token, err := repo.ConsumeUserToken(utils.HashToken(request.Token), models.TokenPurposeAccountRestore)
+	if err != nil {
+		return "", ErrInvalidRestoreToken
+	}
+	if err := repo.CancelAccountDeletion(token.Username); err != nil {
+		return token.Username, err
+	}
+	logger.LogInfo("RestoreAccount service :: ended")
+	return token.Username, nil
+}
+
+// DeleteAccount deletes the account of username and everything that belongs to it at once:
+// the bots it owns, its API keys, sessions and WebSocket connections, its group memberships,
+// contacts, stored events, tokens and data exports. Messages are deleted or anonymized according to
+// ACCOUNT_DELETION_MESSAGES and uploaded media is queued for deletion. The user document is
+// removed last, so a deletion that fails part way can be retried.
+func DeleteAccount(username string) error {
+	logger.LogInfo("DeleteAccount service :: started")
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if user.Type != models.UserTypeBot {
+		bots, err := repo.GetBotsOwnedBy(username)
+		if err != nil {
+			return err
+		}
+		for _, bot := range bots {
+			if err := DeleteAccount(bot.Username); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := repo.RevokeAPIKeysForUser(username); err != nil {
+		return err
+	}
+	endUserSessions(username)
+
+	conversations, err := repo.GetConversationsForUser(username)
+	if err != nil {
+		return err
+	}
+	for _, conversation := range conversations {
+		err := LeaveConversation(&models.LeaveConversationRequest{ConversationID: conversation.ID}, username)
+		if err != nil {
+			return err
+		}
+	}
+
+	media, err := repo.GetMediaSentBy(username)
+	if err != nil {
+		return err
+	}
+	if err := repo.ScheduleMediaDeletion(media); err != nil {
+		return err
+	}
+	policy := deletionPolicy()
+	var messages int64
+	if policy == models.DeletionPolicyDelete {
+		messages, err = repo.DeleteMessagesOfUser(username)
+	} else {
+		messages, err = repo.AnonymizeMessagesOfUser(username, models.DeletedUserPrefix+primitive.NewObjectID().Hex())
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := repo.DeleteContactsOfUser(username); err != nil {
+		return err
+	}
+	if err := repo.DeleteEventsOfUser(username); err != nil {
+		return err
+	}
+	if err := repo.DeleteAllUserTokens(username); err != nil {
+		return err
+	}
+	exports, err := repo.GetExportsOfUser(username)
+	if err != nil {
+		return err
+	}
+	if err := removeExports(exports); err != nil {
+		return err
+	}
+	if _, err := repo.ClearLoginAttempts(models.LoginAttemptUser, username); err != nil {
+		return err
+	}
+	if err := repo.DeleteUser(username); err != nil {
+		return err
+	}
+	logger.LogInfo("DeleteAccount service :: " + username + " deleted, " + strconv.FormatInt(messages, 10) +
+		" messages " + string(policy) + "d, " + strconv.Itoa(len(media)) + " media files queued")
+	logger.LogInfo("DeleteAccount service :: ended")
+	return nil
+}
+
+// deletionPolicy returns the policy for the messages of deleted accounts from
+// ACCOUNT_DELETION_MESSAGES, anonymize unless it says delete.
+func deletionPolicy() models.DeletionPolicy {
+	switch policy := models.DeletionPolicy(os.Getenv("ACCOUNT_DELETION_MESSAGES")); policy {
+	case models.DeletionPolicyDelete, models.DeletionPolicyAnonymize:
+		return policy
+	case "":
+	default:
+		logger.LogError("deletionPolicy :: invalid ACCOUNT_DELETION_MESSAGES " + string(policy))
+	}
+	return models.DeletionPolicyAnonymize
+}
+
+// StartDataLifecycle deletes the accounts whose grace period is over, the queued media files
+// and expired data exports in the background, checking every few minutes.
+func StartDataLifecycle() {
+	go func() {
+		ticker := time.NewTicker(lifecycleInterval)
+		defer ticker.Stop()
+		for {
+			deleteDueAccounts()
+			deleteQueuedMedia()
+			deleteExpiredExports()
+			<-ticker.C
+		}
+	}()
+}
+
+func deleteDueAccounts() {
+	usernames, err := repo.GetAccountsDueForDeletion(time.Now().UTC(), accountDeletionBatch)
+	if err != nil {
+		logger.LogError("deleteDueAccounts :: " + err.Error())
+		return
+	}
+	for _, username := range usernames {
+		err := DeleteAccount(username)
+		if err != nil {
+			// Retried on the next run
+			logger.LogError("deleteDueAccounts :: unable to delete " + username + " " + err.Error())
+		}
+		outcome, reason := auditOutcome(err)
+		RecordAudit(&models.AuditEvent{
+			Actor:   "system",
+			Action:  models.AuditUserDelete,
+			Target:  username,
+			Outcome: outcome,
+			Reason:  reason,
+			Details: map[string]string{"requested_by": "user", "messages": string(deletionPolicy())},
+		})
+	}
+}
+
+func deleteQueuedMedia() {
+	for {
+		job, err := repo.ClaimMediaDeletion(mediaDeletionLease)
+		if err != nil {
+			logger.LogError("deleteQueuedMedia :: " + err.Error())
+			return
+		}
+		if job == nil {
+			return
+		}
+		// Only files the server recorded as uploaded are deleted
+		if job.PublicID == "" {
+			logger.LogInfo("deleteQueuedMedia :: skipping a deletion without an upload record")
+		} else if err = config.DeleteMedia(job.ResourceType, job.PublicID); err != nil && job.Attempts < maxMediaDeletionAttempts {
+			logger.LogError("deleteQueuedMedia :: unable to delete " + job.PublicID + ", will retry " + err.Error())
+			continue
+		} else if err != nil {
+			logger.LogError("deleteQueuedMedia :: giving up on " + job.PublicID + " " + err.Error())
+		}
+		if err := repo.DeleteMediaDeletion(job.ID); err != nil {
+			logger.LogError("deleteQueuedMedia :: " + err.Error())
+		}
+	}
+}
+
+// accountRestoreLink builds the link emailed to the user from ACCOUNT_RESTORE_URL, the page of
+// the client app that posts the token to /auth/account/restore.
+func accountRestoreLink(token string) string {
+	base := os.Getenv("ACCOUNT_RESTORE_URL")
+	if base == "" {
+		base = "http://localhost:8080/restore-account"
+	}
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/mailer"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxSuspendReasonLength caps the reason kept on a suspended user.
+	maxSuspendReasonLength = 500
+	// defaultStatsDays is how many days of messages the statistics cover by default.
+	defaultStatsDays = 7
+	// maxStatsDays is the most days of messages the statistics can cover.
+	maxStatsDays = 90
+)
+
+var ErrSuspendSelf = errors.New("you cannot suspend your own account")
+
+// ListUsers returns one page of the users matching query.
+func ListUsers(query *models.AdminUserQuery) (*models.AdminUserPage, error) {
+	logger.LogInfo("ListUsers service :: started")
+	page, err := repo.ListUsers(query)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo("ListUsers service :: ended")
+	return page, nil
+}
+
+// GetUserDetail returns the full record of a user with their active sessions.
+func GetUserDetail(username string) (*models.AdminUserDetail, error) {
+	logger.LogInfo("GetUserDetail service :: started")
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	sessions, err := repo.GetJwtSessionsForUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &models.AdminUserDetail{
+		AdminUserSummary: models.AdminUserSummary{
+			Username:      user.Username,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			FirstName:     user.FirstName,
+			LastName:      user.LastName,
+			Role:          user.Role,
+			Type:          user.Type,
+			BotOwner:      user.BotOwner,
+			TOTPEnabled:   user.TOTPEnabled,
+			Suspended:     user.Suspended,
+			SuspendedAt:   user.SuspendedAt,
+			LastSeen:      user.LastSeen,
+		},
+		AvatarURL:      user.AvatarURL,
+		StatusMessage:  user.StatusMessage,
+		Address:        user.Address,
+		DateOfBirth:    user.DateOfBirth,
+		Profile:        user.Profile,
+		SuspendedBy:    user.SuspendedBy,
+		SuspendReason:  user.SuspendReason,
+		OIDCIdentities: user.OIDCIdentities,
+		Sessions:       sessions,
+		Online:         utils.Connections.IsOnline(username),
+	}
+	logger.LogInfo("GetUserDetail service :: ended")
+	return detail, nil
+}
+
+// SuspendUser suspends username on behalf of actor. Every session of the user is logged out
+// and their WebSocket connections are closed; their API keys stop working until the
+// suspension is lifted. Admins cannot suspend themselves, so at least one can always lift it.
+func SuspendUser(actor string, username string, reason string) error {
+	logger.LogInfo("SuspendUser service :: started")
+	if actor == username {
+		return ErrSuspendSelf
+	}
+	reason = truncate(strings.TrimSpace(reason), maxSuspendReasonLength)
+	if err := repo.SetUserSuspended(username, true, actor, reason); err != nil {
+		return err
+	}
+	endUserSessions(username)
+	logger.LogInfo("SuspendUser service :: ended")
+	return nil
+}
+
+// UnsuspendUser lifts the suspension of username.
+func UnsuspendUser(username string) error {
+	logger.LogInfo("UnsuspendUser service :: started")
+	if err := repo.SetUserSuspended(username, false, "", ""); err != nil {
+		return err
+	}
+	logger.LogInfo("UnsuspendUser service :: ended")
+	return nil
+}
+
+// ForceLogout ends every session of username and closes their WebSocket connections.
+func ForceLogout(username string) error {
+	logger.LogInfo("ForceLogout service :: started")
+	if _, err := repo.FetchUserByUsername(username); err != nil {
+		return errors.New("user not found")
+	}
+	endUserSessions(username)
+	logger.LogInfo("ForceLogout service :: ended")
+	return nil
+}
+
+// AdminResetPassword replaces the password of username with a random one nobody knows, logs
+// the user out everywhere and emails them a link to choose a new password.
+func AdminResetPassword(username string) error {
+	logger.LogInfo("AdminResetPassword service :: started")
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if user.Type == models.UserTypeBot {
+		return errors.New("bots have no password to reset")
+	}
+
+	password, err := utils.GenerateSecureToken()
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+	if err := repo.UpdatePassword(username, string(hashedPassword)); err != nil {
+		return err
+	}
+	endUserSessions(username)
+
+	message, err := passwordResetMessage(user, true)
+	if err != nil {
+		return err
+	}
+	if err := mailer.Send(message); err != nil {
+		logger.LogError("AdminResetPassword service :: unable to send reset email to " + username + " " + err.Error())
+		return errors.New("the password was reset but the email could not be sent, ask the user to use forgot password")
+	}
+	logger.LogInfo("AdminResetPassword service :: ended")
+	return nil
+}
+
+// GetAdminStats returns the user counts, the messages sent on each of the last days days
+// including today, and the WebSocket connections open on this server.
+func GetAdminStats(days int) (*models.AdminStats, error) {
+	logger.LogInfo("GetAdminStats service :: started")
+	if days < 1 || days > maxStatsDays {
+		days = defaultStatsDays
+	}
+	stats, err := repo.GetUserStats()
+	if err != nil {
+		return nil, err
+	}
+	first := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	counted, err := repo.GetMessagesPerDay(first)
+	if err != nil {
+		return nil, err
+	}
+	// Days without messages are reported with a count of 0
+	counts := make(map[string]int64, len(counted))
+	for _, day := range counted {
+		counts[day.Date] = day.Count
+	}
+	stats.MessagesPerDay = make([]models.DailyMessageCount, 0, days)
+	for i := 0; i < days; i++ {
+		date := first.AddDate(0, 0, i).Format("2006-01-02")
+		stats.MessagesPerDay = append(stats.MessagesPerDay, models.DailyMessageCount{Date: date, Count: counts[date]})
+	}
+	stats.ActiveSockets = utils.Connections.ConnectionCount()
+	stats.OnlineUsers = utils.Connections.UserCount()
+	logger.LogInfo("GetAdminStats service :: ended")
+	return stats, nil
+}
+
+// endUserSessions logs the user out of every session and closes their WebSocket connections.
+func endUserSessions(username string) {
+	if err := repo.LogoutUser(username); err != nil {
+		// The user may not have been logged in anywhere
+		logger.LogInfo("endUserSessions :: " + err.Error())
+	}
+	utils.CloseConnection(username)
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxAPIKeyNameLength caps the name given to an API key.
+	maxAPIKeyNameLength = 100
+	// maxAPIKeyDays is the longest expiry an API key can be given.
+	maxAPIKeyDays = 3650
+	// botEmailDomain gives bots a unique address that cannot receive email.
+	botEmailDomain = "@bots.invalid"
+)
+
+// CreateAPIKey creates an API key for owner, or for one of owner's bots when request.Bot is
+// set. The key itself is only returned here; only its hash is stored.
+func CreateAPIKey(owner string, request *models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	logger.LogInfo("CreateAPIKey service :: started")
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return nil, errors.New("name is required and at most 100 characters")
+	}
+	if len(request.Scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	var scopes []models.APIKeyScope
+	seen := make(map[models.APIKeyScope]bool)
+	for _, scope := range request.Scopes {
+		if !scope.IsValid() {
+			return nil, errors.New("unknown scope " + string(scope))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if request.ExpiresInDays < 0 || request.ExpiresInDays > maxAPIKeyDays {
+		return nil, errors.New("expires_in_days must be between 1 and 3650, or left out")
+	}
+
+	username := owner
+	if request.Bot != "" {
+		if _, err := ownedBot(owner, request.Bot); err != nil {
+			return nil, err
+		}
+		username = request.Bot
+	}
+
+	keyID, key, err := utils.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	apiKey := &models.APIKey{
+		KeyID:     keyID,
+		KeyHash:   utils.HashToken(key),
+		Name:      name,
+		Username:  username,
+		CreatedBy: owner,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if request.ExpiresInDays > 0 {
+		expiresAt := apiKey.CreatedAt.Add(time.Duration(request.ExpiresInDays) * 24 * time.Hour)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := repo.InsertAPIKey(apiKey); err != nil {
+		return nil, err
+	}
+	logger.LogInfo("CreateAPIKey service :: ended, key " + keyID + " for " + username)
+	return &models.CreateAPIKeyResponse{Key: key, APIKey: apiKey}, nil
+}
+
+// GetAPIKeys returns the API keys owner created for themselves and their bots.
+func GetAPIKeys(owner string) ([]*models.APIKey, error) {
+	return repo.GetAPIKeysCreatedBy(owner)
+}
+
+// RevokeAPIKey revokes one of the keys owner created and closes the WebSocket connections
+// opened with it.
+func RevokeAPIKey(owner string, keyID string) error {
+	logger.LogInfo("RevokeAPIKey service :: started")
+	key, err := repo.RevokeAPIKey(keyID, owner)
+	if err != nil {
+		return err
+	}
+	utils.CloseSessionConnection(key.Username, utils.APIKeySessionID(keyID))
+	logger.LogInfo("RevokeAPIKey service :: ended")
+	return nil
+}
+
+// CreateBot creates a bot account managed by owner. Bots cannot log in with a password and
+// authenticate with the API keys their owner creates for them.
+func CreateBot(owner string, request *models.CreateBotRequest) (*models.BotResponse, error) {
+	logger.LogInfo("CreateBot service :: started")
+	username := strings.TrimSpace(request.Username)
+	if len(username) < minUsernameLength || strings.ContainsAny(username, " @:") {
+		return nil, errors.New("username must be at least 5 characters long without spaces, @ or :")
+	}
+	if strings.HasPrefix(username, models.DeletedUserPrefix) {
+		return nil, errors.New("usernames cannot start with " + models.DeletedUserPrefix)
+	}
+
+	// Bots never use their password, so it is random and unknown to anyone
+	password, err := utils.GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+	firstName := request.FirstName
+	if firstName == "" {
+		firstName = username
+	}
+
+	bot := &models.User{
+		Username:      username,
+		Email:         username + botEmailDomain,
+		EmailVerified: true,
+		Password:      string(hashedPassword),
+		FirstName:     firstName,
+		LastName:      request.LastName,
+		Role:          models.Client,
+		Type:          models.UserTypeBot,
+		BotOwner:      owner,
+	}
+	if err := repo.InsertUser(bot); err != nil {
+		logger.LogError("CreateBot service :: " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("CreateBot service :: ended, " + username + " owned by " + owner)
+	return &models.BotResponse{Username: bot.Username, FirstName: bot.FirstName, LastName: bot.LastName, BotOwner: owner}, nil
+}
+
+// GetBots returns the bots owner manages.
+func GetBots(owner string) ([]*models.BotResponse, error) {
+	return repo.GetBotsOwnedBy(owner)
+}
+
+// DeleteBot deletes one of owner's bots together with its API keys, connections and data.
+func DeleteBot(owner string, username string) error {
+	logger.LogInfo("DeleteBot service :: started")
+	if _, err := ownedBot(owner, username); err != nil {
+		return err
+	}
+	if err := DeleteAccount(username); err != nil {
+		return err
+	}
+	logger.LogInfo("DeleteBot service :: ended")
+	return nil
+}
+
+// ownedBot returns the bot named username if owner manages it.
+func ownedBot(owner string, username string) (*models.User, error) {
+	bot, err := repo.FetchUserByUsername(username)
+	if err != nil || bot.Type != models.UserTypeBot || bot.BotOwner != owner {
+		return nil, models.ErrBotNotFound
+	}
+	return bot, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"sort"
+	"time"
+)
+
+// defaultAuditRetentionDays is how long audit events are kept when AUDIT_RETENTION_DAYS is not set.
+const defaultAuditRetentionDays = 365
+
+// RecordAudit appends event to the audit log and writes it to app.log as an AUDIT: line.
+// A failure to store the event is logged but never fails the audited action.
+func RecordAudit(event *models.AuditEvent) {
+	now := time.Now().UTC()
+	event.Timestamp = now
+	event.ExpiresAt = now.AddDate(0, 0, envInt("AUDIT_RETENTION_DAYS", defaultAuditRetentionDays))
+	event.UserAgent = truncate(event.UserAgent, maxDeviceInfoLength)
+
+	line := string(event.Action) + " " + string(event.Outcome) + " : actor=" + event.Actor + " target=" + event.Target + " ip=" + event.IP
+	if event.Reason != "" {
+		line += " reason=" + event.Reason
+	}
+	keys := make([]string, 0, len(event.Details))
+	for key := range event.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		line += " " + key + "=" + event.Details[key]
+	}
+	logger.LogAudit(line)
+
+	if err := repo.InsertAuditEvent(event); err != nil {
+		logger.LogError("RecordAudit :: unable to store audit event " + err.Error())
+	}
+}
+
+// GetAuditEvents returns one page of the audit events matching query.
+func GetAuditEvents(query *models.AuditQuery) (*models.AuditPage, error) {
+	logger.LogInfo("GetAuditEvents service :: started")
+	page, err := repo.GetAuditEvents(query)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo("GetAuditEvents service :: ended")
+	return page, nil
+}
+
+// auditOutcome returns the outcome and failure reason of an action that returned err.
+func auditOutcome(err error) (models.AuditOutcome, string) {
+	if err != nil {
+		return models.AuditFailure, err.Error()
+	}
+	return models.AuditSuccess, ""
+}
+
+// auditLogin records a login attempt made with method, such as password or oidc. A login
+// answered with an MFA challenge is recorded as a success with mfa=required; completing the
+// challenge is recorded as a second login with method mfa.
+func auditLogin(username string, ip string, userAgent string, method string, resp *models.LoginResponse, err error) {
+	outcome, reason := auditOutcome(err)
+	details := map[string]string{"method": method}
+	if resp != nil {
+		username = resp.Username
+		if resp.MFARequired {
+			details["mfa"] = "required"
+		}
+	}
+	RecordAudit(&models.AuditEvent{
+		Actor:     username,
+		Action:    models.AuditLogin,
+		Target:    username,
+		IP:        ip,
+		UserAgent: userAgent,
+		Outcome:   outcome,
+		Reason:    reason,
+		Details:   details,
+	})
+}
@@ -5,11 +5,23 @@ import (
 	"real-time-chat-app/logger"
 	"real-time-chat-app/models"
 	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strings"
+	"time"
 
+	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// CreateUser handles the business logic for creating a user
+const webSocketTicketTTL = 60 * time.Second
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+)
+
+// CreateUser handles the business logic for creating a user. New accounts start unverified
+// and are emailed a verification link.
 func CreateUser(user *models.User) error {
 	logger.LogInfo("CreateUser service :: started")
 	// Hash the password
@@ -19,35 +31,244 @@ func CreateUser(user *models.User) error {
 		return errors.New("failed to hash password")
 	}
 	user.Password = string(hashedPassword)
+	// Roles are only assigned by admins, see ChangeUserRole and BootstrapAdmin
+	user.Role = models.Client
+	now := time.Now().UTC()
+	user.EmailVerified = false
+	user.VerificationSentAt = &now
 
 	// Delegate to database layer
 	err = repo.InsertUser(user)
 	if err != nil {
 		return err
 	}
+	if err := sendVerificationEmail(user); err != nil {
+		// The user can ask for a new link with /auth/verify/resend
+		logger.LogError("CreateUser service :: " + err.Error())
+	}
 	logger.LogInfo("CreateUser service :: ended")
 	return nil
 }
 
-func LoginUser(user *models.LoginUser) (string, string, error) {
+// maxDeviceInfoLength caps the client supplied device name and user agent stored with a session.
+const maxDeviceInfoLength = 256
+
+// LoginUser checks the credentials and starts a new session for the device the user logged
+// in from, returning its access and refresh tokens. Users with two-factor authentication get
+// an MFA challenge instead, to be completed with CompleteMFALogin. Failed logins are counted
+// per username and IP, and logins are throttled and locked out after too many.
+func LoginUser(user *models.LoginUser, ip string, userAgent string) (resp *models.LoginResponse, err error) {
+	defer func() { auditLogin(user.Username, ip, userAgent, "password", resp, err) }()
+	if err := checkLoginAllowed(user.Username, ip); err != nil {
+		return nil, err
+	}
+
+	session := &models.JwtSession{
+		DeviceName: truncate(strings.TrimSpace(user.DeviceName), maxDeviceInfoLength),
+		IP:         ip,
+		UserAgent:  truncate(userAgent, maxDeviceInfoLength),
+	}
 
 	// Delegate to database layer
 	logger.LogInfo("LoginUser service :: fetching IsLoggedinUserExist")
-	token, refreshtoken, err := repo.IsLoggedinUserExist(user)
+	resp, err = repo.IsLoggedinUserExist(user, session)
+	if err == models.ErrInvalidCredentials {
+		recordLoginFailure(user.Username, ip)
+		return nil, err
+	}
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	if !resp.MFARequired {
+		clearLoginFailures(user.Username)
 	}
 	logger.LogInfo("LoginUser service ::  JWT token collected .")
-	return token, refreshtoken, nil
+	return resp, nil
 }
 
-func LogoutUser(username string) error {
+// LogoutUser ends the session the request was made with, leaving the user's other devices
+// logged in.
+func LogoutUser(username string, sessionID string) error {
 	logger.LogInfo(" LogoutUser service :: started")
-	err := repo.LogoutUser(username)
+	err := repo.DeleteJwtSession(username, sessionID)
 	if err != nil {
 		logger.LogInfo("LogoutUser :: ailed to logout the user")
 		return errors.New("failed to logout the user")
 	}
+	utils.CloseSessionConnection(username, sessionID)
 	logger.LogInfo("LogoutUser service :: ended")
 	return nil
 }
+
+// GetSessions returns the active sessions of the user, marking the one the request was made with.
+func GetSessions(username string, currentSessionID string) ([]*models.JwtSession, error) {
+	logger.LogInfo("GetSessions service :: started")
+	sessions, err := repo.GetJwtSessionsForUser(username)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.Current = session.SessionID == currentSessionID
+	}
+	logger.LogInfo("GetSessions service :: ended")
+	return sessions, nil
+}
+
+// RevokeSession ends one session of the user and closes its WebSocket connections.
+func RevokeSession(username string, sessionID string) error {
+	logger.LogInfo("RevokeSession service :: started")
+	if err := repo.DeleteJwtSession(username, sessionID); err != nil {
+		return err
+	}
+	utils.CloseSessionConnection(username, sessionID)
+	logger.LogInfo("RevokeSession service :: ended")
+	return nil
+}
+
+// LogoutOtherSessions ends every session of the user except the current one and returns the
+// number of sessions ended.
+func LogoutOtherSessions(username string, currentSessionID string) (int, error) {
+	logger.LogInfo("LogoutOtherSessions service :: started")
+	sessionIDs, err := repo.DeleteOtherJwtSessions(username, currentSessionID)
+	if err != nil {
+		return 0, err
+	}
+	for _, sessionID := range sessionIDs {
+		utils.CloseSessionConnection(username, sessionID)
+	}
+	logger.LogInfo("LogoutOtherSessions service :: ended")
+	return len(sessionIDs), nil
+}
+
+// IssueWebSocketTicket returns a short-lived token that authenticates a single /ws upgrade
+// for clients that cannot send an Authorization header, and its lifetime in seconds. The
+// ticket ID is stored and consumed by the upgrade, so a ticket leaked through a logged URL
+// cannot be used again.
+func IssueWebSocketTicket(username string, sessionID string) (string, int, error) {
+	logger.LogInfo("IssueWebSocketTicket service :: started")
+	ticketID, err := utils.GenerateSecureToken()
+	if err != nil {
+		return "", 0, errors.New("unable to issue websocket ticket")
+	}
+	now := time.Now().UTC()
+	err = repo.InsertUserToken(&models.UserToken{
+		TokenHash: utils.HashToken(ticketID),
+		Username:  username,
+		Purpose:   models.TokenPurposeWebSocketTicket,
+		CreatedAt: now,
+		ExpiresAt: now.Add(webSocketTicketTTL),
+	})
+	if err != nil {
+		return "", 0, errors.New("unable to issue websocket ticket")
+	}
+
+	claims := jwt.MapClaims{
+		"username": username,
+		"sid":      sessionID,
+		"jti":      ticketID,
+		"typ":      utils.TokenTypeWSTicket,
+		"exp":      now.Add(webSocketTicketTTL).Unix(),
+	}
+	ticket, err := utils.SignToken(claims)
+	if err != nil {
+		logger.LogError("IssueWebSocketTicket service :: unable to sign ticket " + err.Error())
+		return "", 0, errors.New("unable to issue websocket ticket")
+	}
+	logger.LogInfo("IssueWebSocketTicket service :: ended")
+	return ticket, int(webSocketTicketTTL.Seconds()), nil
+}
+
+// RefreshSession exchanges the current refresh token of a session for a new access and
+// refresh token pair. Presenting a refresh token that was already exchanged means it was
+// leaked, so the whole session is revoked and the user has to log in again. Any other
+// refresh token that is not the current one is just rejected.
+func RefreshSession(refreshToken string) (*models.LoginResponse, error) {
+	logger.LogInfo("RefreshSession service :: started")
+	claims, err := utils.ParseToken(refreshToken)
+	if err != nil || utils.TokenType(claims) != utils.TokenTypeRefresh {
+		return nil, ErrInvalidRefreshToken
+	}
+	username, _ := claims["username"].(string)
+	sessionID, _ := claims["sid"].(string)
+	if username == "" || sessionID == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := repo.FetchJwtSession(sessionID)
+	if err != nil || session.Username != username {
+		// The session was logged out or revoked
+		logger.LogError("RefreshSession service :: no session for the refresh token of " + username)
+		return nil, ErrInvalidRefreshToken
+	}
+	if session.RefreshToken != refreshToken {
+		if !refreshTokenExchanged(session, refreshToken) {
+			logger.LogError("RefreshSession service :: refresh token of " + username + " is neither current nor recently exchanged")
+			return nil, ErrInvalidRefreshToken
+		}
+		revokeCompromisedSession(username, sessionID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user.Suspended {
+		return nil, models.ErrAccountSuspended
+	}
+	// Scheduling the deletion ends every session, this catches a session that was missed
+	if user.DeletionScheduledAt != nil {
+		return nil, models.ErrAccountPendingDeletion
+	}
+	token, newRefreshToken, err := repo.GenerateTokenPair(user, sessionID)
+	if err != nil {
+		return nil, errors.New("unable to issue tokens")
+	}
+
+	rotated, err := repo.RotateJwtTokens(sessionID, refreshToken, token, newRefreshToken)
+	if err != nil {
+		return nil, errors.New("unable to store tokens")
+	}
+	if !rotated {
+		// Another request exchanged the same token first
+		revokeCompromisedSession(username, sessionID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	logger.LogInfo("RefreshSession service :: ended")
+	return &models.LoginResponse{
+		Username:     username,
+		Token:        token,
+		RefreshToken: newRefreshToken,
+	}, nil
+}
+
+// refreshTokenExchanged reports whether refreshToken is among the recently exchanged refresh
+// tokens of the session.
+func refreshTokenExchanged(session *models.JwtSession, refreshToken string) bool {
+	hash := utils.HashToken(refreshToken)
+	for _, used := range session.UsedRefreshTokens {
+		if used == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// revokeCompromisedSession ends the session after refresh token reuse. The user's other
+// sessions are left alone.
+func revokeCompromisedSession(username string, sessionID string) {
+	logger.LogError("revokeCompromisedSession :: refresh token reuse detected for " + username + ", revoking session " + sessionID)
+	if err := repo.DeleteJwtSession(username, sessionID); err != nil {
+		logger.LogError("revokeCompromisedSession :: " + err.Error())
+	}
+	utils.CloseSessionConnection(username, sessionID)
+}
+
+// truncate shortens s to at most max bytes.
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return strings.ToValidUTF8(s[:max], "")
+	}
+	return s
+}
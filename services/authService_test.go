@@ -0,0 +1,80 @@
+package services
+
+import (
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/repositary/repotest"
+	"real-time-chat-app/utils"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// refreshTokens returns n refresh tokens of the session of alice, oldest first.
+func refreshTokens(t *testing.T, n int) []string {
+	t.Helper()
+	t.Setenv("JWT_KEYS_DIR", t.TempDir())
+	if err := utils.InitKeyring(); err != nil {
+		t.Fatalf("InitKeyring: %v", err)
+	}
+	tokens := make([]string, n)
+	for i := range tokens {
+		_, refreshToken, err := repo.GenerateTokenPair(&models.User{Username: "alice", Role: models.Client}, "session-alice")
+		if err != nil {
+			t.Fatalf("GenerateTokenPair: %v", err)
+		}
+		tokens[i] = refreshToken
+	}
+	return tokens
+}
+
+func TestRefreshSessionDetectsReuse(t *testing.T) {
+	tokens := refreshTokens(t, 3)
+	// tokens[0] was never recorded as exchanged, tokens[1] was, tokens[2] is current
+	session := &models.JwtSession{
+		SessionID:         "session-alice",
+		Username:          "alice",
+		RefreshToken:      tokens[2],
+		UsedRefreshTokens: []string{utils.HashToken(tokens[1])},
+	}
+
+	repotest.Run(t, "exchanged token", func(mt *mtest.T) {
+		mt.AddMockResponses(repotest.Cursor(session), repotest.Written(1))
+		if _, err := RefreshSession(tokens[1]); err != ErrRefreshTokenReused {
+			mt.Fatalf("RefreshSession = %v, want %v", err, ErrRefreshTokenReused)
+		}
+		if deletes := repotest.Commands(mt, "delete", "MONGO_TABLE_JWT_STORE"); len(deletes) != 1 {
+			mt.Fatalf("replaying an exchanged token sent %d session deletes, want 1", len(deletes))
+		}
+	})
+
+	repotest.Run(t, "unknown token", func(mt *mtest.T) {
+		mt.AddMockResponses(repotest.Cursor(session))
+		if _, err := RefreshSession(tokens[0]); err != ErrInvalidRefreshToken {
+			mt.Fatalf("RefreshSession = %v, want %v", err, ErrInvalidRefreshToken)
+		}
+		if deletes := repotest.Commands(mt, "delete", "MONGO_TABLE_JWT_STORE"); len(deletes) != 0 {
+			mt.Fatalf("a token that was not exchanged revoked the session: %v", deletes)
+		}
+	})
+}
+
+func TestRefreshSessionRefusesAccountPendingDeletion(t *testing.T) {
+	tokens := refreshTokens(t, 1)
+	session := &models.JwtSession{SessionID: "session-alice", Username: "alice", RefreshToken: tokens[0]}
+	scheduled := time.Now().Add(24 * time.Hour)
+
+	repotest.Run(t, "pending deletion", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			repotest.Cursor(session),
+			repotest.Cursor(&models.User{Username: "alice", Role: models.Client, DeletionScheduledAt: &scheduled}),
+		)
+		if _, err := RefreshSession(tokens[0]); err != models.ErrAccountPendingDeletion {
+			mt.Fatalf("RefreshSession = %v, want %v", err, models.ErrAccountPendingDeletion)
+		}
+		if updates := repotest.Commands(mt, "update", "MONGO_TABLE_JWT_STORE"); len(updates) != 0 {
+			mt.Fatalf("the tokens of an account pending deletion were rotated: %v", updates)
+		}
+	})
+}
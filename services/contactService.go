@@ -5,17 +5,26 @@ import (
 	"real-time-chat-app/logger"
 	"real-time-chat-app/models"
 	repo "real-time-chat-app/repositary"
-
-	"github.com/golang-jwt/jwt"
 )
 
-func HandleContactRequest(contactRequest *models.ContactRequest, claims jwt.MapClaims) (string, error) {
+func HandleContactRequest(contactRequest *models.ContactRequest) (string, error) {
 	logger.LogInfo("HandleContactRequest :: starting")
-	responseString, err := repo.HandleContactRequest(contactRequest, claims)
+	if contactRequest.Status == models.StatusPending {
+		if err := requireVerified(contactRequest.FromUserID, models.VerifiedActionContact); err != nil {
+			logger.LogError("HandleContactRequest :: " + err.Error())
+			return "", err
+		}
+	}
+	if err := checkNotBlocked(contactRequest.FromUserID, contactRequest.ToUserID); err != nil {
+		logger.LogError("HandleContactRequest :: " + err.Error())
+		return "", err
+	}
+	responseString, err := repo.HandleContactRequest(contactRequest)
 	if err != nil {
 		logger.LogError("Error from HandleContactRequest repo ")
 		return responseString, err
 	}
+	publishEvent(contactRequest.ToUserID, models.EventContactRequest, contactRequest)
 	logger.LogInfo("HandleContactRequest :: exiting")
 	return responseString, err
 }
@@ -42,3 +51,15 @@ func UpdateContact(contactRequest *models.ContactActionRequest) (string, error)
 	logger.LogInfo("UpdateContact :: ending")
 	return responseString, err
 }
+
+// GetBlockedContacts returns the usernames the user has blocked.
+func GetBlockedContacts(username string) ([]string, error) {
+	logger.LogInfo("GetBlockedContacts :: starting")
+	blocked, err := repo.GetBlockedContacts(username)
+	if err != nil {
+		logger.LogError("GetBlockedContacts :: error in fetching the blocked contacts " + err.Error())
+		return nil, errors.New(" error in fetching the blocked contacts ")
+	}
+	logger.LogInfo("GetBlockedContacts :: ending")
+	return blocked, nil
+}
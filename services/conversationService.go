@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"time"
+)
+
+func CreateConversation(request *models.CreateConversationRequest, username string) (*models.Conversation, error) {
+	logger.LogInfo("CreateConversation service :: started")
+	now := time.Now().UTC()
+
+	conversation := &models.Conversation{
+		ID:        utils.GenerateUUID(),
+		Name:      request.Name,
+		Owner:     username,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Members: []models.ConversationMember{
+			{Username: username, Role: models.ConversationRoleOwner, JoinedAt: now},
+		},
+	}
+	for _, member := range request.Members {
+		if conversation.Member(member) != nil {
+			continue
+		}
+		conversation.Members = append(conversation.Members, models.ConversationMember{
+			Username: member,
+			Role:     models.ConversationRoleMember,
+			JoinedAt: now,
+		})
+	}
+
+	err := repo.CreateConversation(conversation)
+	if err != nil {
+		logger.LogError("CreateConversation service :: error " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("CreateConversation service :: ended")
+	return conversation, nil
+}
+
+func GetConversations(username string) ([]*models.Conversation, error) {
+	logger.LogInfo("GetConversations service :: started")
+	conversations, err := repo.GetConversationsForUser(username)
+	if err != nil {
+		logger.LogError("GetConversations service :: error " + err.Error())
+		return nil, errors.New("error in fetching the conversations")
+	}
+	logger.LogInfo("GetConversations service :: ended")
+	return conversations, nil
+}
+
+func RenameConversation(request *models.RenameConversationRequest, username string) (*models.Conversation, error) {
+	logger.LogInfo("RenameConversation service :: started")
+	conversation, err := repo.FetchConversation(request.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !conversation.CanManage(username) {
+		logger.LogError("RenameConversation service :: " + username + " is not an owner or admin")
+		return nil, errors.New("only the owner or an admin can rename the conversation")
+	}
+
+	err = repo.RenameConversation(conversation.ID, request.Name)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo("RenameConversation service :: ended")
+	return repo.FetchConversation(conversation.ID)
+}
+
+func AddConversationMembers(request *models.ConversationMembersRequest, username string) (*models.Conversation, error) {
+	logger.LogInfo("AddConversationMembers service :: started")
+	conversation, err := repo.FetchConversation(request.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !conversation.CanManage(username) {
+		logger.LogError("AddConversationMembers service :: " + username + " is not an owner or admin")
+		return nil, errors.New("only the owner or an admin can add members")
+	}
+
+	now := time.Now().UTC()
+	var members []models.ConversationMember
+	for _, member := range request.Members {
+		if conversation.Member(member) != nil {
+			continue
+		}
+		members = append(members, models.ConversationMember{
+			Username: member,
+			Role:     models.ConversationRoleMember,
+			JoinedAt: now,
+		})
+	}
+	if len(members) == 0 {
+		return nil, errors.New("all users are already members of the conversation")
+	}
+
+	err = repo.AddConversationMembers(conversation.ID, members)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo("AddConversationMembers service :: ended")
+	return repo.FetchConversation(conversation.ID)
+}
+
+func RemoveConversationMembers(request *models.ConversationMembersRequest, username string) (*models.Conversation, error) {
+	logger.LogInfo("RemoveConversationMembers service :: started")
+	conversation, err := repo.FetchConversation(request.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !conversation.CanManage(username) {
+		logger.LogError("RemoveConversationMembers service :: " + username + " is not an owner or admin")
+		return nil, errors.New("only the owner or an admin can remove members")
+	}
+
+	for _, member := range request.Members {
+		target := conversation.Member(member)
+		if target == nil {
+			return nil, errors.New(member + " is not a member of the conversation")
+		}
+		if target.Role == models.ConversationRoleOwner {
+			return nil, errors.New("the owner cannot be removed from the conversation")
+		}
+		if target.Role == models.ConversationRoleAdmin && conversation.Owner != username {
+			return nil, errors.New("only the owner can remove an admin")
+		}
+	}
+
+	err = repo.RemoveConversationMembers(conversation.ID, request.Members)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo("RemoveConversationMembers service :: ended")
+	return repo.FetchConversation(conversation.ID)
+}
+
+func UpdateConversationMemberRole(request *models.ConversationRoleRequest, username string) (*models.Conversation, error) {
+	logger.LogInfo("UpdateConversationMemberRole service :: started")
+	conversation, err := repo.FetchConversation(request.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.Owner != username {
+		logger.LogError("UpdateConversationMemberRole service :: " + username + " is not the owner")
+		return nil, errors.New("only the owner can change member roles")
+	}
+	if request.Username == username {
+		return nil, errors.New("the owner cannot change their own role")
+	}
+
+	err = repo.UpdateConversationMemberRole(conversation.ID, request.Username, request.Role)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo("UpdateConversationMemberRole service :: ended")
+	return repo.FetchConversation(conversation.ID)
+}
+
+// LeaveConversation removes username from the conversation. When the owner leaves,
+// ownership passes to the longest-standing admin, or failing that the longest-standing
+// member. The conversation is deleted once its last member has left.
+func LeaveConversation(request *models.LeaveConversationRequest, username string) error {
+	logger.LogInfo("LeaveConversation service :: started")
+	conversation, err := repo.FetchConversation(request.ConversationID)
+	if err != nil {
+		return err
+	}
+	if conversation.Member(username) == nil {
+		return errors.New("you are not a member of the conversation")
+	}
+
+	if len(conversation.Members) == 1 {
+		logger.LogInfo("LeaveConversation service :: last member left, deleting " + conversation.ID)
+		return repo.DeleteConversation(conversation.ID)
+	}
+
+	if conversation.Owner == username {
+		var successor *models.ConversationMember
+		for i := range conversation.Members {
+			member := &conversation.Members[i]
+			if member.Username == username {
+				continue
+			}
+			if successor == nil || (member.Role == models.ConversationRoleAdmin && successor.Role != models.ConversationRoleAdmin) {
+				successor = member
+			}
+		}
+		err = repo.UpdateConversationMemberRole(conversation.ID, successor.Username, models.ConversationRoleOwner)
+		if err != nil {
+			return err
+		}
+		logger.LogInfo("LeaveConversation service :: ownership transferred to " + successor.Username)
+	}
+
+	err = repo.RemoveConversationMembers(conversation.ID, []string{username})
+	if err != nil {
+		return err
+	}
+	logger.LogInfo("LeaveConversation service :: ended")
+	return nil
+}
+
+func GetConversationMessages(conversationID string, username string, page *models.MessagePageRequest) (*models.MessagePage, error) {
+	logger.LogInfo("GetConversationMessages service :: started")
+	conversation, err := repo.FetchConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.Member(username) == nil {
+		return nil, errors.New("you are not a member of the conversation")
+	}
+
+	messages, err := repo.GetConversationMessages(conversation.ID, page)
+	if err != nil {
+		logger.LogError("GetConversationMessages service :: error " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("GetConversationMessages service :: ended")
+	return messages, nil
+}
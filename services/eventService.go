@@ -0,0 +1,191 @@
+package services
+
+import (
+	"encoding/json"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"sync"
+	"time"
+)
+
+// maxReplayEvents is the most events replayed on reconnect. Clients further behind are told
+// to resync over REST instead.
+const maxReplayEvents = 1000
+
+var (
+	publishMu  sync.Mutex
+	publishing = make(map[string]*publishLock) // Map of recipient to the lock ordering their events
+
+	fanOutMu sync.Mutex
+	fanOuts  = make(map[string][]func()) // Map of conversation to the fan-outs waiting to run
+)
+
+// publishLock is held while an event of the recipient is numbered and sent. It is dropped
+// once no publish holds or waits for it.
+type publishLock struct {
+	mu      sync.Mutex
+	holders int
+}
+
+// lockRecipient waits until no other event of the recipient is being published and returns
+// the function releasing the recipient again.
+func lockRecipient(recipientID string) func() {
+	publishMu.Lock()
+	lock := publishing[recipientID]
+	if lock == nil {
+		lock = &publishLock{}
+		publishing[recipientID] = lock
+	}
+	lock.holders++
+	publishMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		publishMu.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(publishing, recipientID)
+		}
+		publishMu.Unlock()
+	}
+}
+
+// publishEvent stores an event for the recipient under its next sequence number, so it can
+// be replayed if they are offline, and sends it to their open connections. The events of a
+// recipient are numbered and sent one at a time, so their connections receive them in
+// sequence order.
+func publishEvent(recipientID string, eventType string, payload interface{}) {
+	event := utils.NewEvent(eventType, payload)
+	defer lockRecipient(recipientID)()
+
+	seq, err := repo.NextEventSeq(recipientID)
+	if err != nil {
+		logger.LogError("publishEvent :: event will not be replayed for " + recipientID + " " + err.Error())
+		utils.BroadcastEvent(recipientID, event)
+		return
+	}
+	event.Seq = seq
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		logger.LogError("publishEvent :: unable to serialize event " + err.Error())
+		return
+	}
+	err = repo.SaveEvent(&models.UserEvent{
+		Username:  recipientID,
+		Seq:       seq,
+		Type:      eventType,
+		Data:      string(data),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		logger.LogError("publishEvent :: event will not be replayed for " + recipientID + " " + err.Error())
+	}
+	utils.BroadcastEvent(recipientID, event)
+}
+
+// publishToConversation publishes an event of a group conversation to each recipient in
+// the background, so the request does not wait on a round trip per member. The fan-outs of
+// a conversation run one at a time in the order they were queued, so members receive its
+// events in the order they happened.
+func publishToConversation(conversationID string, recipients []string, eventType string, payload interface{}) {
+	fanOut := func() {
+		for _, recipient := range recipients {
+			publishEvent(recipient, eventType, payload)
+		}
+	}
+	fanOutMu.Lock()
+	queue, running := fanOuts[conversationID]
+	fanOuts[conversationID] = append(queue, fanOut)
+	fanOutMu.Unlock()
+	if !running {
+		go runFanOuts(conversationID)
+	}
+}
+
+// runFanOuts runs the queued fan-outs of the conversation until none are left.
+func runFanOuts(conversationID string) {
+	for {
+		fanOutMu.Lock()
+		queue := fanOuts[conversationID]
+		if len(queue) == 0 {
+			delete(fanOuts, conversationID)
+			fanOutMu.Unlock()
+			return
+		}
+		fanOuts[conversationID] = queue[1:]
+		fanOutMu.Unlock()
+		queue[0]()
+	}
+}
+
+// publishMessageEvent publishes an event about a message to its recipients. Direct messages
+// are published before returning, group messages by publishToConversation.
+func publishMessageEvent(conversationID string, recipients []string, eventType string, payload interface{}) {
+	if conversationID != "" {
+		publishToConversation(conversationID, recipients, eventType, payload)
+		return
+	}
+	for _, recipient := range recipients {
+		publishEvent(recipient, eventType, payload)
+	}
+}
+
+// ResumeEvents replays the events the client missed after sequence number since, or none
+// when since is negative, followed by a ready event, and then switches the client to live
+// delivery. A resync event is sent instead of the replay when the missed events are no
+// longer retained or too many to replay.
+func ResumeEvents(client *utils.Client, since int64) error {
+	logger.LogInfo("ResumeEvents service :: started")
+	current, err := repo.CurrentEventSeq(client.Username)
+	if err != nil {
+		return err
+	}
+
+	// Live events up to replayed are already covered by the replay and are dropped
+	var replayed int64
+	readySeq := current
+	if since >= 0 {
+		events, err := repo.GetEventsSince(client.Username, since, maxReplayEvents+1)
+		if err != nil {
+			return err
+		}
+
+		missing := since < current && (len(events) == 0 || events[0].Seq > since+1)
+		if since > current || missing || len(events) > maxReplayEvents {
+			logger.LogInfo("ResumeEvents service :: resync required for " + client.Username)
+			resync := &models.ResyncPayload{}
+			if len(events) > 0 {
+				resync.OldestSeq = events[0].Seq
+			}
+			replayEvent(client, utils.NewEvent(models.EventResync, resync))
+			replayed = current
+		} else {
+			replayed = since
+			for _, event := range events {
+				if !client.Replay([]byte(event.Data)) {
+					return nil
+				}
+				replayed = event.Seq
+			}
+			readySeq = replayed
+		}
+	}
+
+	replayEvent(client, utils.NewEvent(models.EventReady, &models.ReadyPayload{Seq: readySeq}))
+	client.Resume(replayed)
+	logger.LogInfo("ResumeEvents service :: ended")
+	return nil
+}
+
+func replayEvent(client *utils.Client, event *models.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		logger.LogError("replayEvent :: unable to serialize event " + err.Error())
+		return
+	}
+	client.Replay(data)
+}
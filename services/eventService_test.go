@@ -0,0 +1,41 @@
+package services
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLockRecipientSerializesEachRecipient(t *testing.T) {
+	var wg sync.WaitGroup
+	inside := map[string]int{}
+	var insideMu sync.Mutex
+	for _, recipient := range []string{"alice", "bob"} {
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(recipient string) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					unlock := lockRecipient(recipient)
+					insideMu.Lock()
+					inside[recipient]++
+					if inside[recipient] > 1 {
+						t.Errorf("two publishes for %s at once", recipient)
+					}
+					insideMu.Unlock()
+
+					insideMu.Lock()
+					inside[recipient]--
+					insideMu.Unlock()
+					unlock()
+				}
+			}(recipient)
+		}
+	}
+	wg.Wait()
+
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	if len(publishing) != 0 {
+		t.Fatalf("%d recipient locks left after every publish ended", len(publishing))
+	}
+}
@@ -0,0 +1,419 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"real-time-chat-app/config"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultExportTTL is how long a data export can be downloaded unless EXPORT_TTL_HOURS
+	// says otherwise.
+	defaultExportTTL = 24 * time.Hour
+	// exportBuildTimeout is how long an export may stay pending before it is reported failed.
+	exportBuildTimeout = time.Hour
+	// maxExportMediaBytes bounds the size of a single media file included in an export.
+	maxExportMediaBytes = 100 << 20
+)
+
+var ErrExportNotFound = errors.New("the export does not exist or has expired")
+
+// RequestExport starts building an archive of the user's data in the background. The user is
+// sent an export.ready event with a download link once it is ready, or export.failed.
+func RequestExport(username string) (*models.Export, error) {
+	logger.LogInfo("RequestExport service :: started")
+	export := &models.Export{
+		ID:        utils.GenerateUUID(),
+		Username:  username,
+		Status:    models.ExportPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := repo.InsertExport(export); err != nil {
+		return nil, err
+	}
+	go buildExport(export)
+	logger.LogInfo("RequestExport service :: ended")
+	return export, nil
+}
+
+// GetExports returns the exports of the user, newest first.
+func GetExports(username string) ([]*models.Export, error) {
+	return repo.GetExportsOfUser(username)
+}
+
+// OpenExport returns the ready export downloaded with token and the path of its archive.
+func OpenExport(token string) (*models.Export, string, error) {
+	export, err := repo.FetchReadyExport(utils.HashToken(token))
+	if err != nil {
+		return nil, "", ErrExportNotFound
+	}
+	archive := exportPath(export.ID)
+	if _, err := os.Stat(archive); err != nil {
+		logger.LogError("OpenExport service :: archive of " + export.ID + " is missing " + err.Error())
+		return nil, "", ErrExportNotFound
+	}
+	return export, archive, nil
+}
+
+func buildExport(export *models.Export) {
+	logger.LogInfo("buildExport :: started " + export.ID)
+	ttl := envDuration("EXPORT_TTL_HOURS", time.Hour, defaultExportTTL)
+	archive := exportPath(export.ID)
+	size, err := writeExportArchive(export.Username, archive+".tmp")
+	if err == nil {
+		err = os.Rename(archive+".tmp", archive)
+	}
+	var token string
+	var expiresAt time.Time
+	if err == nil {
+		token, err = utils.GenerateSecureToken()
+	}
+	if err == nil {
+		expiresAt = time.Now().UTC().Add(ttl)
+		err = repo.CompleteExport(export.ID, utils.HashToken(token), size, expiresAt)
+	}
+	if err != nil {
+		logger.LogError("buildExport :: export " + export.ID + " of " + export.Username + " failed " + err.Error())
+		os.Remove(archive + ".tmp")
+		os.Remove(archive)
+		reason := "unable to build the export"
+		if failErr := repo.FailExport(export.ID, reason, time.Now().UTC().Add(ttl)); failErr != nil {
+			logger.LogError("buildExport :: " + failErr.Error())
+		}
+		publishEvent(export.Username, models.EventExportFailed, &models.ExportFailedPayload{ExportID: export.ID, Error: reason})
+		return
+	}
+	publishEvent(export.Username, models.EventExportReady, &models.ExportReadyPayload{
+		ExportID:    export.ID,
+		DownloadURL: exportDownloadLink(token),
+		ExpiresAt:   expiresAt,
+	})
+	logger.LogInfo("buildExport :: ended " + export.ID)
+}
+
+// exportChatLink is a chat listed on the index page of an export.
+type exportChatLink struct {
+	Title string
+	Path  string
+	Count int
+}
+
+// exportMessageLine is a message as shown on the page of a chat.
+type exportMessageLine struct {
+	SenderID  string
+	Timestamp string
+	Edited    bool
+	Content   string
+	Media     string
+}
+
+// writeExportArchive writes the ZIP archive of the user's data to file and returns its size.
+// It holds profile.json, contacts.json, each direct chat and group conversation as JSON and
+// HTML under conversations/, the Cloudinary media of their messages under media/ and an
+// index.html to browse it all.
+func writeExportArchive(username string, file string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	archive := zip.NewWriter(out)
+
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return 0, err
+	}
+	profile := &models.ExportProfile{User: user, LinkedAccounts: user.OIDCIdentities}
+	if err := writeExportJSON(archive, "profile.json", profile); err != nil {
+		return 0, err
+	}
+	contacts, err := repo.GetContactsOfUser(username)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeExportJSON(archive, "contacts.json", contacts); err != nil {
+		return 0, err
+	}
+
+	media := map[string]string{}
+	var chats []exportChatLink
+	peers, err := repo.GetDirectChatPeers(username)
+	if err != nil {
+		return 0, err
+	}
+	for _, peer := range peers {
+		messages, err := repo.GetChatHistory(utils.CanonicalChatID(username, peer))
+		if err != nil {
+			return 0, err
+		}
+		chat := &models.ExportChat{With: peer, Messages: messages}
+		link, err := writeExportChat(archive, "conversations/direct/"+exportFileName(peer), "Chat with "+peer, chat, media)
+		if err != nil {
+			return 0, err
+		}
+		chats = append(chats, *link)
+	}
+	conversations, err := repo.GetConversationsForUser(username)
+	if err != nil {
+		return 0, err
+	}
+	for _, conversation := range conversations {
+		messages, err := repo.GetChatHistory(conversation.ID)
+		if err != nil {
+			return 0, err
+		}
+		title := conversation.Name
+		if title == "" {
+			title = "Conversation " + conversation.ID
+		}
+		chat := &models.ExportChat{Conversation: conversation, Messages: messages}
+		link, err := writeExportChat(archive, "conversations/groups/"+exportFileName(conversation.ID), title, chat, media)
+		if err != nil {
+			return 0, err
+		}
+		chats = append(chats, *link)
+	}
+
+	var missing []string
+	for mediaURL, name := range media {
+		if name == "" {
+			missing = append(missing, mediaURL)
+		}
+	}
+	if len(missing) > 0 {
+		if err := writeExportJSON(archive, "media/missing.json", missing); err != nil {
+			return 0, err
+		}
+	}
+	entry, err := archive.Create("index.html")
+	if err != nil {
+		return 0, err
+	}
+	err = exportIndexTemplate.Execute(entry, map[string]interface{}{
+		"Username":   username,
+		"ExportedAt": time.Now().UTC().Format(time.RFC3339),
+		"Chats":      chats,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return 0, err
+	}
+	info, err := out.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// writeExportChat writes a chat as base.json and base.html, adding the media of its messages
+// not added yet. media maps every uploaded media URL seen so far to its file in the archive,
+// or to "" when it could not be added.
+func writeExportChat(archive *zip.Writer, base string, title string, chat *models.ExportChat, media map[string]string) (*exportChatLink, error) {
+	chat.MediaFiles = map[string]string{}
+	lines := make([]exportMessageLine, 0, len(chat.Messages))
+	for _, message := range chat.Messages {
+		line := exportMessageLine{
+			SenderID:  message.SenderID,
+			Timestamp: message.Timestamp,
+			Edited:    message.EditedAt != "",
+			Content:   message.Content,
+			Media:     message.MediaURL,
+		}
+		// Only files the server uploaded are fetched; any other media URL stays a link, so an
+		// export cannot pull in files of other accounts
+		if message.MediaURL != "" && message.Media != nil {
+			name, seen := media[message.MediaURL]
+			if !seen {
+				name = addExportMedia(archive, message.MediaURL)
+				media[message.MediaURL] = name
+			}
+			if name != "" {
+				chat.MediaFiles[message.MediaURL] = name
+				line.Media = "../../" + name
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	if err := writeExportJSON(archive, base+".json", chat); err != nil {
+		return nil, err
+	}
+	entry, err := archive.Create(base + ".html")
+	if err != nil {
+		return nil, err
+	}
+	err = exportChatTemplate.Execute(entry, map[string]interface{}{"Title": title, "Messages": lines})
+	if err != nil {
+		return nil, err
+	}
+	return &exportChatLink{Title: title, Path: base + ".html", Count: len(chat.Messages)}, nil
+}
+
+// addExportMedia downloads an uploaded media file into the archive and returns its name
+// there, or "" when it is not hosted on Cloudinary, too large or cannot be downloaded.
+func addExportMedia(archive *zip.Writer, mediaURL string) string {
+	body, err := config.OpenMedia(mediaURL)
+	if err != nil {
+		logger.LogInfo("addExportMedia :: skipping " + mediaURL + " " + err.Error())
+		return ""
+	}
+	defer body.Close()
+
+	// Buffer the file so one that turns out too large leaves no partial entry behind
+	tmp, err := os.CreateTemp("", "export-media-*")
+	if err != nil {
+		logger.LogError("addExportMedia :: " + err.Error())
+		return ""
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, io.LimitReader(body, maxExportMediaBytes+1))
+	if err != nil || size > maxExportMediaBytes {
+		logger.LogError("addExportMedia :: unable to download " + mediaURL)
+		return ""
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+
+	name := "media/" + utils.HashToken(mediaURL)[:16]
+	if parsed, err := url.Parse(mediaURL); err == nil {
+		name += path.Ext(parsed.Path)
+	}
+	entry, err := archive.Create(name)
+	if err != nil {
+		logger.LogError("addExportMedia :: " + err.Error())
+		return ""
+	}
+	if _, err := io.Copy(entry, tmp); err != nil {
+		logger.LogError("addExportMedia :: " + err.Error())
+		return ""
+	}
+	return name
+}
+
+func writeExportJSON(archive *zip.Writer, name string, value interface{}) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// exportFileName makes a username or conversation ID safe to use as a file name.
+func exportFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.TrimLeft(name, "."))
+}
+
+// removeExports deletes the archives and records of the exports.
+func removeExports(exports []*models.Export) error {
+	ids := make([]string, 0, len(exports))
+	for _, export := range exports {
+		if err := os.Remove(exportPath(export.ID)); err != nil && !os.IsNotExist(err) {
+			logger.LogError("removeExports :: " + err.Error())
+		}
+		ids = append(ids, export.ID)
+	}
+	return repo.DeleteExports(ids)
+}
+
+// deleteExpiredExports reports exports that never finished as failed and removes the expired
+// ones.
+func deleteExpiredExports() {
+	now := time.Now().UTC()
+	ttl := envDuration("EXPORT_TTL_HOURS", time.Hour, defaultExportTTL)
+	if stale, err := repo.FailStaleExports(now.Add(-exportBuildTimeout), now.Add(ttl)); err != nil {
+		logger.LogError("deleteExpiredExports :: " + err.Error())
+	} else if stale > 0 {
+		logger.LogError("deleteExpiredExports :: " + strconv.FormatInt(stale, 10) + " exports did not finish in time")
+	}
+	expired, err := repo.GetExpiredExports(now)
+	if err != nil {
+		logger.LogError("deleteExpiredExports :: " + err.Error())
+		return
+	}
+	if err := removeExports(expired); err != nil {
+		logger.LogError("deleteExpiredExports :: " + err.Error())
+	}
+}
+
+// exportPath returns where the archive of an export is stored, in EXPORT_DIR.
+func exportPath(exportID string) string {
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = "exports"
+	}
+	return filepath.Join(dir, exportID+".zip")
+}
+
+// exportDownloadLink builds the download link of an export from EXPORT_DOWNLOAD_URL, which
+// defaults to the /export/download endpoint of this server.
+func exportDownloadLink(token string) string {
+	base := os.Getenv("EXPORT_DOWNLOAD_URL")
+	if base == "" {
+		base = "http://localhost" + os.Getenv("PORT") + "/export/download"
+	}
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "token=" + url.QueryEscape(token)
+}
+
+var exportIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Data export of {{.Username}}</title></head>
+<body>
+<h1>Data export of {{.Username}}</h1>
+<p>Exported at {{.ExportedAt}}. Your profile is in <a href="profile.json">profile.json</a> and your contacts in <a href="contacts.json">contacts.json</a>.</p>
+<h2>Chats</h2>
+<ul>
+{{range .Chats}}<li><a href="{{.Path}}">{{.Title}}</a> ({{.Count}} messages)</li>
+{{else}}<li>No chats.</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+var exportChatTemplate = template.Must(template.New("chat").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<p><a href="../../index.html">All chats</a></p>
+<h1>{{.Title}}</h1>
+{{range .Messages}}<div>
+<p><strong>{{.SenderID}}</strong> <small>{{.Timestamp}}{{if .Edited}} (edited){{end}}</small></p>
+<p>{{.Content}}</p>
+{{if .Media}}<p><a href="{{.Media}}">Attachment</a></p>
+{{end}}</div>
+{{else}}<p>No messages.</p>
+{{end}}</body>
+</html>
+`))
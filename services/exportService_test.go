@@ -0,0 +1,38 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"real-time-chat-app/models"
+	"testing"
+)
+
+func TestWriteExportChatFetchesOnlyUploads(t *testing.T) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	// A participant typed the URL of someone else's file into media_url
+	foreign := "https://res.cloudinary.com/demo/image/upload/v1/private/alice.jpg"
+	chat := &models.ExportChat{With: "mallory", Messages: []*models.Message{
+		{SenderID: "mallory", Content: "look", MediaURL: foreign},
+	}}
+	media := map[string]string{}
+
+	if _, err := writeExportChat(archive, "conversations/direct/mallory", "mallory", chat, media); err != nil {
+		t.Fatalf("writeExportChat: %v", err)
+	}
+	if len(media) != 0 || len(chat.MediaFiles) != 0 {
+		t.Fatalf("a media URL without an upload record was fetched: %v %v", media, chat.MediaFiles)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("reading the archive: %v", err)
+	}
+	for _, file := range reader.File {
+		if file.Name != "conversations/direct/mallory.json" && file.Name != "conversations/direct/mallory.html" {
+			t.Fatalf("unexpected archive entry %s", file.Name)
+		}
+	}
+}
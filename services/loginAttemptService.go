@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"strconv"
+	"time"
+)
+
+// Defaults for the login throttling settings, each overridable from the environment.
+const (
+	defaultLoginMaxFailures      = 5
+	defaultLoginMaxFailuresPerIP = 20
+	defaultLoginBackoffAfter     = 3
+	defaultLoginFailureWindow    = 15 * time.Minute
+	defaultLoginLockout          = 15 * time.Minute
+)
+
+// checkLoginAllowed returns a *models.LoginThrottledError when the username or IP is locked
+// out, or has to wait out the backoff after its last failed login.
+func checkLoginAllowed(username string, ip string) error {
+	var wait time.Duration
+	for _, attempt := range []struct{ kind, subject string }{
+		{models.LoginAttemptUser, username},
+		{models.LoginAttemptIP, ip},
+	} {
+		record, err := repo.GetLoginAttempt(attempt.kind, attempt.subject)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			continue
+		}
+		if w := loginWait(record, time.Now()); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		logger.LogError("checkLoginAllowed :: login throttled for " + username + " from " + ip)
+		return &models.LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// loginWait returns how long until the next login is allowed: the rest of the lockout, or
+// the backoff after the last failure, which doubles with every failure past
+// LOGIN_BACKOFF_AFTER.
+func loginWait(record *models.LoginAttempt, now time.Time) time.Duration {
+	if record.LockedUntil != nil && record.LockedUntil.After(now) {
+		return record.LockedUntil.Sub(now)
+	}
+	excess := record.Failures - envInt("LOGIN_BACKOFF_AFTER", defaultLoginBackoffAfter)
+	if excess < 0 {
+		return 0
+	}
+	backoff := time.Second
+	lockout := envDuration("LOGIN_LOCKOUT_MINUTES", time.Minute, defaultLoginLockout)
+	for i := 0; i < excess && backoff < lockout; i++ {
+		backoff *= 2
+	}
+	if backoff > lockout {
+		backoff = lockout
+	}
+	if next := record.LastFailureAt.Add(backoff); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// recordLoginFailure counts a failed login for the username and the IP and locks out
+// whichever reached its limit.
+func recordLoginFailure(username string, ip string) {
+	window := envDuration("LOGIN_FAILURE_WINDOW_MINUTES", time.Minute, defaultLoginFailureWindow)
+	lockout := envDuration("LOGIN_LOCKOUT_MINUTES", time.Minute, defaultLoginLockout)
+	for _, attempt := range []struct {
+		kind, subject string
+		limit         int
+	}{
+		{models.LoginAttemptUser, username, envInt("LOGIN_MAX_FAILURES", defaultLoginMaxFailures)},
+		{models.LoginAttemptIP, ip, envInt("LOGIN_MAX_FAILURES_PER_IP", defaultLoginMaxFailuresPerIP)},
+	} {
+		record, err := repo.RecordLoginFailure(attempt.kind, attempt.subject, window)
+		if err != nil {
+			logger.LogError("recordLoginFailure :: " + err.Error())
+			continue
+		}
+		if record.Failures >= attempt.limit {
+			if err := repo.LockLogin(attempt.kind, attempt.subject, time.Now().UTC().Add(lockout)); err != nil {
+				logger.LogError("recordLoginFailure :: " + err.Error())
+			}
+		}
+	}
+}
+
+// clearLoginFailures forgets the failed logins of the username after a successful login.
+// The IP's failures are kept, so logging in to one account does not reset the count of an
+// address guessing at others.
+func clearLoginFailures(username string) {
+	if _, err := repo.ClearLoginAttempts(models.LoginAttemptUser, username); err != nil {
+		logger.LogError("clearLoginFailures :: " + err.Error())
+	}
+}
+
+// GetLockedLogins returns the usernames and IPs currently locked out.
+func GetLockedLogins() ([]*models.LoginAttempt, error) {
+	logger.LogInfo("GetLockedLogins service :: started")
+	attempts, err := repo.GetLockedLogins()
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo("GetLockedLogins service :: ended")
+	return attempts, nil
+}
+
+// ClearLockout lifts the lockout of a username or IP and forgets its failed logins.
+func ClearLockout(kind string, subject string) error {
+	logger.LogInfo("ClearLockout service :: started")
+	if kind != models.LoginAttemptUser && kind != models.LoginAttemptIP {
+		return errors.New("invalid kind value : user or ip")
+	}
+	cleared, err := repo.ClearLoginAttempts(kind, subject)
+	if err != nil {
+		return err
+	}
+	if !cleared {
+		return errors.New("no failed logins recorded for " + kind + " " + subject)
+	}
+	logger.LogInfo("ClearLockout service :: ended")
+	return nil
+}
+
+// envInt reads a positive number from the environment variable name, falling back to
+// fallback when it is unset or invalid.
+func envInt(name string, fallback int) int {
+	if value := os.Getenv(name); value != "" {
+		number, err := strconv.Atoi(value)
+		if err == nil && number > 0 {
+			return number
+		}
+		logger.LogError("envInt :: invalid " + name + " " + value)
+	}
+	return fallback
+}
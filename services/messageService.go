@@ -17,34 +17,69 @@ func SendMessage(message *models.Message, mediaFile multipart.File, mediaHeader
 	logger.LogInfo("SendMessage service :: started")
 	message.ID = utils.GenerateUUID()
 	message.Timestamp = utils.GetCurrentTimestamp()
-	message.Status = "sent"
+	message.Status = models.MessageStatusSent
 
+	if err := requireVerified(message.SenderID, models.VerifiedActionMessage); err != nil {
+		logger.LogError("SendMessage service :: " + err.Error())
+		return nil, err
+	}
+
+	var conversation *models.Conversation
+	if message.ConversationID != "" {
+		var err error
+		conversation, err = repo.FetchConversation(message.ConversationID)
+		if err != nil {
+			logger.LogError("SendMessage service :: " + err.Error())
+			return nil, err
+		}
+		if conversation.Member(message.SenderID) == nil {
+			logger.LogError("SendMessage service :: sender is not a member of " + message.ConversationID)
+			return nil, errors.New("you are not a member of the conversation")
+		}
+		message.RecipientID = ""
+	} else if err := checkNotBlocked(message.SenderID, message.RecipientID); err != nil {
+		logger.LogError("SendMessage service :: " + err.Error())
+		return nil, err
+	}
+
+	// Media can only be attached by uploading it, never by naming a URL, which could be
+	// another user's file
+	message.MediaURL = ""
+	message.Media = nil
 	//cloudinary
 	if mediaFile != nil {
 		logger.LogInfo("Uploading media to Cloudinary...")
-		mediaURL, err := UploadMedia(mediaFile, mediaHeader)
+		mediaURL, media, err := UploadMedia(mediaFile, mediaHeader)
 		if err != nil {
 			logger.LogError("Failed to upload media to Cloudinary: " + err.Error())
 			return nil, errors.New("unable to upload media")
 		}
 		message.MediaURL = mediaURL
-		logger.LogInfo("Media uploaded successfully: " + mediaURL)
+		message.Media = media
+		logger.LogInfo("Media uploaded successfully: " + media.PublicID)
 	}
 	err := repo.SaveMessage(message)
 	if err != nil {
 		logger.LogError("error in saveing the message ")
 		return nil, err
 	}
-	logger.LogInfo("SendMessage before BroadcastToRecipient" + message.RecipientID)
-
-	utils.BroadcastToRecipient(message.RecipientID, message)
+	recipients := []string{message.RecipientID}
+	if conversation != nil {
+		recipients = nil
+		for _, member := range conversation.Usernames() {
+			if member != message.SenderID {
+				recipients = append(recipients, member)
+			}
+		}
+	}
+	publishMessageEvent(message.ConversationID, recipients, models.EventMessageCreated, message)
 	logger.LogInfo("SendMessage service :: ended")
 	return message, nil
 }
 
-func GetMessage(username string, reciever string) ([]*models.GetMessage, error) {
+func GetMessage(username string, reciever string, page *models.MessagePageRequest) (*models.MessagePage, error) {
 	logger.LogInfo("GetMessage service :: started")
-	resp, err := repo.GetMessage(username, reciever)
+	resp, err := repo.GetMessage(username, reciever, page)
 	if err != nil {
 		logger.LogError(" GetMessage :: Error in getting message")
 		return nil, err
@@ -55,35 +90,143 @@ func GetMessage(username string, reciever string) ([]*models.GetMessage, error)
 
 }
 
+// MessageEdit changes the text of a message and notifies its recipients. Direct messages
+// cannot be edited while either user has blocked the other, as they cannot be sent.
 func MessageEdit(editmessage *models.EditMessage) (*models.Message, error) {
 	logger.LogInfo("MessageEdit service :: started ")
+	original, err := repo.FetchMessage(editmessage.ID)
+	if err == nil && original.SenderID != editmessage.FromUserID {
+		// Others' messages are reported as missing, as EditMessage does
+		err = models.ErrMessageNotFound
+	}
+	if err != nil {
+		logger.LogError("MessageEdit service :: " + err.Error())
+		return nil, err
+	}
+	if original.ConversationID == "" {
+		if err := checkNotBlocked(original.SenderID, original.RecipientID); err != nil {
+			logger.LogError("MessageEdit service :: " + err.Error())
+			return nil, err
+		}
+	}
 	editMessageResponse, err := repo.EditMessage(editmessage)
 	if err != nil {
 		logger.LogError("error in editing the message ")
 		return nil, err
 	}
-	utils.BroadcastToRecipient(editmessage.ToUserID, editMessageResponse)
+	// The recipients come from the stored message, not from to_user_id of the request
+	recipients := messageRecipients(editMessageResponse.ConversationID, editMessageResponse.SenderID, editMessageResponse.RecipientID)
+	publishMessageEvent(editMessageResponse.ConversationID, recipients, models.EventMessageEdited, editMessageResponse)
 	logger.LogInfo("MessageEdit service :: ended ")
 	return editMessageResponse, nil
 }
 
+// MessageDelete deletes a message of its sender and notifies its recipients. A direct
+// message is deleted even while either user has blocked the other, but the recipient is
+// not notified then.
 func MessageDelete(editmessage *models.DeleteMessage) (*models.DeleteMessageResponse, error) {
 	logger.LogInfo("MessageDelete service :: started ")
-	editMessageResponse, err := repo.MessageDelete(editmessage)
+	message, err := repo.MessageDelete(editmessage)
 	if err != nil {
 		logger.LogError("error in deleting the message ")
 		return nil, err
 	}
-	utils.BroadcastToRecipientDelete(editmessage.ToUserID, editMessageResponse)
+	response := &models.DeleteMessageResponse{
+		Messsage:       "Message deleted Successfully",
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+	}
+	recipients := messageRecipients(message.ConversationID, message.SenderID, message.RecipientID)
+	if message.ConversationID == "" {
+		if err := checkNotBlocked(message.SenderID, message.RecipientID); err != nil {
+			logger.LogError("MessageDelete service :: not notifying " + message.RecipientID + " " + err.Error())
+			recipients = nil
+		}
+	}
+	publishMessageEvent(message.ConversationID, recipients, models.EventMessageDeleted, response)
 	logger.LogInfo("MessageDelete service :: ended ")
-	return editMessageResponse, nil
+	return response, nil
+}
+
+// ModerateDeleteMessage deletes any message on behalf of a moderator and notifies every
+// participant, including the sender, that it was removed.
+func ModerateDeleteMessage(messageID string) (*models.DeleteMessageResponse, error) {
+	logger.LogInfo("ModerateDeleteMessage service :: started")
+	message, err := repo.DeleteMessageByID(messageID)
+	if err != nil {
+		logger.LogError("ModerateDeleteMessage service :: " + err.Error())
+		return nil, err
+	}
+	response := &models.DeleteMessageResponse{
+		Messsage:       "Message removed by a moderator",
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+	}
+	recipients := messageRecipients(message.ConversationID, message.SenderID, message.RecipientID)
+	publishMessageEvent(message.ConversationID, append(recipients, message.SenderID), models.EventMessageDeleted, response)
+	logger.LogInfo("ModerateDeleteMessage service :: ended")
+	return response, nil
+}
+
+// UpdateMessageStatus records a delivered or read acknowledgement from username and
+// notifies the sender of the message in real time.
+func UpdateMessageStatus(update *models.MessageStatusUpdate, username string) error {
+	logger.LogInfo("UpdateMessageStatus service :: started")
+	if err := update.IsValid(); err != nil {
+		return err
+	}
+	update.Username = username
+	update.Timestamp = utils.GetCurrentTimestamp()
+
+	message, err := repo.UpdateMessageReceipt(update)
+	if err != nil {
+		logger.LogError("UpdateMessageStatus service :: " + err.Error())
+		return err
+	}
+	update.ConversationID = message.ConversationID
+
+	publishEvent(message.SenderID, models.EventReceipt, update)
+	logger.LogInfo("UpdateMessageStatus service :: ended")
+	return nil
+}
+
+// checkNotBlocked returns models.ErrContactBlocked if either user has blocked the other.
+func checkNotBlocked(userA string, userB string) error {
+	blocked, err := repo.IsBlocked(userA, userB)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return models.ErrContactBlocked
+	}
+	return nil
+}
+
+// messageRecipients returns who should receive real-time updates about a message: every
+// other member for a group conversation, or the single recipient for a direct message.
+func messageRecipients(conversationID string, sender string, recipientID string) []string {
+	if conversationID == "" {
+		return []string{recipientID}
+	}
+	conversation, err := repo.FetchConversation(conversationID)
+	if err != nil {
+		logger.LogError("messageRecipients :: unable to fetch conversation " + err.Error())
+		return nil
+	}
+	var recipients []string
+	for _, member := range conversation.Usernames() {
+		if member != sender {
+			recipients = append(recipients, member)
+		}
+	}
+	return recipients
 }
 
-func UploadMedia(file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
+func UploadMedia(file multipart.File, fileHeader *multipart.FileHeader) (string, *models.UploadedMedia, error) {
 	// Initialize Cloudinary
 	cld, err := config.InitCloudinary()
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	ctx := context.Background()
@@ -93,9 +236,10 @@ func UploadMedia(file multipart.File, fileHeader *multipart.FileHeader) (string,
 		Folder: "message_media", // Folder in your Cloudinary account
 	})
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	// Return the secure URL of the uploaded media
-	return uploadResult.SecureURL, nil
+	// Return the secure URL of the uploaded media, and what identifies it for deletion
+	media := &models.UploadedMedia{PublicID: uploadResult.PublicID, ResourceType: uploadResult.ResourceType}
+	return uploadResult.SecureURL, media, nil
 }
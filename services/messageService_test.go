@@ -0,0 +1,72 @@
+package services
+
+import (
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/repositary/repotest"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSendMessageIgnoresClientMediaURL(t *testing.T) {
+	t.Setenv("EMAIL_VERIFICATION_REQUIRED_FOR", "")
+	repotest.Run(t, "media url", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			repotest.Count(0),
+			repotest.Written(1),
+			repotest.Value(bson.M{"_id": "bob", "seq": 1}),
+			repotest.Written(1),
+		)
+		message := &models.Message{
+			SenderID:    "mallory",
+			RecipientID: "bob",
+			Content:     "look",
+			MediaURL:    "https://res.cloudinary.com/demo/image/upload/v1/avatars/alice.jpg",
+			Media:       &models.UploadedMedia{PublicID: "avatars/alice", ResourceType: "image"},
+		}
+		sent, err := SendMessage(message, nil, nil)
+		if err != nil {
+			mt.Fatalf("SendMessage: %v", err)
+		}
+		if sent.MediaURL != "" || sent.Media != nil {
+			mt.Fatalf("SendMessage kept the client's media %q %+v", sent.MediaURL, sent.Media)
+		}
+		inserts := repotest.Commands(mt, "insert", "MONGO_TABLE_MESSAGE")
+		if len(inserts) != 1 {
+			mt.Fatalf("stored %d messages, want 1", len(inserts))
+		}
+		stored := inserts[0].Lookup("documents", "0").Document()
+		for _, field := range []string{"media_url", "media"} {
+			if _, err := stored.LookupErr(field); err == nil {
+				mt.Fatalf("the stored message has %s: %v", field, stored)
+			}
+		}
+	})
+}
+
+func TestGetMediaSentByReturnsOnlyUploads(t *testing.T) {
+	repotest.Run(t, "uploads", func(mt *mtest.T) {
+		upload := models.UploadedMedia{PublicID: "message_media/cat", ResourceType: "image"}
+		mt.AddMockResponses(repotest.Cursor(
+			bson.M{"media": upload},
+			bson.M{"media": upload},
+			bson.M{},
+		))
+		media, err := repo.GetMediaSentBy("alice")
+		if err != nil {
+			mt.Fatalf("GetMediaSentBy: %v", err)
+		}
+		if len(media) != 1 || media[0] != upload {
+			mt.Fatalf("GetMediaSentBy = %+v, want only %+v", media, upload)
+		}
+		finds := repotest.Commands(mt, "find", "MONGO_TABLE_MESSAGE")
+		if len(finds) != 1 {
+			mt.Fatalf("sent %d finds, want 1", len(finds))
+		}
+		if _, err := finds[0].LookupErr("filter", "media.public_id"); err != nil {
+			mt.Fatalf("GetMediaSentBy does not require an upload record: %v", finds[0])
+		}
+	})
+}
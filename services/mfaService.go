@@ -0,0 +1,228 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strings"
+	"time"
+)
+
+// recoveryCodeCount is how many recovery codes are issued at a time.
+const recoveryCodeCount = 10
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolling   = errors.New("start the enrollment with /auth/2fa/enroll first")
+	ErrMFAEnforced       = errors.New("two-factor authentication is required for this account")
+	ErrInvalidMFACode    = errors.New("invalid or already used code")
+	ErrInvalidMFAToken   = errors.New("mfa token is invalid or expired, please login again")
+)
+
+// EnrollTOTP generates a new TOTP secret for the user. Two-factor authentication is only
+// enabled once the user proves their authenticator app works with ConfirmTOTP.
+func EnrollTOTP(username string) (*models.TOTPEnrollResponse, error) {
+	logger.LogInfo("EnrollTOTP service :: started")
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		logger.LogError("EnrollTOTP service :: unable to generate secret " + err.Error())
+		return nil, errors.New("unable to generate secret")
+	}
+	if err := repo.SetPendingTOTPSecret(username, secret); err != nil {
+		return nil, err
+	}
+
+	issuer := os.Getenv("MFA_ISSUER")
+	if issuer == "" {
+		issuer = "Real-Time Chat"
+	}
+	logger.LogInfo("EnrollTOTP service :: ended")
+	return &models.TOTPEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPAuthURI(issuer, username, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once code shows the user's authenticator app
+// produces codes for the pending secret, and returns a fresh set of recovery codes.
+func ConfirmTOTP(username string, code string) (*models.RecoveryCodesResponse, error) {
+	logger.LogInfo("ConfirmTOTP service :: started")
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.PendingTOTPSecret == "" {
+		return nil, ErrMFANotEnrolling
+	}
+
+	step, ok := utils.ValidateTOTP(user.PendingTOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.EnableTOTP(username, user.PendingTOTPSecret, step, hashes); err != nil {
+		return nil, err
+	}
+	logger.LogInfo("ConfirmTOTP service :: ended")
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP turns off two-factor authentication after checking a code from the
+// authenticator app or a recovery code. Accounts that must use it cannot turn it off.
+func DisableTOTP(username string, code string) error {
+	logger.LogInfo("DisableTOTP service :: started")
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+	if repo.MFAEnforced(user) {
+		return ErrMFAEnforced
+	}
+	if err := verifySecondFactor(user, code, true); err != nil {
+		return err
+	}
+	if err := repo.DisableTOTP(username); err != nil {
+		return err
+	}
+	logger.LogInfo("DisableTOTP service :: ended")
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a code from the
+// authenticator app.
+func RegenerateRecoveryCodes(username string, code string) (*models.RecoveryCodesResponse, error) {
+	logger.LogInfo("RegenerateRecoveryCodes service :: started")
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+	if err := verifySecondFactor(user, code, false); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.ReplaceRecoveryCodes(username, hashes); err != nil {
+		return nil, err
+	}
+	logger.LogInfo("RegenerateRecoveryCodes service :: ended")
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// CompleteMFALogin checks the second factor for an MFA challenge returned by login and
+// starts the session. Wrong codes count as failed logins.
+func CompleteMFALogin(request *models.MFALoginRequest, ip string, userAgent string) (resp *models.LoginResponse, err error) {
+	logger.LogInfo("CompleteMFALogin service :: started")
+	claims, err := utils.ParseToken(request.MFAToken)
+	if err != nil || utils.TokenType(claims) != utils.TokenTypeMFA {
+		return nil, ErrInvalidMFAToken
+	}
+	username, _ := claims["username"].(string)
+	defer func() { auditLogin(username, ip, userAgent, "mfa", resp, err) }()
+	deviceName, _ := claims["dev"].(string)
+
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil || !user.TOTPEnabled {
+		return nil, ErrInvalidMFAToken
+	}
+	if user.Suspended {
+		return nil, models.ErrAccountSuspended
+	}
+	if user.DeletionScheduledAt != nil {
+		return nil, models.ErrAccountPendingDeletion
+	}
+	if err := checkLoginAllowed(username, ip); err != nil {
+		return nil, err
+	}
+	if err := verifySecondFactor(user, request.Code, true); err != nil {
+		if err == ErrInvalidMFACode {
+			recordLoginFailure(username, ip)
+		}
+		return nil, err
+	}
+	clearLoginFailures(username)
+
+	session := &models.JwtSession{
+		DeviceName: deviceName,
+		IP:         ip,
+		UserAgent:  truncate(userAgent, maxDeviceInfoLength),
+	}
+	token, refreshtoken, err := repo.StartJwtSession(user, session)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo("CompleteMFALogin service :: ended")
+	return &models.LoginResponse{
+		Username:     user.Username,
+		Token:        token,
+		RefreshToken: refreshtoken,
+	}, nil
+}
+
+// verifySecondFactor accepts a current code from the authenticator app that was not used
+// before or, when allowRecovery is set, an unused recovery code, which is used up.
+func verifySecondFactor(user *models.User, code string, allowRecovery bool) error {
+	code = strings.TrimSpace(code)
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		claimed, err := repo.ClaimTOTPStep(user.Username, step)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+	if !allowRecovery || code == "" {
+		return ErrInvalidMFACode
+	}
+
+	used, err := repo.UseRecoveryCode(user.Username, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	logger.LogInfo("verifySecondFactor :: recovery code used by " + user.Username)
+	return nil
+}
+
+// newRecoveryCodes returns new recovery codes and the hashes to store for them.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		logger.LogError("newRecoveryCodes :: unable to generate codes " + err.Error())
+		return nil, nil, errors.New("unable to generate recovery codes")
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(code)
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"os"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"real-time-chat-app/oidc"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OIDCStateTTL is how long the user has to log in at the provider.
+const OIDCStateTTL = 10 * time.Minute
+
+var (
+	ErrOIDCDisabled          = errors.New("single sign-on is not configured")
+	ErrInvalidOIDCState      = errors.New("login expired or was already completed, start again")
+	ErrOIDCEmailNotVerified  = errors.New("the provider did not confirm the email address")
+	ErrOIDCAccountConflict   = errors.New("an account with this email exists but its email is not verified, log in with the password and verify it first")
+	ErrOIDCProvisionDisabled = errors.New("no account is linked to this login and new accounts cannot be created with single sign-on")
+)
+
+// StartOIDCLogin begins a single sign-on login and returns the provider URL to send the user
+// to, and the binding the browser must present with the callback, so a login started by
+// someone else cannot be completed in it. The state, nonce and PKCE code verifier are kept
+// until the provider redirects back.
+func StartOIDCLogin(deviceName string) (string, string, error) {
+	logger.LogInfo("StartOIDCLogin service :: started")
+	provider := oidc.Default
+	if provider == nil {
+		return "", "", ErrOIDCDisabled
+	}
+
+	var values [4]string
+	for i := range values {
+		value, err := oidc.NewCodeVerifier()
+		if err != nil {
+			return "", "", err
+		}
+		values[i] = value
+	}
+	state, nonce, verifier, binding := values[0], values[1], values[2], values[3]
+
+	now := time.Now().UTC()
+	err := repo.InsertOIDCState(&models.OIDCState{
+		StateHash:    utils.HashToken(state),
+		BindingHash:  utils.HashToken(binding),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		DeviceName:   truncate(strings.TrimSpace(deviceName), maxDeviceInfoLength),
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(OIDCStateTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		logger.LogError("StartOIDCLogin service :: " + err.Error())
+		return "", "", err
+	}
+	logger.LogInfo("StartOIDCLogin service :: ended")
+	return authURL, binding, nil
+}
+
+// CompleteOIDCLogin finishes a single sign-on login with the code and state the provider
+// redirected back with and the binding StartOIDCLogin returned to the browser. The provider
+// account is matched to the user linked to it, else to the user with the same verified
+// email, else a new user is created. The login then continues like a password login,
+// including the second factor.
+func CompleteOIDCLogin(code string, state string, binding string, ip string, userAgent string) (resp *models.LoginResponse, err error) {
+	logger.LogInfo("CompleteOIDCLogin service :: started")
+	provider := oidc.Default
+	if provider == nil {
+		return nil, ErrOIDCDisabled
+	}
+	defer func() { auditLogin("", ip, userAgent, "oidc", resp, err) }()
+
+	saved, err := repo.ConsumeOIDCState(utils.HashToken(state))
+	if err != nil {
+		return nil, ErrInvalidOIDCState
+	}
+	if subtle.ConstantTimeCompare([]byte(saved.BindingHash), []byte(utils.HashToken(binding))) != 1 {
+		logger.LogError("CompleteOIDCLogin service :: the login was started in another browser")
+		return nil, ErrInvalidOIDCState
+	}
+	idToken, err := provider.Exchange(code, saved.CodeVerifier, saved.Nonce)
+	if err != nil {
+		logger.LogError("CompleteOIDCLogin service :: " + err.Error())
+		return nil, err
+	}
+
+	user, err := oidcUser(idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.JwtSession{
+		DeviceName: saved.DeviceName,
+		IP:         ip,
+		UserAgent:  truncate(userAgent, maxDeviceInfoLength),
+	}
+	resp, err = repo.StartLogin(user, session)
+	if err != nil {
+		return nil, err
+	}
+	logger.LogInfo("CompleteOIDCLogin service :: ended for " + user.Username)
+	return resp, nil
+}
+
+// oidcUser returns the user the provider account logs in as, linking or creating it if needed.
+func oidcUser(idToken *oidc.IDToken) (*models.User, error) {
+	user, err := repo.FetchUserByOIDCIdentity(idToken.Issuer, idToken.Subject)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	// Only an address both sides have verified proves the accounts belong to the same person
+	if idToken.Email == "" || !idToken.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+	email := idToken.Email
+	identity := models.OIDCIdentity{Issuer: idToken.Issuer, Subject: idToken.Subject, LinkedAt: time.Now().UTC()}
+
+	user, err = repo.FetchUserByEmail(email)
+	if err == nil {
+		if !user.EmailVerified {
+			return nil, ErrOIDCAccountConflict
+		}
+		if err := repo.LinkOIDCIdentity(user.Username, identity); err != nil {
+			return nil, err
+		}
+		logger.LogInfo("oidcUser :: linked " + idToken.Issuer + " account to " + user.Username)
+		return user, nil
+	}
+
+	if os.Getenv("OIDC_JIT_PROVISIONING") == "false" {
+		return nil, ErrOIDCProvisionDisabled
+	}
+	return provisionOIDCUser(idToken, email, identity)
+}
+
+// provisionOIDCUser creates a client account for a provider account logging in for the first
+// time. It gets a random password, so it can only log in with single sign-on until the user
+// sets one with a password reset.
+func provisionOIDCUser(idToken *oidc.IDToken, email string, identity models.OIDCIdentity) (*models.User, error) {
+	username, err := oidcUsername(idToken, email)
+	if err != nil {
+		return nil, err
+	}
+	password, err := utils.GenerateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+
+	user := &models.User{
+		Username:       username,
+		Email:          email,
+		EmailVerified:  true,
+		Password:       string(hashedPassword),
+		FirstName:      idToken.GivenName,
+		LastName:       idToken.FamilyName,
+		Role:           models.Client,
+		OIDCIdentities: []models.OIDCIdentity{identity},
+	}
+	if err := repo.InsertUser(user); err != nil {
+		logger.LogError("provisionOIDCUser :: " + err.Error())
+		return nil, err
+	}
+	logger.LogInfo("provisionOIDCUser :: created " + username + " for " + idToken.Issuer + " account")
+	return repo.FetchUserByUsername(username)
+}
+
+// minUsernameLength matches the signup validation.
+const minUsernameLength = 5
+
+// oidcUsername picks a free username from the preferred username or the email address,
+// adding a number when it is taken. Characters such as the ':' separating the participants of
+// direct chat IDs are left out.
+func oidcUsername(idToken *oidc.IDToken, email string) (string, error) {
+	base := idToken.PreferredUsername
+	if base == "" || strings.Contains(base, "@") {
+		base = strings.SplitN(email, "@", 2)[0]
+	}
+	var cleaned strings.Builder
+	for _, r := range strings.ToLower(base) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			cleaned.WriteRune(r)
+		}
+	}
+	// The prefix is reserved for the placeholders of deleted accounts
+	base = strings.TrimPrefix(cleaned.String(), models.DeletedUserPrefix)
+	if base == "" {
+		base = "user"
+	}
+	for len(base) < minUsernameLength {
+		base += "0"
+	}
+
+	candidate := base
+	for i := 1; i <= 100; i++ {
+		taken, err := repo.UsernameExists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = base + strconv.Itoa(i)
+	}
+	return "", errors.New("unable to find a free username")
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"real-time-chat-app/models"
+	"real-time-chat-app/oidc"
+	"real-time-chat-app/oidc/oidctest"
+	"real-time-chat-app/repositary/repotest"
+	"real-time-chat-app/utils"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// useMockProvider makes the services log in with a mock provider for the rest of the test.
+func useMockProvider(t *testing.T) *oidctest.Provider {
+	t.Helper()
+	t.Setenv("JWT_KEYS_DIR", t.TempDir())
+	if err := utils.InitKeyring(); err != nil {
+		t.Fatalf("InitKeyring: %v", err)
+	}
+	mock := oidctest.NewProvider(t, "chat-app", "client-secret")
+	mock.TrailingSlash = true
+	previous := oidc.Default
+	oidc.Default = oidc.NewProvider(oidc.Config{
+		Issuer:       mock.URL(),
+		ClientID:     "chat-app",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost:8081/auth/oidc/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	})
+	t.Cleanup(func() { oidc.Default = previous })
+	return mock
+}
+
+// startOIDCLogin starts a login, logs in at the mock provider with claims and returns the
+// code and state it redirected back with, the binding of the browser and the login state
+// stored for the callback.
+func startOIDCLogin(mt *mtest.T, mock *oidctest.Provider, claims jwt.MapClaims) (string, string, string, *models.OIDCState) {
+	mt.Helper()
+	mt.AddMockResponses(repotest.Written(1))
+	authURL, binding, err := StartOIDCLogin("laptop")
+	if err != nil {
+		mt.Fatalf("StartOIDCLogin: %v", err)
+	}
+	inserts := repotest.Commands(mt, "insert", "MONGO_TABLE_OIDC_STATE")
+	if len(inserts) != 1 {
+		mt.Fatalf("StartOIDCLogin stored %d states, want 1", len(inserts))
+	}
+	var saved models.OIDCState
+	if err := bson.Unmarshal(inserts[0].Lookup("documents", "0").Document(), &saved); err != nil {
+		mt.Fatalf("decoding the stored state: %v", err)
+	}
+
+	code, state, err := mock.Authorize(authURL, claims)
+	if err != nil {
+		mt.Fatalf("Authorize: %v", err)
+	}
+	if saved.StateHash != utils.HashToken(state) {
+		mt.Fatal("the stored state does not match the one sent to the provider")
+	}
+	if saved.BindingHash != utils.HashToken(binding) {
+		mt.Fatal("the stored binding does not match the one returned to the browser")
+	}
+	return code, state, binding, &saved
+}
+
+func TestCompleteOIDCLoginLinksVerifiedEmail(t *testing.T) {
+	mock := useMockProvider(t)
+	repotest.Run(t, "link", func(mt *mtest.T) {
+		code, state, binding, saved := startOIDCLogin(mt, mock, jwt.MapClaims{
+			"sub":            "jane-at-provider",
+			"email":          "jane@example.com",
+			"email_verified": true,
+		})
+		jane := &models.User{Username: "jane", Email: "jane@example.com", EmailVerified: true, Role: models.Client}
+		mt.AddMockResponses(
+			repotest.Value(saved),
+			repotest.Cursor(),
+			repotest.Cursor(jane),
+			repotest.Written(1),
+			repotest.Written(1),
+			repotest.Written(1),
+		)
+
+		resp, err := CompleteOIDCLogin(code, state, binding, "127.0.0.1", "test")
+		if err != nil {
+			mt.Fatalf("CompleteOIDCLogin: %v", err)
+		}
+		if resp.Username != "jane" || resp.Token == "" || resp.RefreshToken == "" {
+			mt.Fatalf("unexpected login response %+v", resp)
+		}
+		if inserts := repotest.Commands(mt, "insert", "MONGO_TABLE_USER"); len(inserts) != 0 {
+			mt.Fatalf("linking created a user: %v", inserts)
+		}
+		updates := repotest.Commands(mt, "update", "MONGO_TABLE_USER")
+		if len(updates) != 1 {
+			mt.Fatalf("sent %d user updates, want the one linking the account", len(updates))
+		}
+		identity := updates[0].Lookup("updates", "0", "u", "$push", "oidc_identities").Document()
+		if identity.Lookup("issuer").StringValue() != mock.URL() || identity.Lookup("subject").StringValue() != "jane-at-provider" {
+			mt.Fatalf("linked identity %v, want subject jane-at-provider of %s", identity, mock.URL())
+		}
+		if sessions := repotest.Commands(mt, "insert", "MONGO_TABLE_JWT_STORE"); len(sessions) != 1 {
+			mt.Fatalf("started %d sessions, want 1", len(sessions))
+		}
+	})
+
+	repotest.Run(t, "unverified email", func(mt *mtest.T) {
+		code, state, binding, saved := startOIDCLogin(mt, mock, jwt.MapClaims{
+			"sub":            "jane-at-provider",
+			"email":          "jane@example.com",
+			"email_verified": false,
+		})
+		mt.AddMockResponses(
+			repotest.Value(saved),
+			repotest.Cursor(),
+			repotest.Written(1),
+		)
+
+		if _, err := CompleteOIDCLogin(code, state, binding, "127.0.0.1", "test"); err != ErrOIDCEmailNotVerified {
+			mt.Fatalf("CompleteOIDCLogin = %v, want %v", err, ErrOIDCEmailNotVerified)
+		}
+		if updates := repotest.Commands(mt, "update", "MONGO_TABLE_USER"); len(updates) != 0 {
+			mt.Fatalf("an unverified email was linked: %v", updates)
+		}
+	})
+
+	repotest.Run(t, "account email not verified", func(mt *mtest.T) {
+		code, state, binding, saved := startOIDCLogin(mt, mock, jwt.MapClaims{
+			"sub":            "jane-at-provider",
+			"email":          "jane@example.com",
+			"email_verified": true,
+		})
+		mt.AddMockResponses(
+			repotest.Value(saved),
+			repotest.Cursor(),
+			repotest.Cursor(&models.User{Username: "jane", Email: "jane@example.com", Role: models.Client}),
+			repotest.Written(1),
+		)
+
+		if _, err := CompleteOIDCLogin(code, state, binding, "127.0.0.1", "test"); err != ErrOIDCAccountConflict {
+			mt.Fatalf("CompleteOIDCLogin = %v, want %v", err, ErrOIDCAccountConflict)
+		}
+		if updates := repotest.Commands(mt, "update", "MONGO_TABLE_USER"); len(updates) != 0 {
+			mt.Fatalf("an account with an unverified email was linked: %v", updates)
+		}
+	})
+}
+
+func TestCompleteOIDCLoginProvisionsUser(t *testing.T) {
+	mock := useMockProvider(t)
+	repotest.Run(t, "provision", func(mt *mtest.T) {
+		code, state, binding, saved := startOIDCLogin(mt, mock, jwt.MapClaims{
+			"sub":                "new-at-provider",
+			"email":              "new.user@example.com",
+			"email_verified":     true,
+			"preferred_username": "New:User",
+			"given_name":         "New",
+		})
+		mt.AddMockResponses(
+			repotest.Value(saved),
+			repotest.Cursor(),
+			repotest.Cursor(),
+			repotest.Count(0),
+			repotest.Count(0),
+			repotest.Written(1),
+			repotest.Cursor(&models.User{Username: "newuser", Email: "new.user@example.com", EmailVerified: true, Role: models.Client}),
+			repotest.Written(1),
+			repotest.Written(1),
+		)
+
+		resp, err := CompleteOIDCLogin(code, state, binding, "127.0.0.1", "test")
+		if err != nil {
+			mt.Fatalf("CompleteOIDCLogin: %v", err)
+		}
+		if resp.Username != "newuser" || resp.Token == "" {
+			mt.Fatalf("unexpected login response %+v", resp)
+		}
+		inserts := repotest.Commands(mt, "insert", "MONGO_TABLE_USER")
+		if len(inserts) != 1 {
+			mt.Fatalf("sent %d user inserts, want 1", len(inserts))
+		}
+		var user models.User
+		if err := bson.Unmarshal(inserts[0].Lookup("documents", "0").Document(), &user); err != nil {
+			mt.Fatalf("decoding the inserted user: %v", err)
+		}
+		if user.Username != "newuser" || user.Email != "new.user@example.com" || !user.EmailVerified ||
+			user.Role != models.Client || user.FirstName != "New" || user.Password == "" {
+			mt.Fatalf("unexpected provisioned user %+v", user)
+		}
+		if len(user.OIDCIdentities) != 1 || user.OIDCIdentities[0].Issuer != mock.URL() ||
+			user.OIDCIdentities[0].Subject != "new-at-provider" {
+			mt.Fatalf("provisioned user has identities %+v", user.OIDCIdentities)
+		}
+	})
+
+	repotest.Run(t, "provisioning disabled", func(mt *mtest.T) {
+		mt.Setenv("OIDC_JIT_PROVISIONING", "false")
+		code, state, binding, saved := startOIDCLogin(mt, mock, jwt.MapClaims{
+			"sub":            "new-at-provider",
+			"email":          "new.user@example.com",
+			"email_verified": true,
+		})
+		mt.AddMockResponses(
+			repotest.Value(saved),
+			repotest.Cursor(),
+			repotest.Cursor(),
+			repotest.Written(1),
+		)
+
+		if _, err := CompleteOIDCLogin(code, state, binding, "127.0.0.1", "test"); err != ErrOIDCProvisionDisabled {
+			mt.Fatalf("CompleteOIDCLogin = %v, want %v", err, ErrOIDCProvisionDisabled)
+		}
+		if inserts := repotest.Commands(mt, "insert", "MONGO_TABLE_USER"); len(inserts) != 0 {
+			mt.Fatalf("a user was provisioned: %v", inserts)
+		}
+	})
+}
+
+func TestCompleteOIDCLoginConsumesState(t *testing.T) {
+	mock := useMockProvider(t)
+	repotest.Run(t, "replay", func(mt *mtest.T) {
+		code, state, binding, _ := startOIDCLogin(mt, mock, nil)
+		mt.AddMockResponses(
+			repotest.Value(nil),
+			repotest.Written(1),
+		)
+		if _, err := CompleteOIDCLogin(code, state, binding, "127.0.0.1", "test"); err != ErrInvalidOIDCState {
+			mt.Fatalf("CompleteOIDCLogin = %v, want %v", err, ErrInvalidOIDCState)
+		}
+	})
+}
+
+func TestCompleteOIDCLoginRequiresTheBrowserThatStartedIt(t *testing.T) {
+	mock := useMockProvider(t)
+	// The victim's browser opens the callback URL of a login the attacker started, with no
+	// binding or the binding of a login of its own
+	for _, binding := range []string{"", "binding-of-another-login"} {
+		repotest.Run(t, "other browser", func(mt *mtest.T) {
+			code, state, _, saved := startOIDCLogin(mt, mock, jwt.MapClaims{
+				"sub":            "mallory-at-provider",
+				"email":          "mallory@example.com",
+				"email_verified": true,
+			})
+			mt.AddMockResponses(
+				repotest.Value(saved),
+				repotest.Written(1),
+			)
+			if _, err := CompleteOIDCLogin(code, state, binding, "127.0.0.1", "test"); err != ErrInvalidOIDCState {
+				mt.Fatalf("CompleteOIDCLogin = %v, want %v", err, ErrInvalidOIDCState)
+			}
+			if sessions := repotest.Commands(mt, "insert", "MONGO_TABLE_JWT_STORE"); len(sessions) != 0 {
+				mt.Fatalf("a login from another browser started %d sessions", len(sessions))
+			}
+		})
+	}
+}
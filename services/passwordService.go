@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/mailer"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultPasswordResetTTL is how long a reset link stays valid unless
+// PASSWORD_RESET_TTL_MINUTES says otherwise.
+const defaultPasswordResetTTL = 30 * time.Minute
+
+var ErrInvalidResetToken = errors.New("reset token is invalid or expired")
+
+// ForgotPassword emails a password reset link to the user registered with email. Nothing is
+// reported back when no user has that address, so the endpoint cannot be used to find out
+// which addresses are registered.
+func ForgotPassword(email string) error {
+	logger.LogInfo("ForgotPassword service :: started")
+	// The lookup, the new token and the email all happen in the background, for unknown
+	// addresses too, so the response time does not reveal whether the email exists
+	go sendPasswordReset(strings.ToLower(email))
+	logger.LogInfo("ForgotPassword service :: ended")
+	return nil
+}
+
+// sendPasswordReset emails a reset link to the user registered with email, if any.
+func sendPasswordReset(email string) {
+	user, err := repo.FetchUserByEmail(email)
+	if err != nil {
+		logger.LogInfo("sendPasswordReset :: no user for the email")
+		return
+	}
+	message, err := passwordResetMessage(user, false)
+	if err != nil {
+		logger.LogError("sendPasswordReset :: " + err.Error())
+		return
+	}
+	if err := mailer.Send(message); err != nil {
+		logger.LogError("sendPasswordReset :: unable to send reset email to " + user.Username + " " + err.Error())
+	}
+}
+
+// ResetPassword sets a new password with a token from a reset link. The token can only be
+// used once, and every session of the user is logged out.
+func ResetPassword(request *models.ResetPasswordRequest) error {
+	logger.LogInfo("ResetPassword service :: started")
+	token, err := repo.ConsumeUserToken(utils.HashToken(request.Token), models.TokenPurposePasswordReset)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.LogError("ResetPassword service :: error in GenerateFromPassword")
+		return errors.New("failed to hash password")
+	}
+	if err := repo.UpdatePassword(token.Username, string(hashedPassword)); err != nil {
+		return err
+	}
+
+	if err := repo.DeleteUserTokens(token.Username, models.TokenPurposePasswordReset); err != nil {
+		logger.LogError("ResetPassword service :: " + err.Error())
+	}
+	if err := repo.LogoutUser(token.Username); err != nil {
+		// The user may not have been logged in anywhere
+		logger.LogInfo("ResetPassword service :: " + err.Error())
+	}
+	utils.CloseConnection(token.Username)
+	logger.LogInfo("ResetPassword service :: ended")
+	return nil
+}
+
+// passwordResetMessage creates a single-use reset token for the user and returns the email
+// with its link, worded for a reset done by an admin when byAdmin is set. Links sent earlier
+// stop working.
+func passwordResetMessage(user *models.User, byAdmin bool) (*mailer.Message, error) {
+	token, err := utils.GenerateSecureToken()
+	if err != nil {
+		logger.LogError("passwordResetMessage :: unable to generate token " + err.Error())
+		return nil, errors.New("unable to create reset token")
+	}
+
+	ttl := passwordResetTTL()
+	now := time.Now().UTC()
+	// Only the latest link works
+	if err := repo.DeleteUserTokens(user.Username, models.TokenPurposePasswordReset); err != nil {
+		return nil, err
+	}
+	err = repo.InsertUserToken(&models.UserToken{
+		TokenHash: utils.HashToken(token),
+		Username:  user.Username,
+		Purpose:   models.TokenPurposePasswordReset,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	intro := "Use the link below to choose a new password."
+	outro := "If you did not ask to reset your password, you can ignore this email.\n"
+	if byAdmin {
+		intro = "An administrator reset your password and logged you out. Use the link below to choose a new one."
+		outro = ""
+	}
+	return &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			intro + " It expires in " + strconv.Itoa(int(ttl.Minutes())) + " minutes and can be used once.\n\n" +
+			passwordResetLink(token) + "\n\n" +
+			outro,
+	}, nil
+}
+
+func passwordResetTTL() time.Duration {
+	return envDuration("PASSWORD_RESET_TTL_MINUTES", time.Minute, defaultPasswordResetTTL)
+}
+
+// envDuration reads a positive whole number of units from the environment variable name,
+// falling back to fallback when it is unset or invalid.
+func envDuration(name string, unit time.Duration, fallback time.Duration) time.Duration {
+	if value := os.Getenv(name); value != "" {
+		count, err := strconv.Atoi(value)
+		if err == nil && count > 0 {
+			return time.Duration(count) * unit
+		}
+		logger.LogError("envDuration :: invalid " + name + " " + value)
+	}
+	return fallback
+}
+
+// passwordResetLink builds the link emailed to the user from PASSWORD_RESET_URL, the page of
+// the client app that asks for the new password.
+func passwordResetLink(token string) string {
+	base := os.Getenv("PASSWORD_RESET_URL")
+	if base == "" {
+		base = "http://localhost:8080/reset-password"
+	}
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"errors"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// typingTimeout is how long a typing indicator lasts without being refreshed by another
+// start before the server stops it on the client's behalf.
+const typingTimeout = 6 * time.Second
+
+var (
+	presenceMu sync.Mutex
+	presence   = make(map[string]string) // Map of connected username to online or away
+
+	typingMu sync.Mutex
+	typing   = make(map[string]*typingState) // Map of username|chat to the active indicator
+)
+
+// typingState is a typing indicator that has been relayed and not yet stopped.
+type typingState struct {
+	timer      *time.Timer
+	recipients []string
+	payload    models.TypingPayload
+}
+
+// StartPresence makes the WebSocket hub report users coming online and going offline.
+func StartPresence() {
+	utils.Connections.SetPresenceHandlers(userOnline, userOffline)
+}
+
+func userOnline(username string) {
+	if !utils.Connections.IsOnline(username) {
+		return
+	}
+	presenceMu.Lock()
+	presence[username] = models.PresenceOnline
+	presenceMu.Unlock()
+
+	broadcastPresence(&models.PresencePayload{Username: username, Status: models.PresenceOnline})
+}
+
+// userOffline records when the user was last seen, stops their typing indicators and tells
+// their contacts they went offline.
+func userOffline(username string) {
+	if utils.Connections.IsOnline(username) {
+		return
+	}
+	presenceMu.Lock()
+	delete(presence, username)
+	presenceMu.Unlock()
+
+	stopAllTyping(username)
+
+	lastSeen := utils.GetCurrentTimestamp()
+	if err := repo.UpdateLastSeen(username, lastSeen); err != nil {
+		logger.LogError("userOffline :: " + err.Error())
+	}
+	if err := repo.UpdateContactLastOnline(username, time.Now().UTC()); err != nil {
+		logger.LogError("userOffline :: " + err.Error())
+	}
+	broadcastPresence(&models.PresencePayload{Username: username, Status: models.PresenceOffline, LastSeen: lastSeen})
+}
+
+// UpdatePresence marks a connected user as away or back online.
+func UpdatePresence(command *models.PresenceCommand, username string) error {
+	logger.LogInfo("UpdatePresence service :: started")
+	if err := command.IsValid(); err != nil {
+		return err
+	}
+
+	presenceMu.Lock()
+	current, connected := presence[username]
+	if connected {
+		presence[username] = command.Status
+	}
+	presenceMu.Unlock()
+
+	if connected && current != command.Status {
+		broadcastPresence(&models.PresencePayload{Username: username, Status: command.Status})
+	}
+	logger.LogInfo("UpdatePresence service :: ended")
+	return nil
+}
+
+// SendContactPresence tells a newly connected client which of the user's contacts are
+// currently online or away.
+func SendContactPresence(client *utils.Client) {
+	contacts, err := repo.GetAcceptedContacts(client.Username)
+	if err != nil {
+		logger.LogError("SendContactPresence :: " + err.Error())
+		return
+	}
+
+	presenceMu.Lock()
+	var statuses []*models.PresencePayload
+	for _, contact := range contacts {
+		if status, connected := presence[contact]; connected {
+			statuses = append(statuses, &models.PresencePayload{Username: contact, Status: status})
+		}
+	}
+	presenceMu.Unlock()
+
+	for _, status := range statuses {
+		utils.SendToClient(client, utils.NewEvent(models.EventPresence, status))
+	}
+}
+
+// broadcastPresence sends a presence change to the user's accepted contacts. Presence
+// events are not stored for replay.
+func broadcastPresence(payload *models.PresencePayload) {
+	contacts, err := repo.GetAcceptedContacts(payload.Username)
+	if err != nil {
+		logger.LogError("broadcastPresence :: " + err.Error())
+		return
+	}
+	event := utils.NewEvent(models.EventPresence, payload)
+	for _, contact := range contacts {
+		utils.BroadcastEvent(contact, event)
+	}
+}
+
+// HandleTyping relays a typing start or stop from username to the other participants of the
+// chat. A start that is not refreshed within typingTimeout is stopped by the server.
+func HandleTyping(command *models.TypingCommand, username string) error {
+	if err := command.IsValid(); err != nil {
+		return err
+	}
+
+	var recipients []string
+	key := username + "|"
+	if command.ConversationID != "" {
+		conversation, err := repo.FetchConversation(command.ConversationID)
+		if err != nil {
+			return err
+		}
+		if conversation.Member(username) == nil {
+			return errors.New("you are not a member of the conversation")
+		}
+		for _, member := range conversation.Usernames() {
+			if member != username {
+				recipients = append(recipients, member)
+			}
+		}
+		key += conversation.ID
+	} else {
+		if command.RecipientID == username {
+			return errors.New("cannot send typing indicator to yourself")
+		}
+		if err := checkNotBlocked(username, command.RecipientID); err != nil {
+			return err
+		}
+		recipients = []string{command.RecipientID}
+		key += utils.CanonicalChatID(username, command.RecipientID)
+	}
+
+	payload := models.TypingPayload{
+		Username:       username,
+		ConversationID: command.ConversationID,
+		State:          command.State,
+	}
+
+	typingMu.Lock()
+	state, active := typing[key]
+	if active {
+		state.timer.Stop()
+		delete(typing, key)
+	}
+	if command.State == models.TypingStart {
+		state = &typingState{recipients: recipients, payload: payload}
+		state.timer = time.AfterFunc(typingTimeout, func() { expireTyping(key, state) })
+		typing[key] = state
+	}
+	typingMu.Unlock()
+
+	// Refreshing an active indicator only extends its timeout, and stopping an inactive one
+	// has nothing to tell the recipients
+	if active == (command.State == models.TypingStart) {
+		return nil
+	}
+	relayTyping(recipients, &payload)
+	return nil
+}
+
+// expireTyping stops an indicator that was not refreshed in time.
+func expireTyping(key string, state *typingState) {
+	typingMu.Lock()
+	if typing[key] != state {
+		typingMu.Unlock()
+		return
+	}
+	delete(typing, key)
+	typingMu.Unlock()
+
+	stop := state.payload
+	stop.State = models.TypingStop
+	relayTyping(state.recipients, &stop)
+}
+
+// stopAllTyping stops every active indicator of the user, e.g. when they go offline.
+func stopAllTyping(username string) {
+	var stopped []*typingState
+	typingMu.Lock()
+	for key, state := range typing {
+		if strings.HasPrefix(key, username+"|") {
+			state.timer.Stop()
+			delete(typing, key)
+			stopped = append(stopped, state)
+		}
+	}
+	typingMu.Unlock()
+
+	for _, state := range stopped {
+		stop := state.payload
+		stop.State = models.TypingStop
+		relayTyping(state.recipients, &stop)
+	}
+}
+
+// relayTyping sends a typing event to the recipients. Typing events are not stored for replay.
+func relayTyping(recipients []string, payload *models.TypingPayload) {
+	event := utils.NewEvent(models.EventTyping, payload)
+	for _, recipient := range recipients {
+		utils.BroadcastEvent(recipient, event)
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strings"
+)
+
+// ChangeUserRole assigns role to username and returns the role the user had before. The
+// user's sessions are revoked so tokens carrying the old role stop working straight away.
+// Demoting the last ADMIN fails with models.ErrLastAdmin.
+func ChangeUserRole(username string, role models.Role) (models.Role, error) {
+	logger.LogInfo("ChangeUserRole service :: started")
+	if role != models.Admin && role != models.Client {
+		return "", errors.New("role must be ADMIN or CLIENT")
+	}
+
+	previous, err := repo.SetUserRole(username, role)
+	if err == models.ErrLastAdmin {
+		return previous, err
+	}
+	if err != nil {
+		logger.LogError("ChangeUserRole service :: " + err.Error())
+		return "", err
+	}
+
+	if previous != role {
+		if err := repo.LogoutUser(username); err != nil {
+			logger.LogError("ChangeUserRole service :: unable to revoke sessions " + err.Error())
+		}
+		utils.CloseConnection(username)
+	}
+	logger.LogInfo("ChangeUserRole service :: ended")
+	return previous, nil
+}
+
+// BootstrapAdmin promotes the existing account named by BOOTSTRAP_ADMIN_USERNAME to ADMIN
+// while no ADMIN exists, so the first administrator can be created without a signup role.
+// It does nothing once an ADMIN exists.
+func BootstrapAdmin() error {
+	username := strings.TrimSpace(os.Getenv("BOOTSTRAP_ADMIN_USERNAME"))
+	if username == "" {
+		return nil
+	}
+	admins, err := repo.CountUsersWithRole(models.Admin)
+	if err != nil {
+		return err
+	}
+	if admins > 0 {
+		logger.LogInfo("BootstrapAdmin :: an ADMIN already exists, ignoring BOOTSTRAP_ADMIN_USERNAME")
+		return nil
+	}
+	previous, err := repo.SetUserRole(username, models.Admin)
+	if err != nil {
+		return err
+	}
+	RecordAudit(&models.AuditEvent{
+		Actor:   "bootstrap",
+		Action:  models.AuditRoleChange,
+		Target:  username,
+		Outcome: models.AuditSuccess,
+		Details: map[string]string{"from": string(previous), "to": string(models.Admin)},
+	})
+	return nil
+}
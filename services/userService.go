@@ -25,12 +25,3 @@ func UserAndProfileUpdate(username string, user *models.UpdateUserAndProfile) (*
 	}
 	return userResponse, nil
 }
-
-func DeleteUser(username string) error {
-	err := repo.DeleteUser(username)
-	if err != nil {
-		logger.LogInfo("DeleteUser :: error  while fetching the user ")
-		return err
-	}
-	return nil
-}
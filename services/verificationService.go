@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/mailer"
+	"real-time-chat-app/models"
+	repo "real-time-chat-app/repositary"
+	"real-time-chat-app/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultVerificationTTL is how long a verification link stays valid unless
+	// EMAIL_VERIFICATION_TTL_HOURS says otherwise.
+	defaultVerificationTTL = 24 * time.Hour
+	// defaultVerificationResendInterval is the least time between two verification emails
+	// unless EMAIL_VERIFICATION_RESEND_SECONDS says otherwise.
+	defaultVerificationResendInterval = 60 * time.Second
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("verification token is invalid or expired")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+	ErrVerificationThrottled    = errors.New("a verification email was sent recently, please try again later")
+)
+
+// VerifyEmail marks the email address of the user the token was sent to as verified.
+func VerifyEmail(token string) error {
+	logger.LogInfo("VerifyEmail service :: started")
+	userToken, err := repo.ConsumeUserToken(utils.HashToken(token), models.TokenPurposeEmailVerification)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+	if err := repo.MarkEmailVerified(userToken.Username); err != nil {
+		return err
+	}
+	logger.LogInfo("VerifyEmail service :: ended")
+	return nil
+}
+
+// ResendVerification sends a new verification email to an unverified user. Only the latest
+// link works, and emails are throttled to one per EMAIL_VERIFICATION_RESEND_SECONDS.
+func ResendVerification(username string) error {
+	logger.LogInfo("ResendVerification service :: started")
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	interval := envDuration("EMAIL_VERIFICATION_RESEND_SECONDS", time.Second, defaultVerificationResendInterval)
+	claimed, err := repo.ClaimVerificationEmail(username, interval)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrVerificationThrottled
+	}
+	if err := sendVerificationEmail(user); err != nil {
+		return err
+	}
+	logger.LogInfo("ResendVerification service :: ended")
+	return nil
+}
+
+// requireVerified returns models.ErrEmailNotVerified when action is restricted until the
+// user verifies their email address and they have not done so yet.
+func requireVerified(username string, action string) error {
+	if !verificationRequiredFor(action) {
+		return nil
+	}
+	user, err := repo.FetchUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified {
+		return models.ErrEmailNotVerified
+	}
+	return nil
+}
+
+// verificationRequiredFor reports whether action is listed in EMAIL_VERIFICATION_REQUIRED_FOR.
+// Messaging and contact requests are restricted when the variable is unset, and nothing is
+// when it is set to an empty value.
+func verificationRequiredFor(action string) bool {
+	value, set := os.LookupEnv("EMAIL_VERIFICATION_REQUIRED_FOR")
+	if !set {
+		value = models.VerifiedActionMessage + "," + models.VerifiedActionContact
+	}
+	for _, restricted := range strings.Split(value, ",") {
+		if strings.TrimSpace(restricted) == action {
+			return true
+		}
+	}
+	return false
+}
+
+// sendVerificationEmail replaces the user's verification token and emails them the link.
+func sendVerificationEmail(user *models.User) error {
+	token, err := utils.GenerateSecureToken()
+	if err != nil {
+		logger.LogError("sendVerificationEmail :: unable to generate token " + err.Error())
+		return errors.New("unable to create verification token")
+	}
+
+	ttl := envDuration("EMAIL_VERIFICATION_TTL_HOURS", time.Hour, defaultVerificationTTL)
+	now := time.Now().UTC()
+	if err := repo.DeleteUserTokens(user.Username, models.TokenPurposeEmailVerification); err != nil {
+		return err
+	}
+	err = repo.InsertUserToken(&models.UserToken{
+		TokenHash: utils.HashToken(token),
+		Username:  user.Username,
+		Purpose:   models.TokenPurposeEmailVerification,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	message := &mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"Please confirm your email address by opening the link below. It expires in " + strconv.Itoa(int(ttl.Hours())) + " hours.\n\n" +
+			verificationLink(token) + "\n",
+	}
+	go func() {
+		if err := mailer.Send(message); err != nil {
+			logger.LogError("sendVerificationEmail :: unable to send verification email to " + user.Username + " " + err.Error())
+		}
+	}()
+	return nil
+}
+
+// verificationLink builds the link emailed to the user from EMAIL_VERIFICATION_URL, which
+// defaults to the /auth/verify endpoint of this server.
+func verificationLink(token string) string {
+	base := os.Getenv("EMAIL_VERIFICATION_URL")
+	if base == "" {
+		base = "http://localhost" + os.Getenv("PORT") + "/auth/verify"
+	}
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "token=" + url.QueryEscape(token)
+}
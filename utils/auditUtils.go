@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// EncodeAuditCursor builds the opaque pagination cursor for an audit event.
+func EncodeAuditCursor(timestamp time.Time, eventID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(timestamp.UTC().Format(time.RFC3339Nano) + "|" + eventID))
+}
+
+// DecodeAuditCursor returns the timestamp and event ID held by an audit pagination cursor.
+func DecodeAuditCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	return timestamp, parts[1], nil
+}
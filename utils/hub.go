@@ -0,0 +1,375 @@
+package utils
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong message from the peer
+	pongWait = 60 * time.Second
+	// Send pings to the peer with this period, must be less than pongWait
+	pingPeriod = (pongWait * 9) / 10
+	// Maximum message size allowed from the peer
+	maxMessageSize = 64 * 1024
+	// Outbound messages buffered per connection before the client is considered too slow
+	sendBufferSize = 256
+	// Live events held per connection while missed events are replayed
+	maxPendingEvents = 1024
+)
+
+// Connections is the hub holding every live WebSocket connection of the server.
+var Connections = NewHub()
+
+// Hub tracks the WebSocket connections of every user. A user may be connected from several
+// devices at once, and each connection has its own buffered outbound queue and writer
+// goroutine so a slow client never blocks sends to anyone else.
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[string]map[*Client]struct{}
+
+	onOnline  func(username string)
+	onOffline func(username string)
+}
+
+// Client is a single WebSocket connection of a user, opened with the session SessionID.
+type Client struct {
+	Username  string
+	SessionID string
+
+	hub       *Hub
+	conn      *websocket.Conn
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	closeMsg  []byte
+
+	mu      sync.Mutex
+	paused  bool
+	pending []pendingEvent
+}
+
+// pendingEvent is a live event held while the client is paused.
+type pendingEvent struct {
+	seq     int64
+	payload []byte
+}
+
+// NewHub returns an empty hub.
+func NewHub() *Hub {
+	return &Hub{clients: make(map[string]map[*Client]struct{})}
+}
+
+// SetPresenceHandlers sets the functions called when a user opens their first connection and
+// closes their last one. They run on their own goroutine and should check IsOnline, since
+// the user may have reconnected or left again by the time they run.
+func (h *Hub) SetPresenceHandlers(onOnline func(username string), onOffline func(username string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onOnline = onOnline
+	h.onOffline = onOffline
+}
+
+// Register adds conn as a connection of username and starts its writer goroutine. The client
+// starts paused: live events sent to it are held until Resume is called, so missed events can
+// be replayed first.
+func (h *Hub) Register(username string, sessionID string, conn *websocket.Conn) *Client {
+	client := &Client{
+		Username:  username,
+		SessionID: sessionID,
+		hub:       h,
+		conn:      conn,
+		send:      make(chan []byte, sendBufferSize),
+		done:      make(chan struct{}),
+		paused:    true,
+	}
+
+	h.mu.Lock()
+	if h.clients[username] == nil {
+		h.clients[username] = make(map[*Client]struct{})
+	}
+	h.clients[username][client] = struct{}{}
+	count := len(h.clients[username])
+	onOnline := h.onOnline
+	h.mu.Unlock()
+
+	go client.writePump()
+	if count == 1 && onOnline != nil {
+		go onOnline(username)
+	}
+	log.Printf("WebSocket connection established for %s (%d active)", username, count)
+	return client
+}
+
+// Unregister removes the client from the hub and closes its connection.
+func (h *Hub) Unregister(client *Client) {
+	h.remove(client)
+	client.close(websocket.CloseNormalClosure, "")
+}
+
+// Send queues payload on every connection of username and returns the number of
+// connections it was queued on. Connections whose queue is full are evicted.
+func (h *Hub) Send(username string, payload []byte) int {
+	return h.SendSequenced(username, 0, payload)
+}
+
+// SendSequenced is Send for an event stored with sequence number seq, which lets paused
+// clients drop the event if it was already part of their replay.
+func (h *Hub) SendSequenced(username string, seq int64, payload []byte) int {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients[username]))
+	for client := range h.clients[username] {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	sent := 0
+	for _, client := range clients {
+		if client.SendSequenced(seq, payload) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// CloseUser closes every connection of username with the given close code and reason.
+func (h *Hub) CloseUser(username string, code int, reason string) {
+	h.mu.Lock()
+	clients := h.clients[username]
+	delete(h.clients, username)
+	onOffline := h.onOffline
+	h.mu.Unlock()
+
+	for client := range clients {
+		client.close(code, reason)
+	}
+	if len(clients) > 0 {
+		log.Printf("WebSocket connections closed for %s: %s", username, reason)
+		if onOffline != nil {
+			go onOffline(username)
+		}
+	}
+}
+
+// CloseSession closes the connections of username opened with the session sessionID.
+func (h *Hub) CloseSession(username string, sessionID string, code int, reason string) {
+	h.mu.RLock()
+	var clients []*Client
+	for client := range h.clients[username] {
+		if client.SessionID == sessionID {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		h.remove(client)
+		client.close(code, reason)
+	}
+	if len(clients) > 0 {
+		log.Printf("WebSocket connections of session %s closed for %s: %s", sessionID, username, reason)
+	}
+}
+
+// IsOnline reports whether username has at least one open connection.
+func (h *Hub) IsOnline(username string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[username]) > 0
+}
+
+// ConnectionCount returns the number of open connections across all users.
+func (h *Hub) ConnectionCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	count := 0
+	for _, clients := range h.clients {
+		count += len(clients)
+	}
+	return count
+}
+
+// UserCount returns the number of users with at least one open connection.
+func (h *Hub) UserCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// remove deletes the client from the hub and reports whether it was still registered.
+func (h *Hub) remove(client *Client) bool {
+	h.mu.Lock()
+	clients, exists := h.clients[client.Username]
+	if !exists {
+		h.mu.Unlock()
+		return false
+	}
+	if _, exists := clients[client]; !exists {
+		h.mu.Unlock()
+		return false
+	}
+	delete(clients, client)
+	last := len(clients) == 0
+	if last {
+		delete(h.clients, client.Username)
+	}
+	onOffline := h.onOffline
+	h.mu.Unlock()
+
+	if last && onOffline != nil {
+		go onOffline(client.Username)
+	}
+	return true
+}
+
+// Send queues payload for this connection without blocking. A client whose queue is full
+// is evicted from the hub, and false is returned.
+func (c *Client) Send(payload []byte) bool {
+	return c.SendSequenced(0, payload)
+}
+
+// SendSequenced queues an event with sequence number seq, or 0 for events that are not
+// stored. While the client is paused the event is held until Resume.
+func (c *Client) SendSequenced(seq int64, payload []byte) bool {
+	c.mu.Lock()
+	if c.paused {
+		defer c.mu.Unlock()
+		if len(c.pending) >= maxPendingEvents {
+			c.evict()
+			return false
+		}
+		c.pending = append(c.pending, pendingEvent{seq: seq, payload: payload})
+		return true
+	}
+	c.mu.Unlock()
+	return c.enqueue(payload)
+}
+
+// Replay queues a replayed event, waiting for room in the queue rather than evicting the
+// client. It must only be called before Resume.
+func (c *Client) Replay(payload []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- payload:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// Resume switches the client to live delivery. Held events with a sequence number up to
+// replayedSeq were already replayed and are dropped; the rest are queued in order.
+func (c *Client) Resume(replayedSeq int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, event := range c.pending {
+		if event.seq != 0 && event.seq <= replayedSeq {
+			continue
+		}
+		if !c.enqueue(event.payload) {
+			break
+		}
+	}
+	c.pending = nil
+	c.paused = false
+}
+
+// enqueue queues payload without blocking, evicting the client when its queue is full.
+func (c *Client) enqueue(payload []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- payload:
+		return true
+	default:
+		c.evict()
+		return false
+	}
+}
+
+// evict drops a client that cannot keep up with its events.
+func (c *Client) evict() {
+	log.Printf("WebSocket client for %s is too slow, evicting", c.Username)
+	c.hub.remove(c)
+	c.close(websocket.ClosePolicyViolation, "slow consumer")
+}
+
+// ReadPump reads messages from the connection and passes them to handle until the
+// connection fails, the peer stops answering pings or the client is closed. The client is
+// unregistered when ReadPump returns.
+func (c *Client) ReadPump(handle func(payload []byte)) {
+	defer c.hub.Unregister(c)
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Error reading message from %s: %v", c.Username, err)
+			}
+			return
+		}
+		handle(payload)
+	}
+}
+
+// close stops the writer goroutine, which sends a close frame and closes the connection.
+func (c *Client) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeMsg = websocket.FormatCloseMessage(code, reason)
+		close(c.done)
+	})
+}
+
+// writePump is the only goroutine writing to the connection. It drains the outbound queue
+// and pings the peer periodically so dead connections are detected by ReadPump.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case payload := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				log.Printf("Failed to send message to %s: %v", c.Username, err)
+				c.hub.remove(c)
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.hub.remove(c)
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage, c.closeMsg, time.Now().Add(writeWait))
+			return
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newHubServer serves WebSocket connections registered in hub for the user named in the
+// user query parameter, delivering live events to them straight away.
+func newHubServer(t *testing.T, hub *Hub) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := hub.Register(r.URL.Query().Get("user"), "session", conn)
+		client.Resume(0)
+		client.ReadPump(func([]byte) {})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dialHub(t *testing.T, server *httptest.Server, username string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?user="+username, nil)
+	if err != nil {
+		t.Fatalf("dial as %s: %v", username, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// addIdleClient registers a client of username whose queue nobody drains, like a peer that
+// stopped reading. It starts paused, as clients from Register do.
+func addIdleClient(hub *Hub, username string) *Client {
+	client := &Client{
+		Username: username,
+		hub:      hub,
+		send:     make(chan []byte, sendBufferSize),
+		done:     make(chan struct{}),
+		paused:   true,
+	}
+	hub.mu.Lock()
+	if hub.clients[username] == nil {
+		hub.clients[username] = make(map[*Client]struct{})
+	}
+	hub.clients[username][client] = struct{}{}
+	hub.mu.Unlock()
+	return client
+}
+
+// drain reads the queue of client until it is closed.
+func drain(client *Client) {
+	for {
+		select {
+		case <-client.send:
+		case <-client.done:
+			return
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func readText(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, payload, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return string(payload)
+}
+
+func isClosed(client *Client) bool {
+	select {
+	case <-client.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestHubSeveralConnectionsPerUser(t *testing.T) {
+	hub := NewHub()
+	online := make(chan string, 10)
+	offline := make(chan string, 10)
+	hub.SetPresenceHandlers(
+		func(username string) { online <- username },
+		func(username string) { offline <- username },
+	)
+	server := newHubServer(t, hub)
+
+	phone := dialHub(t, server, "alice")
+	laptop := dialHub(t, server, "alice")
+	bob := dialHub(t, server, "bob")
+	waitFor(t, "three connections", func() bool { return hub.ConnectionCount() == 3 })
+	if got := hub.UserCount(); got != 2 {
+		t.Fatalf("UserCount = %d, want 2", got)
+	}
+
+	if sent := hub.Send("alice", []byte("hello alice")); sent != 2 {
+		t.Fatalf("Send to alice queued on %d connections, want 2", sent)
+	}
+	if sent := hub.Send("bob", []byte("hello bob")); sent != 1 {
+		t.Fatalf("Send to bob queued on %d connections, want 1", sent)
+	}
+	if sent := hub.Send("carol", []byte("nobody")); sent != 0 {
+		t.Fatalf("Send to an offline user queued on %d connections", sent)
+	}
+	for name, conn := range map[string]*websocket.Conn{"phone": phone, "laptop": laptop} {
+		if got := readText(t, conn); got != "hello alice" {
+			t.Fatalf("%s received %q, want hello alice", name, got)
+		}
+	}
+	if got := readText(t, bob); got != "hello bob" {
+		t.Fatalf("bob received %q, want hello bob", got)
+	}
+
+	// The user stays online until their last connection closes
+	phone.Close()
+	waitFor(t, "the phone to be unregistered", func() bool { return hub.ConnectionCount() == 2 })
+	if !hub.IsOnline("alice") {
+		t.Fatal("alice is offline with the laptop still connected")
+	}
+	if sent := hub.Send("alice", []byte("to the laptop")); sent != 1 {
+		t.Fatalf("Send to alice queued on %d connections, want 1", sent)
+	}
+	if got := readText(t, laptop); got != "to the laptop" {
+		t.Fatalf("laptop received %q", got)
+	}
+
+	hub.CloseUser("alice", websocket.ClosePolicyViolation, "logged out")
+	laptop.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := laptop.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != "logged out" {
+		t.Fatalf("laptop read error %v, want close %d logged out", err, websocket.ClosePolicyViolation)
+	}
+	if hub.IsOnline("alice") {
+		t.Fatal("alice is still online after CloseUser")
+	}
+
+	presence := map[string]int{}
+	waitFor(t, "presence changes", func() bool {
+		for {
+			select {
+			case username := <-online:
+				presence["online "+username]++
+			case username := <-offline:
+				presence["offline "+username]++
+			default:
+				return presence["online alice"] == 1 && presence["online bob"] == 1 && presence["offline alice"] == 1
+			}
+		}
+	})
+	if presence["offline bob"] != 0 {
+		t.Fatal("bob went offline without disconnecting")
+	}
+}
+
+func TestHubEvictsSlowConsumer(t *testing.T) {
+	hub := NewHub()
+	fast := addIdleClient(hub, "alice")
+	slow := addIdleClient(hub, "alice")
+	fast.Resume(0)
+	slow.Resume(0)
+
+	for i := 0; i < sendBufferSize; i++ {
+		if sent := hub.Send("alice", []byte(fmt.Sprint(i))); sent != 2 {
+			t.Fatalf("event %d queued on %d connections, want 2", i, sent)
+		}
+		<-fast.send
+	}
+	if sent := hub.Send("alice", []byte("overflow")); sent != 1 {
+		t.Fatalf("overflowing event queued on %d connections, want 1", sent)
+	}
+	if !isClosed(slow) {
+		t.Fatal("slow client was not closed")
+	}
+	if isClosed(fast) {
+		t.Fatal("fast client was closed with the slow one")
+	}
+	if got := hub.ConnectionCount(); got != 1 {
+		t.Fatalf("ConnectionCount = %d after eviction, want 1", got)
+	}
+	if slow.Send([]byte("late")) {
+		t.Fatal("an evicted client accepted an event")
+	}
+	hub.Unregister(fast)
+}
+
+func TestHubEvictsPausedClientHoldingTooManyEvents(t *testing.T) {
+	hub := NewHub()
+	client := addIdleClient(hub, "alice")
+
+	for i := 1; i <= maxPendingEvents; i++ {
+		if !client.SendSequenced(int64(i), []byte(fmt.Sprint(i))) {
+			t.Fatalf("event %d was not held", i)
+		}
+	}
+	if len(client.send) != 0 {
+		t.Fatalf("%d events were queued while paused", len(client.send))
+	}
+	if client.SendSequenced(maxPendingEvents+1, []byte("overflow")) {
+		t.Fatal("event beyond maxPendingEvents was held")
+	}
+	if !isClosed(client) || hub.IsOnline("alice") {
+		t.Fatal("paused client holding too many events was not evicted")
+	}
+	if client.Replay([]byte("replayed")) {
+		t.Fatal("Replay succeeded on an evicted client")
+	}
+}
+
+func TestClientResumeDropsReplayedEvents(t *testing.T) {
+	hub := NewHub()
+	client := addIdleClient(hub, "alice")
+
+	// Events 2 and 3 are published while the missed events up to 3 are read for the replay
+	client.SendSequenced(2, []byte("live 2"))
+	client.Send([]byte("typing"))
+	client.SendSequenced(3, []byte("live 3"))
+	client.SendSequenced(4, []byte("live 4"))
+	for _, payload := range []string{"replay 1", "replay 2", "replay 3"} {
+		if !client.Replay([]byte(payload)) {
+			t.Fatalf("Replay of %s failed", payload)
+		}
+	}
+	client.Resume(3)
+	client.SendSequenced(5, []byte("live 5"))
+
+	want := []string{"replay 1", "replay 2", "replay 3", "typing", "live 4", "live 5"}
+	for _, payload := range want {
+		select {
+		case got := <-client.send:
+			if string(got) != payload {
+				t.Fatalf("queued %q, want %q", got, payload)
+			}
+		default:
+			t.Fatalf("queue ended before %q", payload)
+		}
+	}
+	if len(client.send) != 0 {
+		t.Fatalf("%d unexpected events queued", len(client.send))
+	}
+	hub.Unregister(client)
+}
+
+func TestHubConcurrentSendUnregisterCloseUser(t *testing.T) {
+	hub := NewHub()
+	hub.SetPresenceHandlers(func(string) {}, func(string) {})
+	users := []string{"alice", "bob", "carol"}
+
+	var wg sync.WaitGroup
+	for _, username := range users {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(username string) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					client := addIdleClient(hub, username)
+					client.Resume(0)
+					go drain(client)
+					hub.Send(username, []byte("event"))
+					hub.Unregister(client)
+				}
+			}(username)
+		}
+		wg.Add(2)
+		go func(username string) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				hub.SendSequenced(username, int64(j), []byte("event"))
+				hub.IsOnline(username)
+			}
+		}(username)
+		go func(username string) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				hub.CloseUser(username, websocket.CloseNormalClosure, "closed")
+				hub.ConnectionCount()
+			}
+		}(username)
+	}
+	wg.Wait()
+
+	for _, username := range users {
+		hub.CloseUser(username, websocket.CloseNormalClosure, "closed")
+	}
+	if got := hub.ConnectionCount(); got != 0 {
+		t.Fatalf("ConnectionCount = %d after closing every user, want 0", got)
+	}
+	if got := hub.UserCount(); got != 0 {
+		t.Fatalf("UserCount = %d after closing every user, want 0", got)
+	}
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"real-time-chat-app/logger"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Token types carried in the "typ" claim. Access tokens issued before token types were
+// introduced have no "typ" claim and are treated as access tokens.
+const (
+	TokenTypeAccess   = "access"
+	TokenTypeRefresh  = "refresh"
+	TokenTypeWSTicket = "ws_ticket"
+	TokenTypeMFA      = "mfa"
+)
+
+// SignToken signs claims with the active key of the keyring, naming the key in the kid header.
+func SignToken(claims jwt.MapClaims) (string, error) {
+	current := CurrentKeyring()
+	if current == nil {
+		return "", errors.New("signing keys not loaded")
+	}
+	token := jwt.NewWithClaims(current.active.Method(), claims)
+	token.Header["kid"] = current.active.ID
+	return token.SignedString(current.active.private)
+}
+
+// ParseToken validates the signature and expiry of tokenString and returns its claims. The
+// token must be signed by a key in the keyring; HS256 tokens without a kid are still
+// accepted with JWT_SECRET_KEY while it is set, so tokens issued before the keyring keep
+// working until they expire.
+func ParseToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, verificationKey)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("unable to parse claims")
+	}
+	return claims, nil
+}
+
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		secret := os.Getenv("JWT_SECRET_KEY")
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || secret == "" {
+			logger.LogError("unexpected signing method")
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(secret), nil
+	}
+
+	current := CurrentKeyring()
+	if current == nil {
+		return nil, errors.New("signing keys not loaded")
+	}
+	key, ok := current.keys[kid]
+	if !ok {
+		logger.LogError("unknown signing key " + kid)
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Alg {
+		logger.LogError("unexpected signing method " + token.Method.Alg() + " for key " + kid)
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.PublicKey(), nil
+}
+
+// TokenType returns the "typ" claim, defaulting to an access token.
+func TokenType(claims jwt.MapClaims) string {
+	tokenType, ok := claims["typ"].(string)
+	if !ok || tokenType == "" {
+		return TokenTypeAccess
+	}
+	return tokenType
+}
+
+// HashToken returns the hex encoded SHA-256 of a token, for storing tokens that only need
+// to be recognised later.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateSecureToken returns a random URL-safe token for links sent to users.
+func GenerateSecureToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognise.
+const apiKeyPrefix = "rtc_"
+
+// GenerateAPIKey returns a new API key and its ID. The key is rtc_<id>_<secret>.
+func GenerateAPIKey() (string, string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	secret, err := GenerateSecureToken()
+	if err != nil {
+		return "", "", err
+	}
+	keyID := hex.EncodeToString(id)
+	return keyID, apiKeyPrefix + keyID + "_" + secret, nil
+}
+
+// ParseAPIKey returns the ID of an API key, or false when key is not shaped like one.
+func ParseAPIKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, apiKeyPrefix), "_", 2)
+	if len(parts) != 2 || len(parts[0]) != 16 || parts[1] == "" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// APIKeySessionID is the session WebSocket connections opened with an API key belong to, so
+// they can be closed when the key is revoked.
+func APIKeySessionID(keyID string) string {
+	return "apikey:" + keyID
+}
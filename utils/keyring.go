@@ -0,0 +1,320 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"real-time-chat-app/logger"
+	"real-time-chat-app/models"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Signing algorithms supported for keys in the keyring.
+const (
+	KeyAlgRS256 = "RS256"
+	KeyAlgEdDSA = "EdDSA"
+)
+
+const (
+	// defaultKeysDir is used when JWT_KEYS_DIR is not set.
+	defaultKeysDir = "keys"
+	// activeKeyFile holds the kid of the key new tokens are signed with.
+	activeKeyFile = "active"
+	// rsaKeyBits is the size of generated RSA keys.
+	rsaKeyBits = 2048
+)
+
+// SigningKey is a private key from the keyring. Every key in the keyring verifies tokens,
+// only the active one signs new tokens.
+type SigningKey struct {
+	ID        string
+	Alg       string
+	CreatedAt time.Time
+	Active    bool
+	private   crypto.Signer
+}
+
+// Method returns the JWT signing method of the key.
+func (k *SigningKey) Method() jwt.SigningMethod {
+	if k.Alg == KeyAlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// PublicKey returns the key that verifies tokens signed with k.
+func (k *SigningKey) PublicKey() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// JWK returns the public key in JSON Web Key form.
+func (k *SigningKey) JWK() models.JWK {
+	jwk := models.JWK{KeyID: k.ID, Alg: k.Alg, Use: "sig"}
+	switch public := k.PublicKey().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// Keyring is the set of keys loaded from the keys directory.
+type Keyring struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// Keys returns every key in the keyring, oldest first.
+func (k *Keyring) Keys() []*SigningKey {
+	keys := make([]*SigningKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+// JWKS returns the public keys of the keyring, published so other services can verify tokens.
+func (k *Keyring) JWKS() models.JWKSet {
+	set := models.JWKSet{Keys: []models.JWK{}}
+	for _, key := range k.Keys() {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	return set
+}
+
+var (
+	keyringMu sync.RWMutex
+	keyring   *Keyring
+)
+
+// CurrentKeyring returns the keyring loaded by InitKeyring, or nil before it is loaded.
+func CurrentKeyring() *Keyring {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+	return keyring
+}
+
+// KeysDir returns the directory the keyring is stored in, from JWT_KEYS_DIR.
+func KeysDir() string {
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		return dir
+	}
+	return defaultKeysDir
+}
+
+// InitKeyring loads the keyring from JWT_KEYS_DIR, generating a first key with
+// JWT_SIGNING_ALG when the directory has none, and reloads it every
+// JWT_KEYS_RELOAD_SECONDS so keys rotated with the keys command are picked up without a
+// restart.
+func InitKeyring() error {
+	dir := KeysDir()
+	loaded, err := LoadKeyring(dir)
+	if err == errNoKeys {
+		var kid string
+		kid, err = GenerateKey(dir, os.Getenv("JWT_SIGNING_ALG"), true)
+		if err != nil {
+			return err
+		}
+		logger.LogInfo("InitKeyring :: generated signing key " + kid + " in " + dir)
+		loaded, err = LoadKeyring(dir)
+	}
+	if err != nil {
+		return err
+	}
+	setKeyring(loaded)
+
+	interval := 60 * time.Second
+	if value, err := strconv.Atoi(os.Getenv("JWT_KEYS_RELOAD_SECONDS")); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+	go reloadKeyring(dir, interval)
+	return nil
+}
+
+func setKeyring(loaded *Keyring) {
+	keyringMu.Lock()
+	keyring = loaded
+	keyringMu.Unlock()
+}
+
+func reloadKeyring(dir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		loaded, err := LoadKeyring(dir)
+		if err != nil {
+			// Keep using the keys already loaded
+			logger.LogError("reloadKeyring :: " + err.Error())
+			continue
+		}
+		if current := CurrentKeyring(); current == nil || current.active.ID != loaded.active.ID {
+			logger.LogInfo("reloadKeyring :: signing with key " + loaded.active.ID)
+		}
+		setKeyring(loaded)
+	}
+}
+
+var errNoKeys = errors.New("no signing keys found")
+
+// LoadKeyring reads the <kid>.pem private keys in dir and the kid of the active key from
+// the active file.
+func LoadKeyring(dir string) (*Keyring, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errNoKeys
+	}
+
+	loaded := &Keyring{keys: make(map[string]*SigningKey)}
+	for _, path := range paths {
+		key, err := readKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		loaded.keys[key.ID] = key
+	}
+
+	activeID, err := os.ReadFile(filepath.Join(dir, activeKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading active key: %w", err)
+	}
+	active, ok := loaded.keys[strings.TrimSpace(string(activeID))]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found in %s", strings.TrimSpace(string(activeID)), dir)
+	}
+	active.Active = true
+	loaded.active = active
+	return loaded, nil
+}
+
+func readKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{
+		ID:        strings.TrimSuffix(filepath.Base(path), ".pem"),
+		CreatedAt: info.ModTime().UTC(),
+	}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Alg = KeyAlgRS256
+		key.private = private
+	case ed25519.PrivateKey:
+		key.Alg = KeyAlgEdDSA
+		key.private = private
+	default:
+		return nil, errors.New("unsupported key type, use RSA or Ed25519")
+	}
+	return key, nil
+}
+
+// GenerateKey writes a new private key for alg (RS256 or EdDSA, RS256 when empty) to dir and
+// returns its kid. With activate the new key becomes the one new tokens are signed with;
+// tokens signed with the previous keys stay valid while those keys are in the directory.
+func GenerateKey(dir string, alg string, activate bool) (string, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case "", KeyAlgRS256:
+		alg = KeyAlgRS256
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case KeyAlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q, use %s or %s", alg, KeyAlgRS256, KeyAlgEdDSA)
+	}
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	kid := time.Now().UTC().Format("20060102150405") + "-" + hex.EncodeToString(suffix)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		return "", err
+	}
+	if activate {
+		if err := ActivateKey(dir, kid); err != nil {
+			return "", err
+		}
+	}
+	return kid, nil
+}
+
+// ActivateKey makes kid the key new tokens are signed with.
+func ActivateKey(dir string, kid string) error {
+	if _, err := os.Stat(filepath.Join(dir, kid+".pem")); err != nil {
+		return fmt.Errorf("key %q not found in %s", kid, dir)
+	}
+	// Write then rename so a reloading server never reads a partial file
+	tmp := filepath.Join(dir, activeKeyFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(kid+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, activeKeyFile))
+}
+
+// RetireKey removes a key that is no longer active. Tokens signed with it stop verifying, so
+// it should only be retired once they have expired.
+func RetireKey(dir string, kid string) error {
+	loaded, err := LoadKeyring(dir)
+	if err != nil {
+		return err
+	}
+	if _, ok := loaded.keys[kid]; !ok {
+		return fmt.Errorf("key %q not found in %s", kid, dir)
+	}
+	if loaded.active.ID == kid {
+		return errors.New("the active key cannot be retired, rotate first")
+	}
+	return os.Remove(filepath.Join(dir, kid+".pem"))
+}
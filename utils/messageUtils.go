@@ -2,28 +2,20 @@ package utils
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
-	"net/http"
 	"real-time-chat-app/logger"
 	"real-time-chat-app/models"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
-
-var (
-	Connections = make(map[string]*websocket.Conn) // Map of recipientID to WebSocket connection
-	ConnMutex   sync.Mutex                         // Mutex for concurrent access to connections map
-)
-
 // GenerateUUID generates a unique identifier
 func GenerateUUID() string {
 	bytes := make([]byte, 16)
@@ -38,83 +30,77 @@ func GetCurrentTimestamp() string {
 	return time.Now().UTC().Format(time.RFC3339)
 }
 
-// EstablishWebSocketConnection sets up a WebSocket connection
-func EstablishWebSocketConnection(w http.ResponseWriter, r *http.Request) {
-	recipientID := r.URL.Query().Get("recipient_id")
-	if recipientID == "" {
-		log.Println("Recipient ID is required for WebSocket connection")
-		http.Error(w, "Recipient ID is required", http.StatusBadRequest)
-		return
+// CanonicalChatID returns the chat ID shared by a direct conversation between two users.
+// The participants are sorted so both directions of the conversation map to the same ID.
+// Usernames cannot contain ':', so the ID identifies the pair unambiguously.
+func CanonicalChatID(userA string, userB string) string {
+	if userB < userA {
+		userA, userB = userB, userA
 	}
+	return "dm:" + userA + ":" + userB
+}
+
+// EncodeMessageCursor builds the opaque pagination cursor for a message.
+func EncodeMessageCursor(timestamp string, messageID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(timestamp + "|" + messageID))
+}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+// DecodeMessageCursor returns the timestamp and message ID held by a pagination cursor.
+func DecodeMessageCursor(cursor string) (string, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
 	if err != nil {
-		log.Println("Failed to upgrade WebSocket:", err)
-		return
+		return "", "", errors.New("invalid cursor")
 	}
-	defer UnregisterConnection(recipientID)
-
-	RegisterConnection(recipientID, conn)
-
-	for {
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			log.Println("Error reading WebSocket message:", err)
-			break
-		}
-		log.Printf("Received message from %s: %s", recipientID, message)
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("invalid cursor")
 	}
+	return parts[0], parts[1], nil
 }
 
-// BroadcastToRecipient sends a message to the recipient via WebSocket
-func BroadcastToRecipient(recipientID string, message *models.Message) {
-	logger.LogInfo("BroadcastToRecipient started for" + recipientID)
-	ConnMutex.Lock()
-	defer ConnMutex.Unlock()
+// NewEvent wraps payload in the versioned envelope sent over the WebSocket
+func NewEvent(eventType string, payload interface{}) *models.Event {
+	return &models.Event{
+		Version:   models.EventProtocolVersion,
+		Type:      eventType,
+		ID:        GenerateUUID(),
+		Timestamp: GetCurrentTimestamp(),
+		Payload:   payload,
+	}
+}
 
-	conn, exists := Connections[recipientID]
-	if !exists {
-		log.Printf("Recipient %s is not online. Message cannot be delivered in real-time.", recipientID)
+// SendToClient sends an event to a single connection, e.g. the answer to a command
+func SendToClient(client *Client, event *models.Event) {
+	messageBytes, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to serialize event for %s: %v", client.Username, err)
 		return
 	}
+	client.Send(messageBytes)
+}
 
-	messageBytes, err := json.Marshal(message)
+// BroadcastEvent serializes the event and queues it on every connection of the recipient, if any
+func BroadcastEvent(recipientID string, event *models.Event) {
+	logger.LogInfo("BroadcastEvent " + event.Type + " started for " + recipientID)
+	messageBytes, err := json.Marshal(event)
 	if err != nil {
 		log.Printf("Failed to serialize message for recipient %s: %v", recipientID, err)
 		return
 	}
 
-	err = conn.WriteMessage(websocket.TextMessage, messageBytes)
-	if err != nil {
-		log.Printf("Failed to send message to recipient %s: %v", recipientID, err)
-		delete(Connections, recipientID)
-		conn.Close()
+	if Connections.SendSequenced(recipientID, event.Seq, messageBytes) == 0 {
+		log.Printf("Recipient %s is not online. Message cannot be delivered in real-time.", recipientID)
 	}
 }
 
-// RegisterConnection registers a WebSocket connection for a user
-func RegisterConnection(recipientID string, conn *websocket.Conn) {
-	ConnMutex.Lock()
-	defer ConnMutex.Unlock()
-
-	if existingConn, exists := Connections[recipientID]; exists {
-		existingConn.Close()
-	}
-
-	Connections[recipientID] = conn
-	log.Printf("WebSocket connection established for recipient %s", recipientID)
+// CloseConnection closes every WebSocket connection of the user, e.g. when their session ends
+func CloseConnection(username string) {
+	Connections.CloseUser(username, websocket.ClosePolicyViolation, "session ended")
 }
 
-// UnregisterConnection unregisters a WebSocket connection for a user
-func UnregisterConnection(recipientID string) {
-	ConnMutex.Lock()
-	defer ConnMutex.Unlock()
-
-	if conn, exists := Connections[recipientID]; exists {
-		conn.Close()
-		delete(Connections, recipientID)
-		log.Printf("WebSocket connection closed for recipient %s", recipientID)
-	}
+// CloseSessionConnection closes the WebSocket connections opened with one session of the user
+func CloseSessionConnection(username string, sessionID string) {
+	Connections.CloseSession(username, sessionID, websocket.ClosePolicyViolation, "session ended")
 }
 
 // HandleError formats and sends an error response
@@ -122,28 +108,3 @@ func HandleError(c *gin.Context, statusCode int, message string, err error) {
 	log.Printf("Error: %s, Details: %v", message, err)
 	c.JSON(statusCode, gin.H{"error": message, "details": err.Error()})
 }
-
-func BroadcastToRecipientDelete(recipientID string, message *models.DeleteMessageResponse) {
-	logger.LogInfo("BroadcastToRecipient started for" + recipientID)
-	ConnMutex.Lock()
-	defer ConnMutex.Unlock()
-
-	conn, exists := Connections[recipientID]
-	if !exists {
-		log.Printf("Recipient %s is not online. Message cannot be delivered in real-time.", recipientID)
-		return
-	}
-
-	messageBytes, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Failed to serialize message for recipient %s: %v", recipientID, err)
-		return
-	}
-
-	err = conn.WriteMessage(websocket.TextMessage, messageBytes)
-	if err != nil {
-		log.Printf("Failed to send message to recipient %s: %v", recipientID, err)
-		delete(Connections, recipientID)
-		conn.Close()
-	}
-}
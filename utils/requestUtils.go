@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// TrustedProxies returns the addresses and CIDR ranges in TRUSTED_PROXIES, the reverse
+// proxies whose X-Forwarded-For and X-Real-IP headers are believed for the client IP. It is
+// nil when unset, so the client IP is the address of the direct peer.
+func TrustedProxies() []string {
+	proxies := strings.Fields(strings.ReplaceAll(os.Getenv("TRUSTED_PROXIES"), ",", " "))
+	if len(proxies) == 0 {
+		return nil
+	}
+	return proxies
+}
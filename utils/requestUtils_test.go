@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func clientIPBehind(t *testing.T, trustedProxies string, remoteAddr string) string {
+	t.Helper()
+	t.Setenv("TRUSTED_PROXIES", trustedProxies)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := r.SetTrustedProxies(TrustedProxies()); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	var clientIP string
+	r.GET("/", func(c *gin.Context) { clientIP = c.ClientIP() })
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = remoteAddr
+	request.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.5")
+	request.Header.Set("X-Real-IP", "203.0.113.8")
+	r.ServeHTTP(httptest.NewRecorder(), request)
+	return clientIP
+}
+
+func TestClientIPIgnoresForwardingHeadersOfUntrustedPeers(t *testing.T) {
+	if got := clientIPBehind(t, "", "198.51.100.1:4321"); got != "198.51.100.1" {
+		t.Fatalf("without trusted proxies the client IP is %s, want the peer 198.51.100.1", got)
+	}
+	if got := clientIPBehind(t, "10.0.0.0/8", "198.51.100.1:4321"); got != "198.51.100.1" {
+		t.Fatalf("from an untrusted peer the client IP is %s, want the peer 198.51.100.1", got)
+	}
+	if got := clientIPBehind(t, "10.0.0.0/8, 192.0.2.1", "10.0.0.9:4321"); got != "203.0.113.7" {
+		t.Fatalf("behind trusted proxies the client IP is %s, want 203.0.113.7", got)
+	}
+}
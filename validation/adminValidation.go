@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"errors"
+	"net/url"
+	"real-time-chat-app/models"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// ValidateAdminUserQuery builds a user listing query from the search, role, type, suspended,
+// cursor and limit query parameters.
+func ValidateAdminUserQuery(values url.Values) (*models.AdminUserQuery, error) {
+	query := &models.AdminUserQuery{
+		Search: strings.TrimSpace(values.Get("search")),
+		Role:   models.Role(values.Get("role")),
+		Type:   models.UserType(values.Get("type")),
+		Cursor: values.Get("cursor"),
+		Limit:  defaultUserPageSize,
+	}
+
+	if query.Role != "" && query.Role != models.Admin && query.Role != models.Client {
+		return nil, errors.New("role must be ADMIN or CLIENT")
+	}
+	if query.Type != "" && query.Type != models.UserTypeBot && query.Type != models.UserTypePerson {
+		return nil, errors.New("type must be bot or person")
+	}
+	if value := values.Get("suspended"); value != "" {
+		suspended, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("suspended must be true or false")
+		}
+		query.Suspended = &suspended
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		size, err := strconv.Atoi(limit)
+		if err != nil || size < 1 {
+			return nil, errors.New("limit must be a positive number")
+		}
+		if size > maxUserPageSize {
+			size = maxUserPageSize
+		}
+		query.Limit = size
+	}
+
+	return query, nil
+}
@@ -0,0 +1,63 @@
+package validation
+
+import (
+	"errors"
+	"net/url"
+	"real-time-chat-app/models"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// ValidateAuditQuery builds an audit log query from the actor, action, target, outcome, ip,
+// from, to, cursor and limit query parameters. from and to are RFC 3339 times.
+func ValidateAuditQuery(values url.Values) (*models.AuditQuery, error) {
+	query := &models.AuditQuery{
+		Actor:   values.Get("actor"),
+		Action:  models.AuditAction(values.Get("action")),
+		Target:  values.Get("target"),
+		Outcome: models.AuditOutcome(values.Get("outcome")),
+		IP:      values.Get("ip"),
+		Cursor:  values.Get("cursor"),
+		Limit:   defaultAuditPageSize,
+	}
+
+	if query.Outcome != "" && query.Outcome != models.AuditSuccess && query.Outcome != models.AuditFailure {
+		return nil, errors.New("outcome must be success or failure")
+	}
+	for _, bound := range []struct {
+		name string
+		dest **time.Time
+	}{
+		{"from", &query.From},
+		{"to", &query.To},
+	} {
+		if value := values.Get(bound.name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, errors.New(bound.name + " must be an RFC 3339 time")
+			}
+			*bound.dest = &parsed
+		}
+	}
+	if query.From != nil && query.To != nil && query.To.Before(*query.From) {
+		return nil, errors.New("to must not be before from")
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		size, err := strconv.Atoi(limit)
+		if err != nil || size < 1 {
+			return nil, errors.New("limit must be a positive number")
+		}
+		if size > maxAuditPageSize {
+			size = maxAuditPageSize
+		}
+		query.Limit = size
+	}
+
+	return query, nil
+}
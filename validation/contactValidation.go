@@ -3,18 +3,14 @@ package validation
 import (
 	"errors"
 	"real-time-chat-app/models"
-
-	"github.com/golang-jwt/jwt"
 )
 
-func ValidateAddAndUpdateContact(contactRequest *models.ContactRequest, claim jwt.MapClaims) error {
+func ValidateAddAndUpdateContact(contactRequest *models.ContactRequest, username string) error {
 
 	if !contactRequest.IsValidStatus() {
 		return errors.New("pending, accepted, blocked can only be valid status")
 	}
 
-	username := claim["username"].(string)
-
 	if username != contactRequest.FromUserID {
 		return errors.New("you can only send a contact request using the logged-in user's username")
 	}
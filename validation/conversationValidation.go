@@ -0,0 +1,59 @@
+package validation
+
+import (
+	"errors"
+	"real-time-chat-app/models"
+	"strings"
+)
+
+func ValidateCreateConversation(request *models.CreateConversationRequest) error {
+
+	if len(strings.TrimSpace(request.Name)) < 1 {
+		return errors.New("please provide a name for the conversation")
+	}
+
+	if len(request.Members) < 1 {
+		return errors.New("please provide at least one member for the conversation")
+	}
+
+	return nil
+}
+
+func ValidateRenameConversation(request *models.RenameConversationRequest) error {
+
+	if len(request.ConversationID) < 1 {
+		return errors.New("please provide the conversation_id")
+	}
+
+	if len(strings.TrimSpace(request.Name)) < 1 {
+		return errors.New("please provide a name for the conversation")
+	}
+
+	return nil
+}
+
+func ValidateConversationMembers(request *models.ConversationMembersRequest) error {
+
+	if len(request.ConversationID) < 1 {
+		return errors.New("please provide the conversation_id")
+	}
+
+	if len(request.Members) < 1 {
+		return errors.New("please provide at least one member")
+	}
+
+	return nil
+}
+
+func ValidateConversationRole(request *models.ConversationRoleRequest) error {
+
+	if len(request.ConversationID) < 1 {
+		return errors.New("please provide the conversation_id")
+	}
+
+	if len(request.Username) < 1 {
+		return errors.New("please provide the username of the member")
+	}
+
+	return request.Role.IsValid()
+}
@@ -0,0 +1,39 @@
+package validation
+
+import (
+	"errors"
+	"real-time-chat-app/models"
+	"strconv"
+)
+
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 100
+)
+
+// ValidateMessagePage builds a page request from the before, after and limit query parameters.
+func ValidateMessagePage(before string, after string, limit string) (*models.MessagePageRequest, error) {
+
+	if before != "" && after != "" {
+		return nil, errors.New("only one of before or after can be provided")
+	}
+
+	page := &models.MessagePageRequest{
+		Before: before,
+		After:  after,
+		Limit:  defaultMessagePageSize,
+	}
+
+	if limit != "" {
+		size, err := strconv.Atoi(limit)
+		if err != nil || size < 1 {
+			return nil, errors.New("limit must be a positive number")
+		}
+		if size > maxMessagePageSize {
+			size = maxMessagePageSize
+		}
+		page.Limit = size
+	}
+
+	return page, nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"real-time-chat-app/models"
 	"regexp"
+	"strings"
 	"unicode"
 )
 
@@ -13,6 +14,18 @@ func SignUpUserValidation(user *models.User) error {
 	if len(user.Username) < 5 {
 		return errors.New("username must be at least 5 characters long")
 	}
+	if strings.HasPrefix(user.Username, models.DeletedUserPrefix) {
+		return errors.New("usernames cannot start with " + models.DeletedUserPrefix)
+	}
+	// Direct chat IDs join the two usernames with ':', see utils.CanonicalChatID
+	if strings.Contains(user.Username, ":") {
+		return errors.New("username cannot contain ':'")
+	}
+
+	// Only client accounts can sign up; admins are promoted through /admin/users/:username/role
+	if user.Role != "" && user.Role != models.Client {
+		return errors.New("only CLIENT accounts can be created through signup")
+	}
 
 	// Validate email format using a regular expression
 	if !isValidEmail(user.Email) {
@@ -20,8 +33,8 @@ func SignUpUserValidation(user *models.User) error {
 	}
 
 	// Validate password (at least 6 characters long and contains at least one number)
-	if len(user.Password) < 6 || !hasNumber(user.Password) || !hasSpecialCharacter(user.Password) {
-		return errors.New("password must be at least 6 characters long, contain at least one number, and one special character")
+	if err := ValidatePassword(user.Password); err != nil {
+		return err
 	}
 
 	// Validate first name (required)
@@ -62,6 +75,47 @@ func LoginUserValidation(user *models.LoginUser) error {
 	return nil
 }
 
+// ValidatePassword checks that a new password is at least 6 characters long and contains a
+// number and a special character.
+func ValidatePassword(password string) error {
+	if len(password) < 6 || !hasNumber(password) || !hasSpecialCharacter(password) {
+		return errors.New("password must be at least 6 characters long, contain at least one number, and one special character")
+	}
+	return nil
+}
+
+func ForgotPasswordValidation(request *models.ForgotPasswordRequest) error {
+
+	if !isValidEmail(request.Email) {
+		return errors.New("invalid email format")
+	}
+	return nil
+}
+
+func ResetPasswordValidation(request *models.ResetPasswordRequest) error {
+
+	if len(request.Token) < 1 {
+		return errors.New("token must be provided")
+	}
+	return ValidatePassword(request.Password)
+}
+
+func DeleteAccountValidation(request *models.DeleteAccountRequest) error {
+
+	if len(request.Password) < 1 {
+		return errors.New("password must be provided")
+	}
+	return nil
+}
+
+func RestoreAccountValidation(request *models.RestoreAccountRequest) error {
+
+	if len(request.Token) < 1 {
+		return errors.New("token must be provided")
+	}
+	return nil
+}
+
 // Helper function to check if the email is valid
 func isValidEmail(email string) bool {
 	// Simple email regex pattern